@@ -0,0 +1,700 @@
+package gojimongo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	BYTECODE_ERROR_FILTER  = "query is not a single filter on the root, such as $[?@.a == 1]"
+	BYTECODE_ERROR_SUBSET  = "expression is outside the bytecode subset"
+	BYTECODE_ERROR_TEST    = "expression is not a test"
+	BYTECODE_ERROR_OPERAND = "expression is not a comparison operand"
+	BYTECODE_ERROR_LIMIT   = "program exceeds 65535 bytes of code, constants or paths"
+	BYTECODE_ERROR_HEADER  = "not a gojimongo program"
+	BYTECODE_ERROR_VERSION = "unsupported bytecode version"
+	BYTECODE_ERROR_CORRUPT = "malformed program"
+)
+
+// BytecodeVersion is the version of the instruction set and of the encoding
+// MarshalBinary writes. UnmarshalBinary rejects programs of other versions.
+const BytecodeVersion = 1
+
+// bytecodeMagic starts the encoding of a program.
+const bytecodeMagic = "GJBC"
+
+// BytecodeError reports an expression CompileFilter cannot compile to
+// bytecode. Such filters are evaluated by the closures of PreparedQuery.
+type BytecodeError struct {
+	Node   string // AST node type, e.g. "AbsQuery"
+	Reason string
+}
+
+func (e *BytecodeError) Error() string {
+	return fmt.Sprintf("[gojimongo][bytecode]: cannot compile %s: %s", e.Node, e.Reason)
+}
+
+func bytecodeError(value string) error {
+	return fmt.Errorf("[gojimongo][bytecode]: %s", value)
+}
+
+// WithBytecode runs the filters of evaluated queries on the bytecode VM when
+// their condition is in the bytecode subset, see CompileFilter. The others
+// are evaluated as without it.
+func WithBytecode() EvalOption {
+	return func(c *evalConfig) {
+		c.bytecode = true
+	}
+}
+
+// Program is a filter condition compiled to the instructions of a stack
+// machine. Its instructions are one opcode byte, followed, for the opcodes
+// taking one, by a 2-byte big-endian operand: an index into the constants or
+// the paths of the program, a function or a jump target.
+//
+// A program tests the node '@' refers to and leaves the result of the test
+// on the stack. && and || jump over their right operand when the left one
+// decides the test. Use Disassemble to read a program.
+type Program struct {
+	code   []byte
+	consts []any          // nil, bools, ints and strings
+	paths  [][]lookupStep // singular relative queries
+	depth  int            // the size of the stack the program needs
+}
+
+// Opcodes.
+const (
+	opConst     byte = iota + 1 // push consts[operand]
+	opPath                      // push the node paths[operand] selects from @, or nothing
+	opExists                    // push whether paths[operand] selects a node
+	opCount                     // push the number of nodes paths[operand] selects, 0 or 1
+	opEq                        // pop two operands, push their comparison
+	opNe                        //
+	opLt                        //
+	opLte                       //
+	opGt                        //
+	opGte                       //
+	opNot                       // negate the test on top
+	opJumpFalse                 // jump to operand when the top is false, else pop it
+	opJumpTrue                  // jump to operand when the top is true, else pop it
+	opCall                      // call bytecodeFunctions[operand] on its arguments
+)
+
+var opNames = [...]string{
+	opConst:     "const",
+	opPath:      "path",
+	opExists:    "exists",
+	opCount:     "count",
+	opEq:        "eq",
+	opNe:        "ne",
+	opLt:        "lt",
+	opLte:       "lte",
+	opGt:        "gt",
+	opGte:       "gte",
+	opNot:       "not",
+	opJumpFalse: "jump_false",
+	opJumpTrue:  "jump_true",
+	opCall:      "call",
+}
+
+// bytecodeFunctions are the functions opCall calls. count is compiled to
+// opCount, its argument being a query rather than a value.
+var bytecodeFunctions = []string{"length", "match", "search"}
+
+// hasOperand reports whether op is followed by an operand.
+func hasOperand(op byte) bool {
+	switch op {
+	case opConst, opPath, opExists, opCount, opJumpFalse, opJumpTrue, opCall:
+		return true
+	}
+	return false
+}
+
+// CompileFilter compiles the condition of q, a single filter on the root
+// such as $[?@.price < 10 && @.category == 'fiction'], to bytecode. The
+// condition may hold logical operators, comparisons, literals, negative
+// integers, singular relative queries and calls to length(), count(),
+// match() and search(); anything else fails with a BytecodeError.
+func CompileFilter(q Query) (*Program, error) {
+	abs, ok := q.(*AbsQuery)
+	if !ok || len(abs.segments) != 1 {
+		return nil, bytecodeError(BYTECODE_ERROR_FILTER)
+	}
+	seg, ok := abs.segments[0].(*ChildSegment)
+	if !ok || len(seg.selectors) != 1 {
+		return nil, bytecodeError(BYTECODE_ERROR_FILTER)
+	}
+	filter, ok := seg.selectors[0].(*FilterSelector)
+	if !ok {
+		return nil, bytecodeError(BYTECODE_ERROR_FILTER)
+	}
+	return compileCondition(filter.cond)
+}
+
+// bytecodeCompiler emits the instructions of a program.
+type bytecodeCompiler struct {
+	p   *Program
+	err error
+}
+
+func compileCondition(e Expr) (*Program, error) {
+	c := &bytecodeCompiler{p: &Program{}}
+	c.test(e)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if len(c.p.code) > 0xffff {
+		return nil, bytecodeError(BYTECODE_ERROR_LIMIT)
+	}
+	if err := c.p.verify(); err != nil {
+		return nil, err
+	}
+	return c.p, nil
+}
+
+func (c *bytecodeCompiler) fail(node any, reason string) {
+	if c.err == nil {
+		c.err = &BytecodeError{nodeName(node), reason}
+	}
+}
+
+// emit appends an instruction and returns its offset.
+func (c *bytecodeCompiler) emit(op byte, operand ...int) int {
+	at := len(c.p.code)
+	c.p.code = append(c.p.code, op)
+	for _, o := range operand {
+		if o > 0xffff {
+			c.err = bytecodeError(BYTECODE_ERROR_LIMIT)
+		}
+		c.p.code = binary.BigEndian.AppendUint16(c.p.code, uint16(o))
+	}
+	return at
+}
+
+func (c *bytecodeCompiler) constant(value any) {
+	for i, k := range c.p.consts {
+		if k == value {
+			c.emit(opConst, i)
+			return
+		}
+	}
+	c.p.consts = append(c.p.consts, value)
+	c.emit(opConst, len(c.p.consts)-1)
+}
+
+// path adds the singular relative query e is to the paths of the program.
+func (c *bytecodeCompiler) path(e Expr) (int, bool) {
+	q, ok := closureUnwrap(e).(*RelQuery)
+	if !ok {
+		return 0, false
+	}
+	steps, ok := lookupSteps(q.segments)
+	if !ok {
+		return 0, false
+	}
+	c.p.paths = append(c.p.paths, steps)
+	return len(c.p.paths) - 1, true
+}
+
+func (c *bytecodeCompiler) test(e Expr) {
+	switch x := closureUnwrap(e).(type) {
+	case *NotExpr:
+		c.test(x.expr)
+		c.emit(opNot)
+	case *AndExpr:
+		c.logical(opJumpFalse, x.lhs, x.rhs)
+	case *OrExpr:
+		c.logical(opJumpTrue, x.lhs, x.rhs)
+	case *EqeqExpr:
+		c.compare(opEq, x.lhs, x.rhs)
+	case *NeqExpr:
+		c.compare(opNe, x.lhs, x.rhs)
+	case *LtExpr:
+		c.compare(opLt, x.lhs, x.rhs)
+	case *LteExpr:
+		c.compare(opLte, x.lhs, x.rhs)
+	case *GtExpr:
+		c.compare(opGt, x.lhs, x.rhs)
+	case *GteExpr:
+		c.compare(opGte, x.lhs, x.rhs)
+	case *RelQuery:
+		i, ok := c.path(x)
+		if !ok {
+			c.fail(x, BYTECODE_ERROR_SUBSET)
+			return
+		}
+		c.emit(opExists, i)
+	case *FnExpr:
+		if x.name != "match" && x.name != "search" {
+			c.fail(x, BYTECODE_ERROR_TEST)
+			return
+		}
+		c.call(x)
+	case *AbsQuery:
+		c.fail(x, BYTECODE_ERROR_SUBSET)
+	default:
+		if isLogical(x) {
+			c.fail(x, BYTECODE_ERROR_SUBSET)
+			return
+		}
+		c.fail(x, BYTECODE_ERROR_TEST)
+	}
+}
+
+// logical compiles && and ||: jump skips the right operand when the left one
+// decides the test, leaving it on the stack.
+func (c *bytecodeCompiler) logical(jump byte, lhs, rhs Expr) {
+	c.test(lhs)
+	at := c.emit(jump, 0)
+	c.test(rhs)
+	binary.BigEndian.PutUint16(c.p.code[at+1:], uint16(len(c.p.code)))
+}
+
+func (c *bytecodeCompiler) compare(op byte, lhs, rhs Expr) {
+	c.operand(lhs)
+	c.operand(rhs)
+	c.emit(op)
+}
+
+func (c *bytecodeCompiler) operand(e Expr) {
+	if value, ok := literalValue(e); ok {
+		c.constant(value)
+		return
+	}
+	switch x := closureUnwrap(e).(type) {
+	case *RelQuery:
+		i, ok := c.path(x)
+		if !ok {
+			c.fail(x, BYTECODE_ERROR_SUBSET)
+			return
+		}
+		c.emit(opPath, i)
+	case *FnExpr:
+		switch x.name {
+		case "length":
+			c.call(x)
+		case "count":
+			if len(x.params) != 1 {
+				c.fail(x, CHECKER_ERROR_ARGUMENTS)
+				return
+			}
+			i, ok := c.path(x.params[0])
+			if !ok {
+				c.fail(x.params[0], BYTECODE_ERROR_SUBSET)
+				return
+			}
+			c.emit(opCount, i)
+		default:
+			c.fail(x, BYTECODE_ERROR_OPERAND)
+		}
+	default:
+		if isLogical(x) {
+			c.fail(x, BYTECODE_ERROR_OPERAND)
+			return
+		}
+		c.fail(x, BYTECODE_ERROR_SUBSET)
+	}
+}
+
+// call compiles a call to length(), match() or search().
+func (c *bytecodeCompiler) call(fn *FnExpr) {
+	if len(fn.params) != len(functions[fn.name].params) {
+		c.fail(fn, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	for _, param := range fn.params {
+		c.operand(param)
+	}
+	for i, name := range bytecodeFunctions {
+		if name == fn.name {
+			c.emit(opCall, i)
+		}
+	}
+}
+
+// Match reports whether the filter p was compiled from holds for doc, read
+// as the evaluator reads documents: doc is the node '@' refers to.
+func (p *Program) Match(doc any, opts ...EvalOption) bool {
+	return p.run(evalRoot(doc, opts))
+}
+
+// run executes p with current as '@'. Programs are verified when compiled or
+// decoded, so the stack neither underflows nor outgrows p.depth.
+func (p *Program) run(current any) bool {
+	var buf [16]any
+	stack := buf[:0]
+	if p.depth > len(buf) {
+		stack = make([]any, 0, p.depth)
+	}
+	code := p.code
+	for pc := 0; pc < len(code); {
+		op := code[pc]
+		operand := 0
+		if hasOperand(op) {
+			operand = int(binary.BigEndian.Uint16(code[pc+1:]))
+			pc += 3
+		} else {
+			pc++
+		}
+		top := len(stack) - 1
+		switch op {
+		case opConst:
+			stack = append(stack, p.consts[operand])
+		case opPath:
+			value, ok := lookup(current, p.paths[operand])
+			if !ok {
+				value = evalNothing{}
+			}
+			stack = append(stack, value)
+		case opExists:
+			_, ok := lookup(current, p.paths[operand])
+			stack = append(stack, ok)
+		case opCount:
+			n := 0
+			if _, ok := lookup(current, p.paths[operand]); ok {
+				n = 1
+			}
+			stack = append(stack, n)
+		case opEq, opNe, opLt, opLte, opGt, opGte:
+			stack[top-1] = evalCompare(compareOp(op-opEq), stack[top-1], stack[top])
+			stack = stack[:top]
+		case opNot:
+			stack[top] = !stack[top].(bool)
+		case opJumpFalse, opJumpTrue:
+			if stack[top].(bool) == (op == opJumpTrue) {
+				pc = operand
+			} else {
+				stack = stack[:top]
+			}
+		case opCall:
+			switch bytecodeFunctions[operand] {
+			case "length":
+				stack[top] = bytecodeLength(stack[top])
+			case "match", "search":
+				s, ok := stack[top-1].(string)
+				pattern, isString := stack[top].(string)
+				re := compileIRegexp(pattern, bytecodeFunctions[operand] == "match")
+				stack[top-1] = ok && isString && re != nil && re.MatchString(s)
+				stack = stack[:top]
+			}
+		}
+	}
+	return stack[0].(bool)
+}
+
+// bytecodeLength evaluates length() as VisitorEval does.
+func bytecodeLength(value any) any {
+	if s, ok := value.(string); ok {
+		return utf8.RuneCountInString(s)
+	}
+	if elements, ok := closureElements(value); ok {
+		return len(elements)
+	}
+	if members, ok := evalMembers(value); ok {
+		return len(members)
+	}
+	return evalNothing{}
+}
+
+// verify checks that p runs to completion with a test on the stack: opcodes
+// and operands are valid, jumps go forward to an instruction where the stack
+// holds what it holds when jumping, and each instruction finds the values or
+// tests it pops. It sets p.depth.
+func (p *Program) verify() error {
+	// stack holds a 'v' for each value and an 'l' for each test.
+	stack := ""
+	targets := map[int]string{}
+	corrupt := bytecodeError(BYTECODE_ERROR_CORRUPT)
+	for pc := 0; pc < len(p.code); {
+		op := p.code[pc]
+		if op == 0 || int(op) >= len(opNames) {
+			return corrupt
+		}
+		if s, ok := targets[pc]; ok {
+			if s != stack {
+				return corrupt
+			}
+			delete(targets, pc)
+		}
+		operand, next := 0, pc+1
+		if hasOperand(op) {
+			if pc+3 > len(p.code) {
+				return corrupt
+			}
+			operand, next = int(binary.BigEndian.Uint16(p.code[pc+1:])), pc+3
+		}
+		var pops, pushes string
+		switch op {
+		case opConst:
+			if operand >= len(p.consts) {
+				return corrupt
+			}
+			pushes = "v"
+		case opPath, opExists, opCount:
+			if operand >= len(p.paths) {
+				return corrupt
+			}
+			pushes = "v"
+			if op == opExists {
+				pushes = "l"
+			}
+		case opEq, opNe, opLt, opLte, opGt, opGte:
+			pops, pushes = "vv", "l"
+		case opNot:
+			pops, pushes = "l", "l"
+		case opJumpFalse, opJumpTrue:
+			if operand <= pc || operand > len(p.code) || !strings.HasSuffix(stack, "l") {
+				return corrupt
+			}
+			if s, ok := targets[operand]; ok && s != stack {
+				return corrupt
+			}
+			targets[operand] = stack
+			pops = "l"
+		case opCall:
+			if operand >= len(bytecodeFunctions) {
+				return corrupt
+			}
+			pops, pushes = "v", "v"
+			if bytecodeFunctions[operand] != "length" {
+				pops, pushes = "vv", "l"
+			}
+		}
+		if !strings.HasSuffix(stack, pops) {
+			return corrupt
+		}
+		stack = stack[:len(stack)-len(pops)] + pushes
+		p.depth = max(p.depth, len(stack))
+		pc = next
+	}
+	if s, ok := targets[len(p.code)]; ok && s != stack {
+		return corrupt
+	}
+	delete(targets, len(p.code))
+	if stack != "l" || len(targets) > 0 {
+		return corrupt
+	}
+	return nil
+}
+
+// Disassemble lists the instructions of p, one per line, with their offset,
+// e.g. for @.price < 10 || @.isbn:
+//
+//	0000 path       0  @['price']
+//	0003 const      0  10
+//	0006 lt
+//	0007 jump_true  0013
+//	0010 exists     1  @['isbn']
+func (p *Program) Disassemble() string {
+	var b strings.Builder
+	for pc := 0; pc < len(p.code); pc++ {
+		op := p.code[pc]
+		if !hasOperand(op) {
+			fmt.Fprintf(&b, "%04d %s\n", pc, opNames[op])
+			continue
+		}
+		operand := int(binary.BigEndian.Uint16(p.code[pc+1:]))
+		fmt.Fprintf(&b, "%04d %-10s ", pc, opNames[op])
+		switch op {
+		case opConst:
+			fmt.Fprintf(&b, "%d  %s", operand, bytecodeLiteral(p.consts[operand]))
+		case opPath, opExists, opCount:
+			fmt.Fprintf(&b, "%d  @%s", operand, strings.TrimPrefix(lookupPath(p.paths[operand]).String(), "$"))
+		case opJumpFalse, opJumpTrue:
+			fmt.Fprintf(&b, "%04d", operand)
+		case opCall:
+			fmt.Fprintf(&b, "%d  %s()", operand, bytecodeFunctions[operand])
+		}
+		b.WriteByte('\n')
+		pc += 2
+	}
+	return b.String()
+}
+
+// lookupPath returns the steps of a singular query as a path.
+func lookupPath(steps []lookupStep) NormalizedPath {
+	path := make(NormalizedPath, len(steps))
+	for i, step := range steps {
+		path[i] = step.name
+		if step.byIndex {
+			path[i] = step.index
+		}
+	}
+	return path
+}
+
+func bytecodeLiteral(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		var b strings.Builder
+		b.WriteByte('\'')
+		writeNormalizedName(&b, v)
+		b.WriteByte('\'')
+		return b.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// Constant tags of the encoding.
+const (
+	constNull byte = iota
+	constFalse
+	constTrue
+	constInt
+	constString
+)
+
+// MarshalBinary encodes p: the magic "GJBC", the version byte, then the
+// constants, the paths and the code, each list preceded by its length as a
+// uvarint. A constant is a tag byte followed by a varint for ints and a
+// length-prefixed string for strings; a path is its number of steps followed
+// by each step, a 0 byte and a length-prefixed name or a 1 byte and a varint
+// index.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	data := append([]byte(bytecodeMagic), BytecodeVersion)
+	data = binary.AppendUvarint(data, uint64(len(p.consts)))
+	for _, k := range p.consts {
+		switch v := k.(type) {
+		case nil:
+			data = append(data, constNull)
+		case bool:
+			if v {
+				data = append(data, constTrue)
+			} else {
+				data = append(data, constFalse)
+			}
+		case int:
+			data = binary.AppendVarint(append(data, constInt), int64(v))
+		case string:
+			data = binary.AppendUvarint(append(data, constString), uint64(len(v)))
+			data = append(data, v...)
+		}
+	}
+	data = binary.AppendUvarint(data, uint64(len(p.paths)))
+	for _, steps := range p.paths {
+		data = binary.AppendUvarint(data, uint64(len(steps)))
+		for _, step := range steps {
+			if step.byIndex {
+				data = binary.AppendVarint(append(data, 1), int64(step.index))
+				continue
+			}
+			data = binary.AppendUvarint(append(data, 0), uint64(len(step.name)))
+			data = append(data, step.name...)
+		}
+	}
+	data = binary.AppendUvarint(data, uint64(len(p.code)))
+	return append(data, p.code...), nil
+}
+
+// UnmarshalBinary decodes a program MarshalBinary encoded, and verifies it
+// so that running it cannot fail.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(bytecodeMagic)) || len(data) < len(bytecodeMagic)+1 {
+		return bytecodeError(BYTECODE_ERROR_HEADER)
+	}
+	if version := data[len(bytecodeMagic)]; version != BytecodeVersion {
+		return bytecodeError(fmt.Sprintf("%s %d", BYTECODE_ERROR_VERSION, version))
+	}
+	r := &bytecodeReader{data: data[len(bytecodeMagic)+1:]}
+	decoded := Program{}
+	for range r.count() {
+		switch r.byte() {
+		case constNull:
+			decoded.consts = append(decoded.consts, nil)
+		case constFalse:
+			decoded.consts = append(decoded.consts, false)
+		case constTrue:
+			decoded.consts = append(decoded.consts, true)
+		case constInt:
+			decoded.consts = append(decoded.consts, r.int())
+		case constString:
+			decoded.consts = append(decoded.consts, r.string())
+		default:
+			r.corrupt = true
+		}
+	}
+	for range r.count() {
+		steps := []lookupStep{}
+		for range r.count() {
+			switch r.byte() {
+			case 0:
+				steps = append(steps, lookupStep{name: r.string()})
+			case 1:
+				steps = append(steps, lookupStep{index: r.int(), byIndex: true})
+			default:
+				r.corrupt = true
+			}
+		}
+		decoded.paths = append(decoded.paths, steps)
+	}
+	decoded.code = r.bytes(r.count())
+	if r.corrupt || len(r.data) > 0 || len(decoded.code) > 0xffff {
+		return bytecodeError(BYTECODE_ERROR_CORRUPT)
+	}
+	if err := decoded.verify(); err != nil {
+		return err
+	}
+	*p = decoded
+	return nil
+}
+
+// bytecodeReader reads an encoded program, recording rather than returning
+// the first malformed value.
+type bytecodeReader struct {
+	data    []byte
+	corrupt bool
+}
+
+func (r *bytecodeReader) byte() byte {
+	if r.corrupt || len(r.data) == 0 {
+		r.corrupt = true
+		return 0xff
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+// count reads the length of a list, which cannot exceed what is left.
+func (r *bytecodeReader) count() int {
+	n, size := binary.Uvarint(r.data)
+	if r.corrupt || size <= 0 || n > uint64(len(r.data)) {
+		r.corrupt = true
+		return 0
+	}
+	r.data = r.data[size:]
+	return int(n)
+}
+
+func (r *bytecodeReader) int() int {
+	n, size := binary.Varint(r.data)
+	if r.corrupt || size <= 0 || int64(int(n)) != n {
+		r.corrupt = true
+		return 0
+	}
+	r.data = r.data[size:]
+	return int(n)
+}
+
+func (r *bytecodeReader) bytes(n int) []byte {
+	if r.corrupt || n > len(r.data) {
+		r.corrupt = true
+		return nil
+	}
+	b := bytes.Clone(r.data[:n])
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *bytecodeReader) string() string {
+	s := string(r.bytes(r.count()))
+	if !utf8.ValidString(s) {
+		r.corrupt = true
+	}
+	return s
+}
@@ -0,0 +1,266 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// bytecodeFilters are conditions of the bytecode subset.
+var bytecodeFilters = []string{
+	"@.isbn",
+	"!@.isbn",
+	"@.price < 10",
+	"10 > @.price",
+	"@.price <= 9 && @.category == 'fiction'",
+	"@.category != 'fiction' || @.isbn",
+	"@.isbn || @.price > 20 || @.author == 'Evelyn Waugh'",
+	"!(@.isbn && @.price < 10)",
+	"@.author >= 'J'",
+	"@.missing == null",
+	"@.missing != true",
+	"@.missing == @.other",
+	"@.tags[-1] == 'b'",
+	"@['tags'][0] == 'a' && @.tags[1]",
+	"@.price == -1 || @.price != -1",
+	"length(@.title) > 15",
+	"length(@.tags) == 2",
+	"length(@.price) == null",
+	"count(@.isbn) == 1",
+	"match(@.author, '.*Rees')",
+	"search(@.title, 'of ')",
+	"search(@.title, @.category)",
+	"1 == 1",
+	"true != false",
+}
+
+func TestCompileFilter(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`[
+		{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+		{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99, "tags": ["a", "b"]},
+		{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+		{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99, "tags": ["a"]}
+	]`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	c := &Compiler{}
+	for _, cond := range bytecodeFilters {
+		q, err := c.Compile("$[?" + cond + "]")
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", cond, err)
+		}
+		p, err := CompileFilter(q)
+		if err != nil {
+			t.Errorf("CompileFilter(%q) = %v", cond, err)
+			continue
+		}
+		expected, err := Evaluate(q, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []any{}
+		for _, record := range doc.([]any) {
+			if p.Match(record) {
+				got = append(got, record)
+			}
+		}
+		if mustMarshal(got) != mustMarshal(expected) {
+			t.Errorf("%s matches %s; expected %s\n%s", cond, mustMarshal(got), mustMarshal(expected), p.Disassemble())
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	programs := map[string]string{
+		"@.price < 10 || @.isbn": `
+0000 path       0  @['price']
+0003 const      0  10
+0006 lt
+0007 jump_true  0013
+0010 exists     1  @['isbn']
+`,
+		"!(@.a[-1] == 'x' && match(@.b, 'x'))": `
+0000 path       0  @['a'][-1]
+0003 const      0  'x'
+0006 eq
+0007 jump_false 0019
+0010 path       1  @['b']
+0013 const      0  'x'
+0016 call       1  match()
+0019 not
+`,
+		"length(@.tags) >= count(@.tags) && @.a != null": `
+0000 path       0  @['tags']
+0003 call       0  length()
+0006 count      1  @['tags']
+0009 gte
+0010 jump_false 0020
+0013 path       2  @['a']
+0016 const      0  null
+0019 ne
+`,
+	}
+	c := &Compiler{}
+	for cond, expected := range programs {
+		q, err := c.Compile("$[?" + cond + "]")
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", cond, err)
+		}
+		p, err := CompileFilter(q)
+		if err != nil {
+			t.Fatalf("CompileFilter(%q) = %v", cond, err)
+		}
+		if got := p.Disassemble(); got != expected[1:] {
+			t.Errorf("Disassemble(%q) =\n%s\nexpected\n%s", cond, got, expected[1:])
+		}
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	queries := map[string]string{
+		"$.a[?@.b]":                 BYTECODE_ERROR_FILTER,
+		"$[?@.b][0]":                BYTECODE_ERROR_FILTER,
+		"$[?@.b, ?@.c]":             BYTECODE_ERROR_FILTER,
+		"$[?@.*]":                   BYTECODE_ERROR_SUBSET,
+		"$[?@.a == $.b]":            BYTECODE_ERROR_SUBSET,
+		"$[?$.a]":                   BYTECODE_ERROR_SUBSET,
+		"$[?count(@.*) > 1]":        BYTECODE_ERROR_SUBSET,
+		"$[?@int(@.a)]":             BYTECODE_ERROR_TEST,
+		"$[?@int(@.a) == 1]":        BYTECODE_ERROR_SUBSET,
+		"$[?@.a[?@.b] && @.c]":      BYTECODE_ERROR_SUBSET,
+		"$[?@int(@.a == 1)]":        BYTECODE_ERROR_SUBSET,
+		"$[?@.a == 1 || @..b]":      BYTECODE_ERROR_SUBSET,
+		"$[?match(@.a, $.pattern)]": BYTECODE_ERROR_SUBSET,
+	}
+	c := &Compiler{}
+	for query, reason := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		_, err = CompileFilter(q)
+		if err == nil || !strings.HasSuffix(err.Error(), reason) {
+			t.Errorf("CompileFilter(%q) = %v; expected %q", query, err, reason)
+		}
+		var berr *BytecodeError
+		if reason != BYTECODE_ERROR_FILTER && !errors.As(err, &berr) {
+			t.Errorf("CompileFilter(%q) = %v; expected a BytecodeError", query, err)
+		}
+	}
+}
+
+func TestProgramEncoding(t *testing.T) {
+	c := &Compiler{}
+	q, err := c.Compile("$[?@.tags[-1] == 'b' && (length(@['title']) > 10 || @.price < -3 || @.isbn == null) && !search(@.author, 'W.*h') && @.x != true]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := CompileFilter(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "GJBC\x01") {
+		t.Fatalf("MarshalBinary() = %q; expected the header", data)
+	}
+	decoded := &Program{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() = %v", err)
+	}
+	if decoded.Disassemble() != p.Disassemble() {
+		t.Errorf("decoded program =\n%s\nexpected\n%s", decoded.Disassemble(), p.Disassemble())
+	}
+	record := D{{"title", "Sword of Honour"}, {"author", "Herman Melville"}, {"tags", A{"a", "b"}}}
+	if !decoded.Match(record) || decoded.Match(D{{"tags", A{"b", "a"}}}) {
+		t.Errorf("decoded program does not match as the compiled one")
+	}
+
+	for n := range len(data) {
+		if err := (&Program{}).UnmarshalBinary(data[:n]); err == nil {
+			t.Errorf("UnmarshalBinary(%q) succeeded on a truncated program", data[:n])
+		}
+	}
+	version := append([]byte("GJBC\x02"), data[5:]...)
+	if err := (&Program{}).UnmarshalBinary(version); err == nil || !strings.Contains(err.Error(), BYTECODE_ERROR_VERSION) {
+		t.Errorf("UnmarshalBinary() of version 2 = %v", err)
+	}
+	if err := (&Program{}).UnmarshalBinary([]byte("{}")); err == nil || !strings.Contains(err.Error(), BYTECODE_ERROR_HEADER) {
+		t.Errorf("UnmarshalBinary() of JSON = %v", err)
+	}
+	// Each program here decodes, but would not run to a test.
+	corrupt := map[string][]byte{
+		"empty":             {},
+		"value left":        {opConst, 0, 0},
+		"not of a value":    {opConst, 0, 0, opNot},
+		"underflow":         {opEq},
+		"constant index":    {opConst, 0, 9, opConst, 0, 0, opEq},
+		"backward jump":     {opExists, 0, 0, opJumpTrue, 0, 0},
+		"jump into operand": {opExists, 0, 0, opJumpTrue, 0, 5, opExists, 0, 0},
+		"unknown opcode":    {opExists, 0, 0, 0xee},
+		"jump over a value": {opExists, 0, 0, opJumpTrue, 0, 9, opConst, 0, 0},
+	}
+	for name, code := range corrupt {
+		p := &Program{consts: []any{1}, paths: [][]lookupStep{{{name: "a"}}}, code: code}
+		data, _ := p.MarshalBinary()
+		if err := (&Program{}).UnmarshalBinary(data); err == nil || !strings.Contains(err.Error(), BYTECODE_ERROR_CORRUPT) {
+			t.Errorf("UnmarshalBinary(%s) = %v", name, err)
+		}
+	}
+}
+
+func TestEvaluateWithBytecode(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(evalDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	c := &Compiler{}
+	for _, query := range closureQueries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		expected, err := EvaluateNodes(q, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := EvaluateNodes(q, doc, WithBytecode())
+		if err != nil || mustMarshal(got) != mustMarshal(expected) {
+			t.Errorf("EvaluateNodes(%q, WithBytecode()) = %s, %v; expected %s", query, mustMarshal(got), err, mustMarshal(expected))
+		}
+	}
+}
+
+// BenchmarkProgramMatch compares a filter run on the VM with its prepared
+// closures.
+func BenchmarkProgramMatch(b *testing.B) {
+	record := map[string]any{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "price": 8.99}
+	c := &Compiler{}
+	q, err := c.Compile("$[?@.price < 10 && @.category == 'fiction' || length(@.title) > 20]")
+	if err != nil {
+		b.Fatal(err)
+	}
+	p, err := CompileFilter(q)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("bytecode", func(b *testing.B) {
+		for b.Loop() {
+			if !p.Match(record) {
+				b.Fatal("no match")
+			}
+		}
+	})
+	prepared := Prepare(q)
+	b.Run("closures", func(b *testing.B) {
+		for b.Loop() {
+			if nodes, _ := prepared.Evaluate([]any{record}); len(nodes) != 1 {
+				b.Fatal("no match")
+			}
+		}
+	})
+}
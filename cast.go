@@ -0,0 +1,250 @@
+package gojimongo
+
+import (
+	"math"
+	"strconv"
+)
+
+// A cast, @int(...), @double(...), @str(...), @bool(...), @array(...) or
+// @object(...), means one of four things depending on where it appears:
+//
+//   - As a test, as in $[?@int(@.age)], it asserts the type of its value: the
+//     test holds when the value has the type.
+//   - As a comparison operand, as in $[?@int(@.age) > 30], it converts its
+//     value the way MongoDB's $convert does, so that numbers stored as
+//     strings compare as numbers. A value that cannot be converted, and null,
+//     convert to nothing, which only != matches. @array and @object do not
+//     convert: they keep arrays, respectively objects, and nothing else.
+//   - Around a logical expression, as in @int(count(@.a) >= 10), it is
+//     transparent.
+//   - As a selector, as in $.a[@str(5)], it converts its literal, which then
+//     selects a member when it is a string and an element when it is an int.
+
+// castKind is the type a cast names.
+type castKind int
+
+const (
+	castInt castKind = iota + 1
+	castDouble
+	castString
+	castBool
+	castArray
+	castObject
+)
+
+// castTypes are the BSON types of the values a cast asserts, as $type reads
+// them.
+var castTypes = map[castKind]any{
+	castInt:    A{"int", "long"},
+	castDouble: "number",
+	castString: "string",
+	castBool:   "bool",
+	castArray:  "array",
+	castObject: "object",
+}
+
+// castConversions are the targets of $convert.
+var castConversions = map[castKind]string{
+	castInt:    "long",
+	castDouble: "double",
+	castString: "string",
+	castBool:   "bool",
+}
+
+// castOf returns the type and the expression of a cast.
+func castOf(e Expr) (castKind, Expr, bool) {
+	switch e := e.(type) {
+	case *TypedIntExpr:
+		return castInt, e.value, true
+	case *TypedDecimalExpr:
+		return castDouble, e.value, true
+	case *TypedStringExpr:
+		return castString, e.value, true
+	case *TypedBoolExpr:
+		return castBool, e.value, true
+	case *TypedArrayExpr:
+		return castArray, e.value, true
+	case *TypedObjectExpr:
+		return castObject, e.value, true
+	}
+	return 0, nil, false
+}
+
+// assertion returns the cast e is when it is used as a type assertion,
+// looking through parentheses.
+func assertion(e Expr) (castKind, Expr, bool) {
+	for {
+		par, ok := e.(*ParExpr)
+		if !ok {
+			break
+		}
+		e = par.value
+	}
+	kind, value, ok := castOf(e)
+	return kind, value, ok && !isLogical(value)
+}
+
+// computed reports whether e is an operand computed from another value, a
+// call to a function returning a value or a conversion, which only
+// aggregation expressions can express.
+func computed(e Expr) bool {
+	if fn, ok := unwrapFn(e); ok {
+		return functions[fn.name].result == valueType
+	}
+	if par, ok := e.(*ParExpr); ok {
+		return computed(par.value)
+	}
+	_, value, ok := castOf(e)
+	return ok && !isLogical(value)
+}
+
+// literalValue returns the value of a literal expression.
+func literalValue(e Expr) (any, bool) {
+	switch e := e.(type) {
+	case *StringExpr:
+		return unquote(e.value), true
+	case *IntExpr:
+		return e.value, true
+	case *MinusExpr:
+		if i, ok := e.expr.(*IntExpr); ok {
+			return -i.value, true
+		}
+	case *TrueExpr:
+		return true, true
+	case *FalseExpr:
+		return false, true
+	case *NullExpr:
+		return nil, true
+	case *ParExpr:
+		return literalValue(e.value)
+	}
+	return nil, false
+}
+
+// evalIsType reports whether value has the type kind asserts. Numbers decoded
+// by encoding/json are all float64, so a number without a fraction is an int.
+func evalIsType(kind castKind, value any) bool {
+	switch kind {
+	case castInt:
+		f, ok := evalNumber(value)
+		return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+	case castDouble:
+		_, ok := evalNumber(value)
+		return ok
+	case castString:
+		_, ok := value.(string)
+		return ok
+	case castBool:
+		_, ok := value.(bool)
+		return ok
+	case castArray:
+		_, ok := evalElements(value)
+		return ok
+	case castObject:
+		_, ok := evalMembers(value)
+		return ok
+	}
+	return false
+}
+
+// evalCast converts value as $convert does, returning evalNothing when it
+// cannot be converted.
+func evalCast(kind castKind, value any) any {
+	if value == nil {
+		return evalNothing{}
+	}
+	if _, ok := value.(evalNothing); ok {
+		return value
+	}
+	switch kind {
+	case castInt:
+		switch v := value.(type) {
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return int(n)
+			}
+		case bool:
+			return boolInt(v)
+		default:
+			if f, ok := evalNumber(v); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+				return int(math.Trunc(f))
+			}
+		}
+	case castDouble:
+		switch v := value.(type) {
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		case bool:
+			return float64(boolInt(v))
+		default:
+			if f, ok := evalNumber(v); ok {
+				return f
+			}
+		}
+	case castString:
+		switch v := value.(type) {
+		case string:
+			return v
+		case bool:
+			return strconv.FormatBool(v)
+		default:
+			if f, ok := evalNumber(v); ok {
+				return strconv.FormatFloat(f, 'g', -1, 64)
+			}
+		}
+	case castBool:
+		if b, ok := value.(bool); ok {
+			return b
+		}
+		if f, ok := evalNumber(value); ok {
+			return f != 0
+		}
+		return true
+	case castArray:
+		if _, ok := evalElements(value); ok {
+			return value
+		}
+	case castObject:
+		if _, ok := evalMembers(value); ok {
+			return value
+		}
+	}
+	return evalNothing{}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// aggAssertion tests that x has the type kind asserts.
+func aggAssertion(kind castKind, x any) any {
+	switch kind {
+	case castDouble:
+		return D{{"$isNumber", x}}
+	case castInt:
+		return D{{"$in", A{D{{"$type", x}}, castTypes[kind]}}}
+	}
+	return aggIsType(x, castTypes[kind].(string))
+}
+
+// aggCast converts x with $convert; a value that cannot be converted, and
+// null, become missing.
+func aggCast(kind castKind, x any) any {
+	switch kind {
+	case castArray:
+		return D{{"$cond", A{D{{"$isArray", x}}, x, "$$REMOVE"}}}
+	case castObject:
+		return D{{"$cond", A{aggIsType(x, "object"), x, "$$REMOVE"}}}
+	}
+	return D{{"$convert", D{
+		{"input", x},
+		{"to", castConversions[kind]},
+		{"onError", "$$REMOVE"},
+		{"onNull", "$$REMOVE"},
+	}}}
+}
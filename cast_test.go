@@ -0,0 +1,95 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const castDocument = `{
+	"items": [
+		{"sku": "a", "qty": 12, "price": "9.5", "tags": ["x"]},
+		{"sku": "b", "qty": "30", "price": 20, "tags": "x"},
+		{"sku": "c", "qty": "n/a", "price": null, "tags": {"x": 1}},
+		{"sku": "d", "qty": 7.9, "price": true}
+	]
+}`
+
+func TestEvaluateCasts(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(castDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string]string{
+		"$.items[?@int(@.qty)].sku":                 `["a"]`,
+		"$.items[?@double(@.qty)].sku":              `["a","d"]`,
+		"$.items[?@str(@.qty)].sku":                 `["b","c"]`,
+		"$.items[?@array(@.tags)].sku":              `["a"]`,
+		"$.items[?@object(@.tags)].sku":             `["c"]`,
+		"$.items[?!@bool(@.price)].sku":             `["a","b","c"]`,
+		"$.items[?@int(@.qty) > 10].sku":            `["a","b"]`,
+		"$.items[?@int(@.qty) == 7].sku":            `["d"]`,
+		"$.items[?@double(@.price) < 10].sku":       `["a","d"]`,
+		"$.items[?@double(@.price) == null].sku":    `[]`,
+		"$.items[?@str(@.qty) == '12'].sku":         `["a"]`,
+		"$.items[?@bool(@.sku) == true].sku":        `["a","b","c","d"]`,
+		"$.items[?@array(@.tags) != null].sku":      `["a","b","c","d"]`,
+		"$.items[?length(@array(@.tags)) == 1].sku": `["a"]`,
+		"$.items[@int('1')].sku":                    `["b"]`,
+		"$.items[0][@str(0)]":                       `[]`,
+		"$.items[?@int(count(@.tags) >= 1)].sku":    `["a","b","c"]`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		nodes, err := Evaluate(q, doc)
+		if err != nil {
+			t.Errorf("Evaluate(%q) = %v", query, err)
+			continue
+		}
+		b, _ := json.Marshal(nodes)
+		if string(b) != expected {
+			t.Errorf("Evaluate(%q) = %s; expected %s", query, b, expected)
+		}
+	}
+}
+
+func TestMongoFilterCasts(t *testing.T) {
+	queries := map[string][]string{
+		"$.items[?@int(@.qty)]":              {`{"items.qty":{"$type":["int","long"]}}`},
+		"$.items[?@double(@.qty)]":           {`{"items.qty":{"$type":"number"}}`},
+		"$.items[?@object(@.tags)]":          {`{"items.tags":{"$type":"object"}}`},
+		"$.items[?@str(@.sku) && @.qty > 1]": {`{"items":{"$elemMatch":{"sku":{"$type":"string"},"qty":{"$gt":1}}}}`},
+		"$[?@int(@.qty) > 10]": {
+			`{"$convert":{"input":"$$n3","to":"long","onError":"$$REMOVE","onNull":"$$REMOVE"}}`,
+			`{"$gt":["$$n4",10]}`,
+		},
+		"$.items[?@double(@.price) < 10]": {
+			`{"$and":[{"items":{"$exists":true}},{"$expr":`,
+			`"to":"double"`,
+		},
+		"$[?@array(@.tags) == @.other]": {`{"$cond":[{"$isArray":"$$n3"},"$$n3","$$REMOVE"]}`},
+		"$[?@int(length(@.name))]":      {`{"$expr":`, `{"$in":[{"$type":`, `["int","long"]`},
+		"$.items[@int('1')]":            {`{"items.1":{"$exists":true}}`},
+	}
+	c := &Compiler{}
+	for query, fragments := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		filter, err := MongoFilter(q, WithArrayTraversal())
+		if err != nil {
+			t.Errorf("MongoFilter(%q) = %v", query, err)
+			continue
+		}
+		for _, fragment := range fragments {
+			if !strings.Contains(filter.String(), fragment) {
+				t.Errorf("MongoFilter(%q) = %s does not contain %s", query, filter, fragment)
+			}
+		}
+	}
+}
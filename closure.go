@@ -0,0 +1,831 @@
+package gojimongo
+
+import (
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// PreparedQuery is a query compiled a second time, into a tree of Go
+// closures. Selectors are resolved, literals converted and comparisons
+// specialized for the type of their literal operand once, when the query is
+// prepared, rather than on each evaluation as VisitorEval does walking the
+// AST. Singular queries in filters fetch their node directly, and the nodes
+// filters test carry no Normalized Path.
+//
+// Evaluate and EvaluateNodes prepare the queries they are given on first use
+// and keep the prepared form with the query. A prepared query selects the
+// nodes VisitorEval selects, in the same order, and fails where it fails. It
+// is safe for concurrent use.
+type PreparedQuery struct {
+	query Query
+	run   closureNodes
+}
+
+// preparedCache holds the prepared forms of a query, with and without
+// bytecode.
+type preparedCache struct {
+	p, vm atomic.Pointer[PreparedQuery]
+}
+
+// closureEnv is the state of one evaluation of a prepared query.
+type closureEnv struct {
+	root    any  // the node '$' refers to
+	current Node // the node '@' refers to
+	err     error
+}
+
+type (
+	closureNodes  func(env *closureEnv) []Node
+	closureSelect func(env *closureEnv, n Node, out []Node) []Node
+	closureTest   func(env *closureEnv) bool
+	closureValue  func(env *closureEnv) any
+)
+
+func (env *closureEnv) fail(node any, reason string) {
+	if env.err == nil {
+		env.err = evalError(nodeName(node) + ": " + reason)
+	}
+}
+
+func (env *closureEnv) merge(err error) {
+	if env.err == nil {
+		env.err = err
+	}
+}
+
+// prepareMode says how a query is prepared.
+type prepareMode struct {
+	paths    bool // selected nodes carry their Normalized Path
+	bytecode bool // filters of the bytecode subset run on the VM
+}
+
+// Prepare compiles q into closures. With WithBytecode, the conditions of its
+// filters that the bytecode covers are compiled to programs run by the VM,
+// see Program.
+func Prepare(q Query, opts ...EvalOption) *PreparedQuery {
+	mode := prepareMode{paths: true, bytecode: newEvalConfig(opts).bytecode}
+	switch query := q.(type) {
+	case *AbsQuery:
+		return &PreparedQuery{q, prepareQuery(query.segments, true, mode)}
+	case *RelQuery:
+		return &PreparedQuery{q, prepareQuery(query.segments, false, mode)}
+	}
+	return &PreparedQuery{q, func(env *closureEnv) []Node {
+		v := &VisitorEval{root: env.root, current: env.current}
+		q.accept(v)
+		env.merge(v.err)
+		nodes, _ := v.result.(evalNodes)
+		return nodes
+	}}
+}
+
+// prepared returns q prepared as opts require, preparing it on first use.
+func prepared(q Query, opts []EvalOption) *PreparedQuery {
+	var cache *preparedCache
+	switch q := q.(type) {
+	case *AbsQuery:
+		cache = &q.prepared
+	case *RelQuery:
+		cache = &q.prepared
+	default:
+		return Prepare(q, opts...)
+	}
+	slot := &cache.p
+	if newEvalConfig(opts).bytecode {
+		slot = &cache.vm
+	}
+	p := slot.Load()
+	if p == nil {
+		p = Prepare(q, opts...)
+		slot.Store(p)
+	}
+	return p
+}
+
+// Query returns the query p was prepared from.
+func (p *PreparedQuery) Query() Query {
+	return p.query
+}
+
+// Evaluate returns the nodes p selects from doc.
+func (p *PreparedQuery) Evaluate(doc any, opts ...EvalOption) ([]any, error) {
+	nodes, err := p.evaluate(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(nodes))
+	for i, n := range nodes {
+		values[i] = unreflect(n.Value)
+	}
+	return values, nil
+}
+
+// EvaluateNodes returns the nodes p selects from doc along with their
+// Normalized Paths, in document order.
+func (p *PreparedQuery) EvaluateNodes(doc any, opts ...EvalOption) ([]Node, error) {
+	nodes, err := p.evaluate(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Node, len(nodes))
+	for i, n := range nodes {
+		result[i] = Node{n.Path, unreflect(n.Value)}
+	}
+	return result, nil
+}
+
+func (p *PreparedQuery) evaluate(doc any, opts []EvalOption) ([]Node, error) {
+	root := evalRoot(doc, opts)
+	env := &closureEnv{root: root, current: Node{Value: root}}
+	nodes := p.run(env)
+	if env.err != nil {
+		return nil, env.err
+	}
+	return nodes, nil
+}
+
+// prepareQuery compiles the segments of a query, starting from the root when
+// absolute and from the current node otherwise.
+func prepareQuery(segs []Segment, absolute bool, mode prepareMode) closureNodes {
+	steps := make([]closureSelect, len(segs))
+	for i, seg := range segs {
+		steps[i] = prepareSegment(seg, mode)
+	}
+	return func(env *closureEnv) []Node {
+		start := env.current
+		if absolute {
+			start = Node{Value: env.root}
+		}
+		nodes, out := []Node{start}, []Node(nil)
+		for _, step := range steps {
+			out = out[:0]
+			for _, n := range nodes {
+				out = step(env, n, out)
+			}
+			if env.err != nil {
+				return nil
+			}
+			nodes, out = out, nodes
+		}
+		return nodes
+	}
+}
+
+func prepareSegment(seg Segment, mode prepareMode) closureSelect {
+	switch s := seg.(type) {
+	case *DotChildSegment:
+		return prepareSelector(s.selector, mode)
+	case *ChildSegment:
+		return prepareSelectors(s.selectors, mode)
+	case *DescendantSegment:
+		sel := prepareSelectors(s.selectors, mode)
+		var descend closureSelect
+		descend = func(env *closureEnv, n Node, out []Node) []Node {
+			out = sel(env, n, out)
+			for _, child := range closureChildren(n, mode.paths, nil) {
+				out = descend(env, child, out)
+			}
+			return out
+		}
+		return descend
+	}
+	return func(env *closureEnv, n Node, out []Node) []Node {
+		v := &VisitorEval{root: env.root, current: env.current, node: n, output: out}
+		seg.accept(v)
+		env.merge(v.err)
+		return v.output
+	}
+}
+
+func prepareSelectors(sels []Selector, mode prepareMode) closureSelect {
+	if len(sels) == 1 {
+		return prepareSelector(sels[0], mode)
+	}
+	steps := make([]closureSelect, len(sels))
+	for i, sel := range sels {
+		steps[i] = prepareSelector(sel, mode)
+	}
+	return func(env *closureEnv, n Node, out []Node) []Node {
+		for _, step := range steps {
+			out = step(env, n, out)
+		}
+		return out
+	}
+}
+
+func prepareSelector(sel Selector, mode prepareMode) closureSelect {
+	paths := mode.paths
+	switch s := sel.(type) {
+	case *NameSelector:
+		return prepareMember(s.value, paths)
+	case *StringExpr:
+		return prepareMember(unquote(s.value), paths)
+	case *IntExpr:
+		return prepareIndex(s.value, paths)
+	case *MinusExpr:
+		if i, ok := s.expr.(*IntExpr); ok {
+			return prepareIndex(-i.value, paths)
+		}
+	case *PointerSelector:
+		index, member := prepareIndex(s.index, paths), prepareMember(strconv.Itoa(s.index), paths)
+		return func(env *closureEnv, n Node, out []Node) []Node {
+			return member(env, n, index(env, n, out))
+		}
+	case *WildCardSelector:
+		return func(env *closureEnv, n Node, out []Node) []Node {
+			return closureChildren(n, paths, out)
+		}
+	case *SliceSelector:
+		start, ok1 := sliceBound(s.start)
+		stop, ok2 := sliceBound(s.stop)
+		step, ok3 := sliceBound(s.step)
+		if !ok1 || !ok2 || !ok3 {
+			break
+		}
+		return func(env *closureEnv, n Node, out []Node) []Node {
+			elements, ok := closureElements(n.Value)
+			if !ok {
+				return out
+			}
+			for _, i := range evalSlice(len(elements), start, stop, step) {
+				out = append(out, closureChild(n, i, elements[i], paths))
+			}
+			return out
+		}
+	case *FilterSelector:
+		return prepareFilter(s, mode)
+	}
+	if kind, value, ok := castOf(sel); ok && !isLogical(value) {
+		if literal, ok := literalValue(value); ok {
+			switch key := evalCast(kind, literal).(type) {
+			case string:
+				return prepareMember(key, paths)
+			case int:
+				return prepareIndex(key, paths)
+			}
+		}
+	}
+	return func(env *closureEnv, n Node, out []Node) []Node {
+		v := &VisitorEval{root: env.root, current: env.current, node: n, output: out}
+		v.selectors([]Selector{sel})
+		env.merge(v.err)
+		return v.output
+	}
+}
+
+func prepareMember(name string, paths bool) closureSelect {
+	return func(env *closureEnv, n Node, out []Node) []Node {
+		if member, ok := closureMember(n.Value, name); ok {
+			out = append(out, closureChild(n, name, member, paths))
+		}
+		return out
+	}
+}
+
+func prepareIndex(i int, paths bool) closureSelect {
+	return func(env *closureEnv, n Node, out []Node) []Node {
+		elements, ok := closureElements(n.Value)
+		if !ok {
+			return out
+		}
+		j := i
+		if j < 0 {
+			j += len(elements)
+		}
+		if j >= 0 && j < len(elements) {
+			out = append(out, closureChild(n, j, elements[j], paths))
+		}
+		return out
+	}
+}
+
+// prepareFilter compiles a filter. The current node the condition tests is
+// set in env, as VisitorEval sets it, for the queries of the condition.
+// Conditions of the bytecode subset run on the VM in bytecode mode.
+func prepareFilter(s *FilterSelector, mode prepareMode) closureSelect {
+	if mode.bytecode {
+		if p, err := compileCondition(s.cond); err == nil {
+			return func(env *closureEnv, n Node, out []Node) []Node {
+				for _, child := range closureChildren(n, mode.paths, nil) {
+					if p.run(child.Value) {
+						out = append(out, child)
+					}
+				}
+				return out
+			}
+		}
+	}
+	cond := prepareTest(s.cond)
+	return func(env *closureEnv, n Node, out []Node) []Node {
+		current := env.current
+		for _, child := range closureChildren(n, mode.paths, nil) {
+			env.current = child
+			if cond(env) && env.err == nil {
+				out = append(out, child)
+			}
+		}
+		env.current = current
+		return out
+	}
+}
+
+// prepareTest compiles an expression used as a test, as VisitorEval.test
+// evaluates it.
+func prepareTest(e Expr) closureTest {
+	if kind, value, ok := assertion(e); ok {
+		operand := prepareOperand(value)
+		return func(env *closureEnv) bool {
+			return evalIsType(kind, operand(env))
+		}
+	}
+	switch x := closureUnwrap(e).(type) {
+	case *NotExpr:
+		test := prepareTest(x.expr)
+		return func(env *closureEnv) bool { return !test(env) }
+	case *AndExpr:
+		lhs, rhs := prepareTest(x.lhs), prepareTest(x.rhs)
+		return func(env *closureEnv) bool { return lhs(env) && rhs(env) }
+	case *OrExpr:
+		lhs, rhs := prepareTest(x.lhs), prepareTest(x.rhs)
+		return func(env *closureEnv) bool { return lhs(env) || rhs(env) }
+	case *EqeqExpr:
+		return prepareComparison(compareEq, x.lhs, x.rhs)
+	case *NeqExpr:
+		return prepareComparison(compareNe, x.lhs, x.rhs)
+	case *LtExpr:
+		return prepareComparison(compareLt, x.lhs, x.rhs)
+	case *LteExpr:
+		return prepareComparison(compareLte, x.lhs, x.rhs)
+	case *GtExpr:
+		return prepareComparison(compareGt, x.lhs, x.rhs)
+	case *GteExpr:
+		return prepareComparison(compareGte, x.lhs, x.rhs)
+	case *AbsQuery:
+		return prepareExists(x.segments, true)
+	case *RelQuery:
+		return prepareExists(x.segments, false)
+	case *FnExpr:
+		if (x.name == "match" || x.name == "search") && len(x.params) == 2 {
+			return prepareRegex(x)
+		}
+		if functions[x.name].result == logicalType {
+			return closureVisitTest(e)
+		}
+	}
+	if _, value, ok := castOf(closureUnwrap(e)); ok && isLogical(value) {
+		return prepareTest(value)
+	}
+	operand := prepareOperand(e)
+	return func(env *closureEnv) bool {
+		operand(env)
+		env.fail(e, EVAL_ERROR_NOT_A_TEST)
+		return false
+	}
+}
+
+// prepareOperand compiles a comparison operand, as VisitorEval.operand
+// evaluates it: to a value, or evalNothing.
+func prepareOperand(e Expr) closureValue {
+	if c, ok := prepareConstant(e); ok {
+		return func(*closureEnv) any { return c }
+	}
+	if isLogical(e) {
+		test := prepareTest(e)
+		return func(env *closureEnv) any {
+			test(env)
+			env.fail(e, EVAL_ERROR_NOT_AN_OPERAND)
+			return nil
+		}
+	}
+	switch x := closureUnwrap(e).(type) {
+	case *AbsQuery:
+		return prepareSingle(x.segments, true)
+	case *RelQuery:
+		return prepareSingle(x.segments, false)
+	case *FnExpr:
+		switch {
+		case x.name == "length" && len(x.params) == 1:
+			return prepareLength(x.params[0])
+		case x.name == "count" && len(x.params) == 1:
+			if q, ok := closureUnwrap(x.params[0]).(*RelQuery); ok {
+				return prepareCount(q.segments, false)
+			}
+			if q, ok := closureUnwrap(x.params[0]).(*AbsQuery); ok {
+				return prepareCount(q.segments, true)
+			}
+		}
+	}
+	if kind, value, ok := castOf(closureUnwrap(e)); ok {
+		operand := prepareOperand(value)
+		return func(env *closureEnv) any {
+			o := operand(env)
+			if env.err != nil {
+				return nil
+			}
+			return evalCast(kind, o)
+		}
+	}
+	return func(env *closureEnv) any {
+		v := &VisitorEval{root: env.root, current: env.current}
+		o := v.operand(e)
+		env.merge(v.err)
+		return o
+	}
+}
+
+// prepareConstant returns the value of an operand that does not depend on the
+// document: a literal, or a cast of one.
+func prepareConstant(e Expr) (any, bool) {
+	if value, ok := literalValue(e); ok {
+		return value, true
+	}
+	if kind, value, ok := castOf(closureUnwrap(e)); ok && !isLogical(value) {
+		if c, ok := prepareConstant(value); ok {
+			return evalCast(kind, c), true
+		}
+	}
+	return nil, false
+}
+
+// lookupStep is a member name or an element index of a singular query. A
+// step of either kind selects the element of an array by index and the
+// member of an object by name.
+type lookupStep struct {
+	name    string
+	index   int
+	byIndex bool
+	either  bool
+}
+
+// lookupSteps returns the steps of a singular query.
+func lookupSteps(segs []Segment) ([]lookupStep, bool) {
+	steps := make([]lookupStep, len(segs))
+	for i, seg := range segs {
+		sel, ok := singularSelector(seg)
+		if !ok {
+			return nil, false
+		}
+		switch s := sel.(type) {
+		case *NameSelector:
+			steps[i] = lookupStep{name: s.value}
+		case *StringExpr:
+			steps[i] = lookupStep{name: unquote(s.value)}
+		case *IntExpr:
+			steps[i] = lookupStep{index: s.value, byIndex: true}
+		case *MinusExpr:
+			steps[i] = lookupStep{index: -s.expr.(*IntExpr).value, byIndex: true}
+		case *PointerSelector:
+			steps[i] = lookupStep{name: strconv.Itoa(s.index), index: s.index, either: true}
+		}
+	}
+	return steps, true
+}
+
+// lookup returns the node steps lead to from value.
+func lookup(value any, steps []lookupStep) (any, bool) {
+	for _, step := range steps {
+		if !step.byIndex {
+			member, ok := closureMember(value, step.name)
+			if ok {
+				value = member
+				continue
+			}
+			if !step.either {
+				return nil, false
+			}
+		}
+		elements, ok := closureElements(value)
+		if !ok {
+			return nil, false
+		}
+		i := step.index
+		if i < 0 {
+			i += len(elements)
+		}
+		if i < 0 || i >= len(elements) {
+			return nil, false
+		}
+		value = elements[i]
+	}
+	return value, true
+}
+
+// prepareSingle compiles a query used as an operand, which has a value when
+// it selects exactly one node.
+func prepareSingle(segs []Segment, absolute bool) closureValue {
+	if steps, ok := lookupSteps(segs); ok {
+		return func(env *closureEnv) any {
+			start := env.current.Value
+			if absolute {
+				start = env.root
+			}
+			if value, ok := lookup(start, steps); ok {
+				return value
+			}
+			return evalNothing{}
+		}
+	}
+	query := prepareQuery(segs, absolute, prepareMode{})
+	return func(env *closureEnv) any {
+		nodes := query(env)
+		if len(nodes) != 1 {
+			return evalNothing{}
+		}
+		return nodes[0].Value
+	}
+}
+
+// prepareExists compiles a query used as a test, which holds when it selects
+// a node.
+func prepareExists(segs []Segment, absolute bool) closureTest {
+	if steps, ok := lookupSteps(segs); ok {
+		return func(env *closureEnv) bool {
+			start := env.current.Value
+			if absolute {
+				start = env.root
+			}
+			_, ok := lookup(start, steps)
+			return ok
+		}
+	}
+	query := prepareQuery(segs, absolute, prepareMode{})
+	return func(env *closureEnv) bool {
+		return len(query(env)) > 0
+	}
+}
+
+func prepareLength(param Expr) closureValue {
+	operand := prepareOperand(param)
+	return func(env *closureEnv) any {
+		value := operand(env)
+		if env.err != nil {
+			return nil
+		}
+		switch v := value.(type) {
+		case string:
+			return utf8.RuneCountInString(v)
+		case map[string]any:
+			return len(v)
+		case D:
+			return len(v)
+		}
+		if elements, ok := closureElements(value); ok {
+			return len(elements)
+		}
+		if members, ok := evalMembers(value); ok {
+			return len(members)
+		}
+		return evalNothing{}
+	}
+}
+
+func prepareCount(segs []Segment, absolute bool) closureValue {
+	query := prepareQuery(segs, absolute, prepareMode{})
+	return func(env *closureEnv) any {
+		nodes := query(env)
+		if env.err != nil {
+			return nil
+		}
+		return len(nodes)
+	}
+}
+
+// prepareRegex compiles match() and search(), compiling a literal pattern
+// once.
+func prepareRegex(fn *FnExpr) closureTest {
+	input := prepareOperand(fn.params[0])
+	anchored := fn.name == "match"
+	if pattern, ok := prepareConstant(fn.params[1]); ok {
+		p, isString := pattern.(string)
+		re := compileIRegexp(p, anchored)
+		return func(env *closureEnv) bool {
+			s, ok := input(env).(string)
+			return ok && isString && re != nil && re.MatchString(s)
+		}
+	}
+	pattern := prepareOperand(fn.params[1])
+	return func(env *closureEnv) bool {
+		i, p := input(env), pattern(env)
+		if env.err != nil {
+			return false
+		}
+		s, ok := i.(string)
+		pat, isString := p.(string)
+		if !ok || !isString {
+			return false
+		}
+		re := compileIRegexp(pat, anchored)
+		return re != nil && re.MatchString(s)
+	}
+}
+
+// compareOp is a comparison operator.
+type compareOp int
+
+const (
+	compareEq compareOp = iota
+	compareNe
+	compareLt
+	compareLte
+	compareGt
+	compareGte
+)
+
+// flip returns the operator comparing the operands the other way round.
+func (op compareOp) flip() compareOp {
+	switch op {
+	case compareLt:
+		return compareGt
+	case compareLte:
+		return compareGte
+	case compareGt:
+		return compareLt
+	case compareGte:
+		return compareLte
+	}
+	return op
+}
+
+// evalCompare compares two operands as VisitorEval does.
+func evalCompare(op compareOp, l, r any) bool {
+	switch op {
+	case compareEq:
+		return evalEqual(l, r)
+	case compareNe:
+		return !evalEqual(l, r)
+	case compareLt:
+		return evalLess(l, r)
+	case compareLte:
+		return evalLess(l, r) || evalEqual(l, r)
+	case compareGt:
+		return evalLess(r, l)
+	}
+	return evalLess(r, l) || evalEqual(l, r)
+}
+
+// prepareComparison compiles a comparison. When one operand is a constant,
+// the comparison is specialized for its type.
+func prepareComparison(op compareOp, lhs, rhs Expr) closureTest {
+	lc, lconst := prepareConstant(lhs)
+	rc, rconst := prepareConstant(rhs)
+	switch {
+	case lconst && rconst:
+		result := evalCompare(op, lc, rc)
+		return func(*closureEnv) bool { return result }
+	case rconst:
+		operand, compare := prepareOperand(lhs), compareTo(op, rc)
+		return func(env *closureEnv) bool { return compare(operand(env)) }
+	case lconst:
+		operand, compare := prepareOperand(rhs), compareTo(op.flip(), lc)
+		return func(env *closureEnv) bool { return compare(operand(env)) }
+	}
+	l, r := prepareOperand(lhs), prepareOperand(rhs)
+	return func(env *closureEnv) bool {
+		return evalCompare(op, l(env), r(env))
+	}
+}
+
+// compareTo returns the function comparing an operand to the constant c,
+// with the rules of evalEqual and evalLess narrowed to the type of c.
+func compareTo(op compareOp, c any) func(x any) bool {
+	if f, ok := evalNumber(c); ok {
+		switch op {
+		case compareEq:
+			return func(x any) bool { n, ok := evalNumber(x); return ok && n == f }
+		case compareNe:
+			return func(x any) bool { n, ok := evalNumber(x); return !ok || n != f }
+		case compareLt:
+			return func(x any) bool { n, ok := evalNumber(x); return ok && n < f }
+		case compareLte:
+			return func(x any) bool { n, ok := evalNumber(x); return ok && n <= f }
+		case compareGt:
+			return func(x any) bool { n, ok := evalNumber(x); return ok && n > f }
+		case compareGte:
+			return func(x any) bool { n, ok := evalNumber(x); return ok && n >= f }
+		}
+	}
+	switch c := c.(type) {
+	case string:
+		switch op {
+		case compareEq:
+			return func(x any) bool { s, ok := x.(string); return ok && s == c }
+		case compareNe:
+			return func(x any) bool { s, ok := x.(string); return !ok || s != c }
+		case compareLt:
+			return func(x any) bool { s, ok := x.(string); return ok && s < c }
+		case compareLte:
+			return func(x any) bool { s, ok := x.(string); return ok && s <= c }
+		case compareGt:
+			return func(x any) bool { s, ok := x.(string); return ok && s > c }
+		case compareGte:
+			return func(x any) bool { s, ok := x.(string); return ok && s >= c }
+		}
+	case bool:
+		switch op {
+		case compareEq, compareLte, compareGte:
+			return func(x any) bool { b, ok := x.(bool); return ok && b == c }
+		case compareNe:
+			return func(x any) bool { b, ok := x.(bool); return !ok || b != c }
+		}
+		return func(any) bool { return false }
+	case nil:
+		switch op {
+		case compareEq, compareLte, compareGte:
+			return func(x any) bool { return x == nil }
+		case compareNe:
+			return func(x any) bool { return x != nil }
+		}
+		return func(any) bool { return false }
+	}
+	return func(x any) bool { return evalCompare(op, x, c) }
+}
+
+// closureVisitTest evaluates a test with VisitorEval, for the expressions
+// prepareTest leaves to it.
+func closureVisitTest(e Expr) closureTest {
+	return func(env *closureEnv) bool {
+		v := &VisitorEval{root: env.root, current: env.current}
+		ok := v.test(e)
+		env.merge(v.err)
+		return ok
+	}
+}
+
+// closureUnwrap looks through parentheses.
+func closureUnwrap(e Expr) Expr {
+	for {
+		par, ok := e.(*ParExpr)
+		if !ok {
+			return e
+		}
+		e = par.value
+	}
+}
+
+// closureMember returns the member of an object named name.
+func closureMember(value any, name string) (any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		member, ok := v[name]
+		return member, ok
+	case D:
+		return v.Get(name)
+	}
+	return evalMember(value, name)
+}
+
+// closureElements returns the elements of an array, without copying the
+// arrays of encoding/json.
+func closureElements(value any) ([]any, bool) {
+	switch v := value.(type) {
+	case []any:
+		return v, true
+	case A:
+		return v, true
+	}
+	return evalElements(value)
+}
+
+// closureChild returns the child of n at key, with its path when paths is
+// set.
+func closureChild(n Node, key, value any, paths bool) Node {
+	if !paths {
+		return Node{Value: value}
+	}
+	return Node{n.Path.child(key), value}
+}
+
+// closureChildren appends the children of n to out in document order, as
+// evalChildren returns them.
+func closureChildren(n Node, paths bool, out []Node) []Node {
+	switch v := n.Value.(type) {
+	case []any:
+		for i, e := range v {
+			out = append(out, closureChild(n, i, e, paths))
+		}
+		return out
+	case A:
+		for i, e := range v {
+			out = append(out, closureChild(n, i, e, paths))
+		}
+		return out
+	case D:
+		for _, e := range v {
+			out = append(out, closureChild(n, e.Key, e.Value, paths))
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out = append(out, closureChild(n, k, v[k], paths))
+		}
+		return out
+	}
+	return append(out, evalChildren(n)...)
+}
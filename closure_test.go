@@ -0,0 +1,180 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// closureQueries are evaluated both prepared and by VisitorEval.
+var closureQueries = []string{
+	"$",
+	"$.store.book[*].author",
+	"$..author",
+	"$.store..price",
+	"$..*",
+	"$..book[-1].title",
+	"$..book[0,1,-9].title",
+	"$..book[1:3]",
+	"$..book[::-2].title",
+	"$.store['bicycle']['color','price']",
+	"$.store.*[@str(0)]",
+	"$..book[?@.isbn].title",
+	"$..book[?!@.isbn].title",
+	"$..book[?@.price < 10].title",
+	"$..book[?10 > @.price].title",
+	"$..book[?@.price <= 9].title",
+	"$..book[?9 <= @.price].title",
+	"$..book[?@.price >= $.expensive].title",
+	"$..book[?@.price != 12].price",
+	"$..book[?@.category == 'fiction' && @.price > 10].title",
+	"$..book[?@.category != 'fiction' || @.isbn].title",
+	"$..book[?@.author > 'J'].author",
+	"$..book[?'J' >= @.author].author",
+	"$..book[?@.missing == null].title",
+	"$..book[?@.missing != true].title",
+	"$..book[?@.missing == @.other].price",
+	"$..book[?1 == 1].price",
+	"$..book[?1 == '1'].price",
+	"$[?@.price < 10]",
+	"$.store.book[?@ == $.store.book[0]].title",
+	"$.store.book[?@.tags[-1] == 'b'].title",
+	"$.store.book[1,'1'].title",
+	"$..book[?match(@.author, '.*Rees')].title",
+	"$..book[?search(@.title, 'of ')].price",
+	"$..book[?search(@.title, @.category)].price",
+	"$..book[?search(@.price, '9')].title",
+	"$..book[?length(@.title) > 15].title",
+	"$..book[?length(@.tags) == 2].title",
+	"$..book[?count(@.*) == 5].title",
+	"$..book[?count(@..*) > 6].title",
+	"$.store[?length(@) == 4][0].title",
+	"$.store[?@int(count(@.color) >= 1)].price",
+	"$..book[?@int(@.price)].title",
+	"$..book[?@int(@.price) == 8].title",
+	"$..book[?@str(@.price) == '8.95'].title",
+	"$..book[?@int('12') < @.price].title",
+	"$..book[?@.price == @double(@.isbn)].title",
+	"$..book[?@array(@.tags)].title",
+	"$..book[?@.*[?@ == 'a']].title",
+	"$..[?@.color]",
+}
+
+func TestPreparedQuery(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`{
+		"store": {
+			"book": [
+				{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+				{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99, "tags": ["a", "b"]},
+				{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+				{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99, "tags": ["a"]}
+			],
+			"bicycle": {"color": "red", "price": 399}
+		},
+		"expensive": 10
+	}`))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	ordered := D{{"b", 1}, {"a", A{D{{"x", 2}}, D{{"x", 3}, {"y", "a"}}}}}
+	c := &Compiler{}
+	for _, query := range closureQueries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		for _, d := range []any{doc, ordered, NewJSONTree(doc)} {
+			checkPrepared(t, query, q, d)
+		}
+	}
+}
+
+// TestPreparedQueryErrors evaluates ASTs the checker rejects, which fail on
+// evaluation once reached.
+func TestPreparedQueryErrors(t *testing.T) {
+	filter := func(cond Expr) *AbsQuery {
+		return &AbsQuery{segments: []Segment{&ChildSegment{selectors: []Selector{&FilterSelector{cond: cond}}}}}
+	}
+	rel := &RelQuery{segments: []Segment{&DotChildSegment{selector: &NameSelector{value: "a"}}}}
+	queries := map[string]Query{
+		"literal test":        filter(&IntExpr{value: 1}),
+		"value function test": filter(&FnExpr{name: "length", params: []Expr{rel}}),
+		"unknown function":    filter(&FnExpr{name: "foo", params: []Expr{rel}}),
+		"logical operand":     filter(&EqeqExpr{lhs: &NotExpr{expr: rel}, rhs: &TrueExpr{}}),
+		"count of a value":    filter(&GtExpr{lhs: &FnExpr{name: "count", params: []Expr{&IntExpr{value: 1}}}, rhs: &IntExpr{value: 0}}),
+		"match arguments":     filter(&FnExpr{name: "match", params: []Expr{rel}}),
+		"name operand":        filter(&EqeqExpr{lhs: &NameSelector{value: "a"}, rhs: &IntExpr{value: 1}}),
+		"bool selector":       filter(&RelQuery{segments: []Segment{&ChildSegment{selectors: []Selector{&TrueExpr{}}}}}),
+		"logical cast":        filter(&TypedIntExpr{value: &EqeqExpr{lhs: &FnExpr{name: "count", params: []Expr{&NullExpr{}}}, rhs: &IntExpr{value: 1}}}),
+	}
+	doc := []any{map[string]any{"a": 1}, map[string]any{"b": 2}}
+	for name, q := range queries {
+		checkPrepared(t, name, q, doc)
+		if _, err := Prepare(q).Evaluate(doc); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if nodes, err := Prepare(q).Evaluate([]any{}); err != nil || len(nodes) != 0 {
+			t.Errorf("%s on an empty array = %v, %v", name, nodes, err)
+		}
+	}
+}
+
+func checkPrepared(t *testing.T, name string, q Query, doc any) {
+	t.Helper()
+	v := NewVisitorEval(doc)
+	q.accept(v)
+	expected, expectedErr := v.Nodes()
+	got, err := Prepare(q).EvaluateNodes(doc)
+	if mustMarshal(got) != mustMarshal(expected) || mustMarshal(err) != mustMarshal(expectedErr) {
+		t.Errorf("%s: prepared = %s, %v; VisitorEval = %s, %v", name, mustMarshal(got), err, mustMarshal(expected), expectedErr)
+	}
+	if err != nil && err.Error() != expectedErr.Error() {
+		t.Errorf("%s: prepared error %q; VisitorEval %q", name, err, expectedErr)
+	}
+}
+
+// closureBenchmarks are filters typical of request filtering.
+var closureBenchmarks = map[string]string{
+	"member":     "$.store.bicycle.color",
+	"filter":     "$.store.book[?@.price < 10 && @.category == 'fiction'].title",
+	"regex":      "$.store.book[?match(@.author, '.* Waugh')].title",
+	"descendant": "$..book[?@.isbn].price",
+	"root":       "$.store.book[?@.price > $.expensive].title",
+}
+
+// BenchmarkEvaluate compares prepared queries with VisitorEval walking the
+// AST on each evaluation.
+func BenchmarkEvaluate(b *testing.B) {
+	var doc any
+	if err := json.Unmarshal([]byte(evalDocument), &doc); err != nil {
+		b.Fatal(err)
+	}
+	c := &Compiler{}
+	for name, query := range closureBenchmarks {
+		q, err := c.Compile(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name+"/visitor", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				v := NewVisitorEval(doc)
+				q.accept(v)
+				if _, err := v.Result(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		p := Prepare(q)
+		b.Run(name+"/prepared", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := p.Evaluate(doc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
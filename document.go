@@ -0,0 +1,86 @@
+package gojimongo
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// D is an ordered document, the driver-independent counterpart of bson.D.
+// Every Mongo fragment produced by the package is built out of D, E and A so
+// callers can convert them to their driver's types without losing key order.
+type D []E
+
+// E is a single element of a D.
+type E struct {
+	Key   string
+	Value any
+}
+
+// A is an array inside a D.
+type A []any
+
+// Get returns the value stored under key, if any.
+func (d D) Get(key string) (any, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Map returns d as an unordered map, converting nested documents as well.
+func (d D) Map() map[string]any {
+	m := make(map[string]any, len(d))
+	for _, e := range d {
+		m[e.Key] = unorder(e.Value)
+	}
+	return m
+}
+
+func unorder(value any) any {
+	switch v := value.(type) {
+	case D:
+		return v.Map()
+	case A:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = unorder(item)
+		}
+		return out
+	}
+	return value
+}
+
+// MarshalJSON renders d as a JSON object keeping the key order.
+func (d D) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range d {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// String renders d as compact JSON, for logs and debugging.
+func (d D) String() string {
+	b, err := d.MarshalJSON()
+	if err != nil {
+		return "<invalid document: " + err.Error() + ">"
+	}
+	return string(b)
+}
@@ -0,0 +1,349 @@
+package gojimongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExtJSONMode selects the flavour of MongoDB Extended JSON v2.
+type ExtJSONMode int
+
+const (
+	// ExtJSONCanonical preserves every BSON type, e.g. {"$numberInt": "5"}.
+	ExtJSONCanonical ExtJSONMode = iota
+	// ExtJSONRelaxed writes numbers and dates in their natural JSON form
+	// whenever that loses no information, e.g. 5.
+	ExtJSONRelaxed
+)
+
+func extJSONError(value string) error {
+	return fmt.Errorf("[gojimongo][extjson]: %s", value)
+}
+
+// MarshalExtJSON renders value, typically a D, an A or a []D, as Extended
+// JSON. Documents keep their key order and maps are written with sorted keys,
+// so the output is deterministic.
+//
+// Go ints become Int32 when they fit and Int64 otherwise, floats become
+// Double and time.Time becomes a Date. A json.Number is classified as
+// UnmarshalExtJSON reads plain numbers. A uint or uint64 becomes an Int64,
+// and fails beyond its range.
+func MarshalExtJSON(value any, mode ExtJSONMode) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeExtJSON(&buf, value, mode); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeExtJSON(buf *bytes.Buffer, value any, mode ExtJSONMode) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case string:
+		writeExtJSONString(buf, v)
+	case int:
+		writeExtJSONInt(buf, int64(v), mode)
+	case int8:
+		writeExtJSONInt(buf, int64(v), mode)
+	case int16:
+		writeExtJSONInt(buf, int64(v), mode)
+	case int32:
+		writeExtJSONInt(buf, int64(v), mode)
+	case int64:
+		writeExtJSONTyped(buf, "$numberLong", strconv.FormatInt(v, 10), v, mode)
+	case uint8:
+		writeExtJSONInt(buf, int64(v), mode)
+	case uint16:
+		writeExtJSONInt(buf, int64(v), mode)
+	case uint32:
+		writeExtJSONInt(buf, int64(v), mode)
+	case uint:
+		return writeExtJSONUint(buf, uint64(v), mode)
+	case uint64:
+		return writeExtJSONUint(buf, v, mode)
+	case json.Number:
+		n, err := extJSONNumber(string(v))
+		if err != nil {
+			return err
+		}
+		return writeExtJSON(buf, n, mode)
+	case float32:
+		writeExtJSONDouble(buf, float64(v), mode)
+	case float64:
+		writeExtJSONDouble(buf, v, mode)
+	case time.Time:
+		writeExtJSONDate(buf, v, mode)
+	case D:
+		buf.WriteByte('{')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeExtJSONString(buf, e.Key)
+			buf.WriteByte(':')
+			if err := writeExtJSON(buf, e.Value, mode); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case A:
+		return writeExtJSONArray(buf, reflect.ValueOf(v), mode)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := make(D, len(keys))
+		for i, k := range keys {
+			d[i] = E{k, v[k]}
+		}
+		return writeExtJSON(buf, d, mode)
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			return writeExtJSONArray(buf, rv, mode)
+		}
+		return extJSONError(fmt.Sprintf("cannot encode %T", value))
+	}
+	return nil
+}
+
+// writeExtJSONUint writes an unsigned integer as an Int64, BSON having no
+// unsigned type.
+func writeExtJSONUint(buf *bytes.Buffer, v uint64, mode ExtJSONMode) error {
+	if v > math.MaxInt64 {
+		return extJSONError(fmt.Sprintf("cannot encode %d as a 64-bit integer", v))
+	}
+	writeExtJSONTyped(buf, "$numberLong", strconv.FormatUint(v, 10), v, mode)
+	return nil
+}
+
+func writeExtJSONArray(buf *bytes.Buffer, rv reflect.Value, mode ExtJSONMode) error {
+	buf.WriteByte('[')
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeExtJSON(buf, rv.Index(i).Interface(), mode); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeExtJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode appends a newline
+}
+
+// writeExtJSONTyped writes {"<key>": "<text>"}, or the relaxed form of value.
+func writeExtJSONTyped(buf *bytes.Buffer, key, text string, value any, mode ExtJSONMode) {
+	if mode == ExtJSONRelaxed {
+		fmt.Fprint(buf, value)
+		return
+	}
+	buf.WriteString(`{"` + key + `":"` + text + `"}`)
+}
+
+func writeExtJSONInt(buf *bytes.Buffer, n int64, mode ExtJSONMode) {
+	key := "$numberInt"
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		key = "$numberLong"
+	}
+	writeExtJSONTyped(buf, key, strconv.FormatInt(n, 10), n, mode)
+}
+
+func writeExtJSONDouble(buf *bytes.Buffer, f float64, mode ExtJSONMode) {
+	text := formatExtJSONDouble(f)
+	if mode == ExtJSONRelaxed && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		buf.WriteString(text)
+		return
+	}
+	buf.WriteString(`{"$numberDouble":"` + text + `"}`)
+}
+
+// formatExtJSONDouble writes the shortest decimal that reads back as f,
+// always with a fraction or an exponent so it is not taken for an integer.
+func formatExtJSONDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	abs := math.Abs(f)
+	if abs == 0 || (abs >= 1e-6 && abs < 1e21) {
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	s := strconv.FormatFloat(f, 'E', -1, 64)
+	mantissa, exponent, _ := strings.Cut(s, "E")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	sign := exponent[:1]
+	exponent = strings.TrimLeft(exponent[1:], "0")
+	return mantissa + "E" + sign + exponent
+}
+
+func writeExtJSONDate(buf *bytes.Buffer, t time.Time, mode ExtJSONMode) {
+	ms := t.UnixMilli()
+	if mode == ExtJSONRelaxed && t.Year() >= 1970 && t.Year() <= 9999 {
+		buf.WriteString(`{"$date":"` + t.UTC().Format("2006-01-02T15:04:05.999Z07:00") + `"}`)
+		return
+	}
+	buf.WriteString(`{"$date":{"$numberLong":"` + strconv.FormatInt(ms, 10) + `"}}`)
+}
+
+// UnmarshalExtJSON reads Extended JSON in either mode. Objects become D and
+// arrays A; Int32 values become int, Int64 values int64, Doubles float64 and
+// Dates time.Time, so that MarshalExtJSON gives back the same text.
+func UnmarshalExtJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := readExtJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, extJSONError("unexpected data after the value")
+	}
+	return value, nil
+}
+
+func readExtJSON(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, extJSONError(err.Error())
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			d := D{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, extJSONError(err.Error())
+				}
+				value, err := readExtJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				d = append(d, E{key.(string), value})
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, extJSONError(err.Error())
+			}
+			return extJSONTyped(d)
+		case '[':
+			a := A{}
+			for dec.More() {
+				value, err := readExtJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, value)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, extJSONError(err.Error())
+			}
+			return a, nil
+		}
+	case json.Number:
+		return extJSONNumber(string(t))
+	}
+	return tok, nil
+}
+
+// extJSONNumber reads a relaxed number: integers as Int32 or Int64, anything
+// with a fraction or an exponent as Double.
+func extJSONNumber(s string) (any, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err == nil {
+			if n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int(n), nil
+			}
+			return n, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, extJSONError("invalid number " + s)
+	}
+	return f, nil
+}
+
+// extJSONTyped turns the single-key objects of Extended JSON into the values
+// they stand for; other objects are returned unchanged.
+func extJSONTyped(d D) (any, error) {
+	if len(d) != 1 {
+		return d, nil
+	}
+	text, isText := d[0].Value.(string)
+	switch d[0].Key {
+	case "$numberInt":
+		n, err := strconv.ParseInt(text, 10, 32)
+		if !isText || err != nil {
+			return nil, extJSONError("invalid $numberInt")
+		}
+		return int(n), nil
+	case "$numberLong":
+		n, err := strconv.ParseInt(text, 10, 64)
+		if !isText || err != nil {
+			return nil, extJSONError("invalid $numberLong")
+		}
+		return n, nil
+	case "$numberDouble":
+		switch text {
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		case "NaN":
+			return math.NaN(), nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if !isText || err != nil {
+			return nil, extJSONError("invalid $numberDouble")
+		}
+		return f, nil
+	case "$date":
+		switch v := d[0].Value.(type) {
+		case string:
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, extJSONError("invalid $date")
+			}
+			return t.UTC(), nil
+		case int64:
+			return time.UnixMilli(v).UTC(), nil
+		case int:
+			return time.UnixMilli(int64(v)).UTC(), nil
+		}
+		return nil, extJSONError("invalid $date")
+	}
+	return d, nil
+}
@@ -0,0 +1,135 @@
+package gojimongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestMarshalExtJSON(t *testing.T) {
+	values := []struct {
+		value     any
+		canonical string
+		relaxed   string
+	}{
+		{D{{"a", 5}}, `{"a":{"$numberInt":"5"}}`, `{"a":5}`},
+		{D{{"a", 1 << 40}}, `{"a":{"$numberLong":"1099511627776"}}`, `{"a":1099511627776}`},
+		{D{{"a", int64(5)}}, `{"a":{"$numberLong":"5"}}`, `{"a":5}`},
+		{D{{"a", 1.0}}, `{"a":{"$numberDouble":"1.0"}}`, `{"a":1.0}`},
+		{D{{"a", -2.5e30}}, `{"a":{"$numberDouble":"-2.5E+30"}}`, `{"a":-2.5E+30}`},
+		{D{{"a", math.Inf(1)}}, `{"a":{"$numberDouble":"Infinity"}}`, `{"a":{"$numberDouble":"Infinity"}}`},
+		{D{{"b", "x<y"}, {"a", A{true, nil}}}, `{"b":"x<y","a":[true,null]}`, `{"b":"x<y","a":[true,null]}`},
+		{map[string]any{"b": 1, "a": 2}, `{"a":{"$numberInt":"2"},"b":{"$numberInt":"1"}}`, `{"a":2,"b":1}`},
+		{[]D{{{"$match", D{}}}}, `[{"$match":{}}]`, `[{"$match":{}}]`},
+		{time.UnixMilli(1500).UTC(), `{"$date":{"$numberLong":"1500"}}`, `{"$date":"1970-01-01T00:00:01.5Z"}`},
+		{D{{"n", json.Number("5")}}, `{"n":{"$numberInt":"5"}}`, `{"n":5}`},
+		{D{{"n", json.Number("9007199254740993")}}, `{"n":{"$numberLong":"9007199254740993"}}`, `{"n":9007199254740993}`},
+		{D{{"n", json.Number("8.95")}}, `{"n":{"$numberDouble":"8.95"}}`, `{"n":8.95}`},
+		{D{{"n", uint(5)}}, `{"n":{"$numberLong":"5"}}`, `{"n":5}`},
+		{D{{"n", uint64(math.MaxInt64)}}, `{"n":{"$numberLong":"9223372036854775807"}}`, `{"n":9223372036854775807}`},
+	}
+	for _, tc := range values {
+		for mode, expected := range []string{tc.canonical, tc.relaxed} {
+			b, err := MarshalExtJSON(tc.value, ExtJSONMode(mode))
+			if err != nil {
+				t.Errorf("MarshalExtJSON(%v, %d) = %v", tc.value, mode, err)
+				continue
+			}
+			if string(b) != expected {
+				t.Errorf("MarshalExtJSON(%v, %d) = %s; expected %s", tc.value, mode, b, expected)
+			}
+			decoded, err := UnmarshalExtJSON(b)
+			if err != nil {
+				t.Errorf("UnmarshalExtJSON(%s) = %v", b, err)
+				continue
+			}
+			again, err := MarshalExtJSON(decoded, ExtJSONMode(mode))
+			if err != nil || string(again) != expected {
+				t.Errorf("MarshalExtJSON(UnmarshalExtJSON(%s)) = %s, %v", b, again, err)
+			}
+		}
+	}
+}
+
+func TestMarshalExtJSONErrors(t *testing.T) {
+	for _, value := range []any{D{{"n", uint64(math.MaxInt64) + 1}}, json.Number("x"), json.Number("1e400"), struct{}{}} {
+		if _, err := MarshalExtJSON(value, ExtJSONCanonical); err == nil {
+			t.Errorf("MarshalExtJSON(%v) = nil; expected an error", value)
+		}
+	}
+}
+
+func TestUnmarshalExtJSONErrors(t *testing.T) {
+	for _, input := range []string{`{"a":`, `{"$numberInt":"x"}`, `{"$date":true}`, `1 2`} {
+		if _, err := UnmarshalExtJSON([]byte(input)); err == nil {
+			t.Errorf("UnmarshalExtJSON(%s) = nil; expected an error", input)
+		}
+	}
+}
+
+// TestExtJSONGolden encodes the filter and pipeline of every valid query of
+// TestParser. Run with -update to rewrite testdata/extjson.golden.
+func TestExtJSONGolden(t *testing.T) {
+	queries := []string{}
+	for query, valid := range parserQueries {
+		if valid {
+			queries = append(queries, query)
+		}
+	}
+	sort.Strings(queries)
+
+	var out bytes.Buffer
+	c := &Compiler{}
+	for _, query := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		fmt.Fprintf(&out, "# %s\n", query)
+		filter, err := MongoFilter(q)
+		writeGolden(t, &out, "filter", filter, err)
+		pipeline, err := MongoPipeline(q)
+		writeGolden(t, &out, "pipeline", pipeline, err)
+		out.WriteByte('\n')
+	}
+
+	golden := filepath.Join("testdata", "extjson.golden")
+	if *update {
+		if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("Extended JSON differs from %s; run go test -update and review the diff", golden)
+	}
+}
+
+func writeGolden(t *testing.T, out *bytes.Buffer, name string, value any, err error) {
+	if err != nil {
+		fmt.Fprintf(out, "%s: error: %v\n", name, err)
+		return
+	}
+	for mode, label := range []string{"canonical", "relaxed"} {
+		b, err := MarshalExtJSON(value, ExtJSONMode(mode))
+		if err != nil {
+			t.Fatalf("MarshalExtJSON(%v) = %v", value, err)
+		}
+		if _, err := UnmarshalExtJSON(b); err != nil {
+			t.Errorf("UnmarshalExtJSON(%s) = %v", b, err)
+		}
+		fmt.Fprintf(out, "%s %s: %s\n", name, label, b)
+	}
+}
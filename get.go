@@ -0,0 +1,123 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+const (
+	GET_ERROR_NOT_SINGULAR = "query is not singular"
+	GET_ERROR_TYPE         = "cannot be read as"
+)
+
+func getError(value string) error {
+	return fmt.Errorf("[gojimongo][get]: %s", value)
+}
+
+// Get returns the node the singular query q selects from doc as a T, and
+// whether there is one. Queries that may select several nodes fail, see
+// IsSingular.
+//
+// A node of another type than T is converted when no information is lost:
+// numbers to any numeric type holding them exactly, strings and bools to
+// types of their kind, and objects and arrays of encoding/json values to T
+// as encoding/json would decode them. Null is read as the nil of pointers,
+// interfaces, maps and slices.
+func Get[T any](q Query, doc any, opts ...EvalOption) (T, bool, error) {
+	var zero T
+	if !IsSingular(q) {
+		return zero, false, getError(GET_ERROR_NOT_SINGULAR)
+	}
+	nodes, err := Evaluate(q, doc, opts...)
+	if err != nil || len(nodes) == 0 {
+		return zero, false, err
+	}
+	if value, ok := nodes[0].(T); ok {
+		return value, true, nil
+	}
+	target := reflect.ValueOf(&zero).Elem()
+	if nodes[0] == nil {
+		switch target.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			return zero, true, nil
+		}
+	}
+	if !convertValue(nodes[0], target) {
+		return zero, false, getError(fmt.Sprintf("%T %s %s", nodes[0], GET_ERROR_TYPE, target.Type()))
+	}
+	return zero, true, nil
+}
+
+// convertValue stores value into target when it converts without losing
+// information.
+func convertValue(value any, target reflect.Value) bool {
+	t := target.Type()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := integerValue(value)
+		if !ok || target.OverflowInt(i) {
+			return false
+		}
+		target.SetInt(i)
+		return true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := integerValue(value)
+		if !ok || i < 0 || target.OverflowUint(uint64(i)) {
+			return false
+		}
+		target.SetUint(uint64(i))
+		return true
+	case reflect.Float32, reflect.Float64:
+		f, ok := evalNumber(value)
+		if !ok || t.Kind() == reflect.Float32 && float64(float32(f)) != f {
+			return false
+		}
+		target.SetFloat(f)
+		return true
+	case reflect.String:
+		s, ok := value.(string)
+		if ok {
+			target.SetString(s)
+		}
+		return ok
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if ok {
+			target.SetBool(b)
+		}
+		return ok
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if _, ok := asTree(value); !ok {
+			return false
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return false
+		}
+		return json.Unmarshal(data, target.Addr().Interface()) == nil
+	}
+	return false
+}
+
+// integerValue returns a number without fraction as an int64.
+func integerValue(value any) (int64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	}
+	f, ok := evalNumber(value)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
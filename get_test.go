@@ -0,0 +1,98 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestIsSingular(t *testing.T) {
+	queries := map[string]bool{
+		"$":              true,
+		"@":              true,
+		"$.a.b":          true,
+		"$['a'][0][-1]":  true,
+		"@.a[2]":         true,
+		"$.a[0,'0'].b":   false,
+		"$.a[0,'1']":     false,
+		"$.a[*]":         false,
+		"$..a":           false,
+		"$.a[0,1]":       false,
+		"$.a[0:1]":       false,
+		"$.a[?@.b]":      false,
+		"$.a['b','c'].d": false,
+	}
+	c := &Compiler{}
+	for query, singular := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		if IsSingular(q) != singular {
+			t.Errorf("IsSingular(%q) = %t; expected %t", query, !singular, singular)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`{"name": "api", "port": 8080, "ratio": 0.5, "big": 9007199254740993,
+		"tls": true, "tags": ["a", "b"], "limits": {"rps": 10}, "none": null}`))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	c := &Compiler{}
+	compile := func(query string) Query {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		return q
+	}
+
+	if name, ok, err := Get[string](compile("$.name"), doc); name != "api" || !ok || err != nil {
+		t.Errorf("Get[string]($.name) = %q, %t, %v", name, ok, err)
+	}
+	if port, ok, err := Get[uint16](compile("$.port"), doc); port != 8080 || !ok || err != nil {
+		t.Errorf("Get[uint16]($.port) = %d, %t, %v", port, ok, err)
+	}
+	if big, ok, err := Get[int64](compile("$.big"), doc); big != 9007199254740993 || !ok || err != nil {
+		t.Errorf("Get[int64]($.big) = %d, %t, %v", big, ok, err)
+	}
+	if ratio, ok, err := Get[float64](compile("$['ratio']"), doc); ratio != 0.5 || !ok || err != nil {
+		t.Errorf("Get[float64]($.ratio) = %g, %t, %v", ratio, ok, err)
+	}
+	if tag, ok, err := Get[string](compile("$.tags[-1]"), doc); tag != "b" || !ok || err != nil {
+		t.Errorf("Get[string]($.tags[-1]) = %q, %t, %v", tag, ok, err)
+	}
+	type limits struct {
+		RPS int `json:"rps"`
+	}
+	if l, ok, err := Get[limits](compile("$.limits"), doc); l.RPS != 10 || !ok || err != nil {
+		t.Errorf("Get[limits]($.limits) = %v, %t, %v", l, ok, err)
+	}
+	if tags, ok, err := Get[[]string](compile("$.tags"), doc); len(tags) != 2 || !ok || err != nil {
+		t.Errorf("Get[[]string]($.tags) = %v, %t, %v", tags, ok, err)
+	}
+	if v, ok, err := Get[*int](compile("$.none"), doc); v != nil || !ok || err != nil {
+		t.Errorf("Get[*int]($.none) = %v, %t, %v", v, ok, err)
+	}
+	if _, ok, err := Get[string](compile("$.missing"), doc); ok || err != nil {
+		t.Errorf("Get[string]($.missing) = %t, %v; expected no node", ok, err)
+	}
+
+	failures := map[string]func() error{
+		"$.tags[*]": func() error { _, _, err := Get[any](compile("$.tags[*]"), doc); return err },
+		"$..name":   func() error { _, _, err := Get[string](compile("$..name"), doc); return err },
+		"$.ratio":   func() error { _, _, err := Get[int](compile("$.ratio"), doc); return err },
+		"$.port":    func() error { _, _, err := Get[int8](compile("$.port"), doc); return err },
+		"$.name":    func() error { _, _, err := Get[bool](compile("$.name"), doc); return err },
+		"$.none":    func() error { _, _, err := Get[int](compile("$.none"), doc); return err },
+	}
+	for query, get := range failures {
+		if err := get(); err == nil || !strings.HasPrefix(err.Error(), "[gojimongo][get]") {
+			t.Errorf("Get(%q) = %v; expected an error", query, err)
+		}
+	}
+}
@@ -20,6 +20,11 @@ func (c *Compiler) Compile(value string) (Query, error) {
 	if err != nil {
 		return nil, err 
 	}
+	checker := NewVisitorChecker()
+	q.accept(checker)
+	if err := checker.Result(); err != nil {
+		return nil, err
+	}
 	return q, nil
 }
 
@@ -0,0 +1,83 @@
+package gojimongo
+
+import (
+	"context"
+	"strings"
+)
+
+// Collection is the part of a MongoDB collection a HybridPlan runs against.
+// It is satisfied by a thin wrapper around a driver collection, or by an
+// in-memory fake in tests.
+type Collection interface {
+	Find(ctx context.Context, filter D) ([]map[string]any, error)
+}
+
+// HybridPlan splits a query between the database and the process. The
+// pushdown is a find filter built from every part of the query the Mongo
+// backend can translate; the parts it cannot translate are dropped from it,
+// which weakens it into a filter matching a superset of the documents.
+// Wildcards and filters below the root, which may apply to an object, are
+// weakened the same way into also matching every document where the node
+// they apply to is an object; applied to the root, whose members a find
+// filter cannot enumerate, they are dropped. The residual is the whole query,
+// evaluated in Go on each returned document, so the plan selects exactly the
+// nodes the query selects.
+type HybridPlan struct {
+	Query    Query
+	Pushdown D
+	// Exact reports whether the pushdown matches exactly the documents the
+	// query selects nodes from, so that no document is fetched in vain. With
+	// WithArrayTraversal it assumes wildcards and filters apply to arrays.
+	Exact bool
+	// Residual lists the parts of the query left out of the pushdown and the
+	// reason each could not be translated.
+	Residual []error
+}
+
+// NewHybridPlan plans q.
+func NewHybridPlan(q Query, opts ...MongoOption) *HybridPlan {
+	v := NewVisitorMongo(opts...)
+	v.relaxed = true
+	q.accept(v)
+	pushdown, _ := v.Result()
+	return &HybridPlan{
+		Query:    q,
+		Pushdown: pushdown,
+		Exact:    len(v.dropped) == 0,
+		Residual: v.dropped,
+	}
+}
+
+// Run finds the documents matching the pushdown in coll and returns the nodes
+// the query selects from them, document by document.
+func (p *HybridPlan) Run(ctx context.Context, coll Collection) ([]any, error) {
+	docs, err := coll.Find(ctx, p.Pushdown)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []any{}
+	for _, doc := range docs {
+		selected, err := Evaluate(p.Query, doc)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, selected...)
+	}
+	return nodes, nil
+}
+
+// String describes where each part of the plan runs.
+func (p *HybridPlan) String() string {
+	var b strings.Builder
+	b.WriteString("pushdown: ")
+	b.WriteString(p.Pushdown.String())
+	if p.Exact {
+		b.WriteString(" (exact)")
+	}
+	b.WriteString("\nresidual: evaluate the query in process")
+	for _, err := range p.Residual {
+		b.WriteString("\n  - ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
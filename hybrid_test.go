@@ -0,0 +1,357 @@
+package gojimongo
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeCollection returns the documents matching the filter it gets, and
+// records it. It understands the operators the Mongo backend emits, with
+// MongoDB's traversal of arrays along dotted paths, except $expr, which it
+// takes as matching every document.
+type fakeCollection struct {
+	docs   []map[string]any
+	filter D
+}
+
+func (c *fakeCollection) Find(ctx context.Context, filter D) ([]map[string]any, error) {
+	c.filter = filter
+	docs := []map[string]any{}
+	for _, doc := range c.docs {
+		if fakeMatch(doc, filter) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// fakeMatch reports whether doc matches the query document filter.
+func fakeMatch(doc any, filter D) bool {
+	for _, e := range filter {
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			n := 0
+			for _, item := range e.Value.(A) {
+				if fakeMatch(doc, item.(D)) {
+					n++
+				}
+			}
+			items := len(e.Value.(A))
+			if e.Key == "$and" && n != items || e.Key == "$or" && n == 0 || e.Key == "$nor" && n > 0 {
+				return false
+			}
+		case "$expr":
+		default:
+			if !fakeField(fakeLookup(doc, strings.Split(e.Key, ".")), e.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fakeLookup lists the values a dotted path reaches, traversing arrays.
+func fakeLookup(v any, path []string) []any {
+	if len(path) == 0 {
+		return []any{v}
+	}
+	switch x := v.(type) {
+	case map[string]any:
+		if child, ok := x[path[0]]; ok {
+			return fakeLookup(child, path[1:])
+		}
+	case []any:
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i < len(x) {
+				return fakeLookup(x[i], path[1:])
+			}
+			return nil
+		}
+		values := []any{}
+		for _, elem := range x {
+			if _, ok := elem.(map[string]any); ok {
+				values = append(values, fakeLookup(elem, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// fakeField reports whether the values of a field satisfy spec, an operator
+// document or a value to equal.
+func fakeField(values []any, spec any) bool {
+	ops, ok := spec.(D)
+	if !ok || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+		ops = D{{"$eq", spec}}
+	}
+	for _, op := range ops {
+		if !fakeOperator(values, op.Key, op.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func fakeOperator(values []any, op string, arg any) bool {
+	switch op {
+	case "$exists":
+		return (len(values) > 0) == arg.(bool)
+	case "$ne":
+		return !fakeOperator(values, "$eq", arg)
+	case "$not":
+		return !fakeField(values, arg)
+	case "$elemMatch":
+		for _, v := range values {
+			elems, _ := v.([]any)
+			for _, elem := range elems {
+				query := arg.(D)
+				if strings.HasPrefix(query[0].Key, "$") && query[0].Key != "$and" && query[0].Key != "$or" && query[0].Key != "$nor" {
+					if fakeField([]any{elem}, query) {
+						return true
+					}
+				} else if fakeMatch(elem, query) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	// other operators hold for a value or, for an array, one of its elements
+	for _, v := range values {
+		candidates := []any{v}
+		if elems, ok := v.([]any); ok {
+			candidates = append(candidates, elems...)
+		}
+		for _, c := range candidates {
+			if fakeCompare(op, c, arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func fakeCompare(op string, v, arg any) bool {
+	switch op {
+	case "$type":
+		switch arg {
+		case "object":
+			_, ok := v.(map[string]any)
+			return ok
+		case "array":
+			_, ok := v.([]any)
+			return ok
+		case "string":
+			_, ok := v.(string)
+			return ok
+		case "null":
+			return v == nil
+		}
+		_, ok := v.(float64)
+		return ok
+	case "$regex":
+		s, ok := v.(string)
+		return ok && regexp.MustCompile(arg.(string)).MatchString(s)
+	case "$eq":
+		return reflect.DeepEqual(fakeNumber(v), fakeNumber(arg))
+	}
+	a, b := fakeNumber(v), fakeNumber(arg)
+	var cmp int
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case a > b:
+			cmp = 1
+		case a < b:
+			cmp = -1
+		}
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(a, b)
+	default:
+		return false
+	}
+	switch op {
+	case "$gt":
+		return cmp > 0
+	case "$gte":
+		return cmp >= 0
+	case "$lt":
+		return cmp < 0
+	case "$lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+func fakeNumber(v any) any {
+	if i, ok := v.(int); ok {
+		return float64(i)
+	}
+	return v
+}
+
+func TestHybridPlan(t *testing.T) {
+	queries := []struct {
+		query    string
+		pushdown string
+		exact    bool
+	}{
+		{"$.orders[?(@.total > 10)].id", `{"$or":[{"orders":{"$elemMatch":{"total":{"$gt":10},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}`, false},
+		{"$.orders[?(@.total > 10 && @..sku)].id", `{"$or":[{"orders":{"$elemMatch":{"total":{"$gt":10},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}`, false},
+		{"$.orders[?(@.total > 10 && @.items[-1])].id", `{"$or":[{"orders":{"$elemMatch":{"total":{"$gt":10},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}`, false},
+		{"$.orders[?(@.total > 10 || @.tags[0:1])].id", `{"$or":[{"orders":{"$elemMatch":{"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}`, false},
+		{"$.orders[?(!(@.total > 10 && @.tags[0:1]))].id", `{"$or":[{"orders":{"$elemMatch":{"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}`, false},
+		{"$.orders[0].id", `{"orders.0.id":{"$exists":true}}`, true},
+		{"$[?(@.total > 10)]", `{}`, false},
+		{"$.a.*", `{"$or":[{"a.0":{"$exists":true}},{"a":{"$type":"object"}}]}`, false},
+		{"$.orders..id", `{}`, false},
+	}
+	c := &Compiler{}
+	for _, tc := range queries {
+		q, err := c.Compile(tc.query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", tc.query, err)
+		}
+		plan := NewHybridPlan(q)
+		if plan.Pushdown.String() != tc.pushdown || plan.Exact != tc.exact {
+			t.Errorf("NewHybridPlan(%q) = %s %v; expected %s %v", tc.query, plan.Pushdown, plan.Exact, tc.pushdown, tc.exact)
+		}
+		if plan.Exact != (len(plan.Residual) == 0) {
+			t.Errorf("NewHybridPlan(%q) residual = %v", tc.query, plan.Residual)
+		}
+	}
+}
+
+func TestHybridPlanResidual(t *testing.T) {
+	// the negative index is the only part left out, so with array
+	// traversal assumed it alone makes the plan inexact
+	c := &Compiler{}
+	q, err := c.Compile("$.orders[?(@.total > 10 && @.items[-1])].id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := NewHybridPlan(q, WithArrayTraversal())
+	if pushdown := `{"orders":{"$elemMatch":{"total":{"$gt":10},"id":{"$exists":true}}}}`; plan.Pushdown.String() != pushdown || plan.Exact {
+		t.Errorf("NewHybridPlan() = %s %v; expected %s false", plan.Pushdown, plan.Exact, pushdown)
+	}
+	if len(plan.Residual) != 1 {
+		t.Fatalf("NewHybridPlan() residual = %v; expected one error", plan.Residual)
+	}
+	if terr, ok := plan.Residual[0].(*TranslationError); !ok || terr.Node != "MinusExpr" || terr.Reason != MONGO_ERROR_NEGATIVE_INDEX {
+		t.Errorf("NewHybridPlan() residual = %v; expected a negative index", plan.Residual[0])
+	}
+}
+
+func TestHybridPlanRun(t *testing.T) {
+	var docs []map[string]any
+	err := json.Unmarshal([]byte(`[
+		{"orders": [{"id": 1, "total": 5}, {"id": 2, "total": 50, "items": [{"sku": "a"}]}]},
+		{"orders": [{"id": 3, "total": 20, "items": []}]}
+	]`), &docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Compiler{}
+	q, err := c.Compile("$.orders[?(@.total > 10 && @..sku)].id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll := &fakeCollection{docs: docs}
+	plan := NewHybridPlan(q)
+	nodes, err := plan.Run(context.Background(), coll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.filter.String() != plan.Pushdown.String() {
+		t.Errorf("Find got %s; expected the pushdown %s", coll.filter, plan.Pushdown)
+	}
+	got, _ := json.Marshal(nodes)
+	if string(got) != `[2]` {
+		t.Errorf("Run() = %s; expected [2]", got)
+	}
+}
+
+// TestHybridPlanObjectMembers runs queries whose wildcards and filters also
+// apply to objects against a collection that applies the pushdown, and
+// checks that the plan selects the nodes Evaluate selects from every
+// document.
+func TestHybridPlanObjectMembers(t *testing.T) {
+	var docs []map[string]any
+	err := json.Unmarshal([]byte(`[
+		{"total": 1, "sub": {"total": 50}},
+		{"a": {"b": 5}},
+		{"a": {"x": {"b": 2}, "y": 0}},
+		{"a": [{"b": 2}, 3]},
+		{"a": []},
+		{"a": 7}
+	]`), &docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := []string{
+		"$[?(@.total > 10)]",
+		"$.*",
+		"$.a.*",
+		"$.a[?(@ > 1)]",
+		"$.a[*].b",
+		"$.a[?(@.b > 1)]",
+		"$.a[?(@.b > 1 && @.b < 10)]",
+	}
+	c := &Compiler{}
+	for _, query := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		expected := []any{}
+		for _, doc := range docs {
+			nodes, err := Evaluate(q, doc)
+			if err != nil {
+				t.Fatalf("Evaluate(%q) = %v", query, err)
+			}
+			expected = append(expected, nodes...)
+		}
+		plan := NewHybridPlan(q)
+		if plan.Exact {
+			t.Errorf("NewHybridPlan(%q) = %s is exact", query, plan.Pushdown)
+		}
+		nodes, err := plan.Run(context.Background(), &fakeCollection{docs: docs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(nodes)
+		want, _ := json.Marshal(expected)
+		if string(got) != string(want) {
+			t.Errorf("Run(%q) with pushdown %s = %s; expected %s", query, plan.Pushdown, got, want)
+		}
+	}
+
+	// array traversal misses the members of {"a": {"b": 5}}
+	q, err := c.Compile("$.a.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := NewHybridPlan(q, WithArrayTraversal())
+	nodes, err := plan.Run(context.Background(), &fakeCollection{docs: docs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(nodes)
+	if !plan.Exact || string(got) != `[{"b":2},3]` {
+		t.Errorf("Run(%q, WithArrayTraversal()) with pushdown %s = %s %v; expected [{\"b\":2},3] true", "$.a.*", plan.Pushdown, got, plan.Exact)
+	}
+}
@@ -0,0 +1,390 @@
+package gojimongo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	REGEXP_ERROR_UNTERMINATED_GROUP = "missing closing parenthesis"
+	REGEXP_ERROR_UNOPENED_GROUP     = "unexpected closing parenthesis"
+	REGEXP_ERROR_UNTERMINATED_CLASS = "missing closing bracket"
+	REGEXP_ERROR_EMPTY_CLASS        = "empty character class"
+	REGEXP_ERROR_CLASS_CHAR         = "character must be escaped in a character class"
+	REGEXP_ERROR_RANGE              = "character range is out of order"
+	REGEXP_ERROR_NOTHING_TO_REPEAT  = "quantifier does not follow an atom"
+	REGEXP_ERROR_QUANTIFIER         = "invalid range quantifier"
+	REGEXP_ERROR_ESCAPE             = "escape is not allowed in I-Regexp"
+	REGEXP_ERROR_CATEGORY           = "unknown Unicode category"
+	REGEXP_ERROR_UNESCAPED          = "character must be escaped"
+	REGEXP_ERROR_UTF8               = "invalid UTF-8"
+)
+
+// regexpMaxRepeat caps the bounds of range quantifiers, as regexp/syntax
+// does.
+const regexpMaxRepeat = 1000
+
+// RegexpError reports a pattern that is not an I-Regexp (RFC 9485), the
+// regular expression flavour of JSONPath's match() and search().
+type RegexpError struct {
+	Pattern  string
+	Position int // 1-based byte position of the offending character in Pattern
+	Reason   string
+}
+
+func (e *RegexpError) Error() string {
+	return fmt.Sprintf("[gojimongo][regexp]: %s at position %d of %q", e.Reason, e.Position, e.Pattern)
+}
+
+// iregexpCategories are the Unicode general categories I-Regexp accepts in
+// \p{..} and \P{..}.
+var iregexpCategories = map[string]bool{
+	"L": true, "Lu": true, "Ll": true, "Lt": true, "Lm": true, "Lo": true,
+	"M": true, "Mn": true, "Mc": true, "Me": true,
+	"N": true, "Nd": true, "Nl": true, "No": true,
+	"P": true, "Pc": true, "Pd": true, "Ps": true, "Pe": true, "Pi": true, "Pf": true, "Po": true,
+	"Z": true, "Zs": true, "Zl": true, "Zp": true,
+	"S": true, "Sm": true, "Sc": true, "Sk": true, "So": true,
+	"C": true, "Cc": true, "Cf": true, "Co": true,
+}
+
+// iregexp rewrites an I-Regexp into the same language in the syntax shared
+// by PCRE, which MongoDB uses, and RE2, which Go's regexp uses: '.' excludes
+// \n and \r, and '^' and '$' are plain characters.
+type iregexp struct {
+	src string
+	pos int
+	out strings.Builder
+}
+
+// translateIRegexp validates pattern and returns its translation, anchored
+// to the whole string for match() and unanchored for search().
+func translateIRegexp(pattern string, anchored bool) (string, error) {
+	r := &iregexp{src: pattern}
+	if err := r.branches(); err != nil {
+		return "", err
+	}
+	if r.pos < len(r.src) {
+		return "", r.error(REGEXP_ERROR_UNOPENED_GROUP)
+	}
+	if anchored {
+		return `^(?:` + r.out.String() + `)\z`, nil
+	}
+	return r.out.String(), nil
+}
+
+var regexpCache sync.Map
+
+// compileIRegexp returns the Go regexp for pattern, or nil when pattern is not
+// an I-Regexp. Patterns are compiled once per process.
+func compileIRegexp(pattern string, anchored bool) *regexp.Regexp {
+	key := fmt.Sprintf("%t:%s", anchored, pattern)
+	if re, ok := regexpCache.Load(key); ok {
+		return re.(*regexp.Regexp)
+	}
+	translated, err := translateIRegexp(pattern, anchored)
+	if err != nil {
+		return nil
+	}
+	re, err := regexp.Compile(translated)
+	if err != nil {
+		return nil
+	}
+	regexpCache.Store(key, re)
+	return re
+}
+
+func (r *iregexp) error(reason string) error {
+	return &RegexpError{Pattern: r.src, Position: r.pos + 1, Reason: reason}
+}
+
+func (r *iregexp) peek() rune {
+	if r.pos >= len(r.src) {
+		return -1
+	}
+	c, _ := utf8.DecodeRuneInString(r.src[r.pos:])
+	return c
+}
+
+func (r *iregexp) next() (rune, error) {
+	c, size := utf8.DecodeRuneInString(r.src[r.pos:])
+	if c == utf8.RuneError && size <= 1 {
+		return 0, r.error(REGEXP_ERROR_UTF8)
+	}
+	r.pos += size
+	return c, nil
+}
+
+// branches parses branch *( "|" branch ).
+func (r *iregexp) branches() error {
+	for {
+		if err := r.branch(); err != nil {
+			return err
+		}
+		if r.peek() != '|' {
+			return nil
+		}
+		r.pos++
+		r.out.WriteByte('|')
+	}
+}
+
+// branch parses *( atom [ quantifier ] ).
+func (r *iregexp) branch() error {
+	for {
+		switch r.peek() {
+		case -1, '|', ')':
+			return nil
+		}
+		if err := r.atom(); err != nil {
+			return err
+		}
+		if err := r.quantifier(); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *iregexp) atom() error {
+	switch r.peek() {
+	case '(':
+		r.pos++
+		r.out.WriteString("(?:")
+		if err := r.branches(); err != nil {
+			return err
+		}
+		if r.peek() != ')' {
+			return r.error(REGEXP_ERROR_UNTERMINATED_GROUP)
+		}
+		r.pos++
+		r.out.WriteByte(')')
+		return nil
+	case '[':
+		return r.class()
+	case '.':
+		r.pos++
+		r.out.WriteString(`[^\n\r]`)
+		return nil
+	case '\\':
+		return r.escape(false)
+	case '*', '+', '?', '{':
+		return r.error(REGEXP_ERROR_NOTHING_TO_REPEAT)
+	case ']', '}':
+		return r.error(REGEXP_ERROR_UNESCAPED)
+	}
+	c, err := r.next()
+	if err != nil {
+		return err
+	}
+	r.out.WriteString(regexpChar(c, false))
+	return nil
+}
+
+// quantifier parses an optional "*", "+", "?" or "{n}", "{n,}", "{n,m}",
+// with n <= m <= 1000.
+func (r *iregexp) quantifier() error {
+	switch r.peek() {
+	case '*', '+', '?':
+		r.out.WriteByte(r.src[r.pos])
+		r.pos++
+		return nil
+	case '{':
+	default:
+		return nil
+	}
+	start := r.pos
+	r.pos++
+	bound := func() (int, error) {
+		from := r.pos
+		for r.pos < len(r.src) && isDigit(r.src[r.pos]) {
+			r.pos++
+		}
+		if r.pos == from {
+			return 0, r.error(REGEXP_ERROR_QUANTIFIER)
+		}
+		n, err := strconv.Atoi(r.src[from:r.pos])
+		if err != nil || n > regexpMaxRepeat {
+			r.pos = from
+			return 0, r.error(REGEXP_ERROR_QUANTIFIER)
+		}
+		return n, nil
+	}
+	n, err := bound()
+	if err != nil {
+		return err
+	}
+	if r.peek() == ',' {
+		r.pos++
+		if from := r.pos; from < len(r.src) && isDigit(r.src[from]) {
+			m, err := bound()
+			if err != nil {
+				return err
+			}
+			if m < n {
+				r.pos = from
+				return r.error(REGEXP_ERROR_QUANTIFIER)
+			}
+		}
+	}
+	if r.peek() != '}' {
+		return r.error(REGEXP_ERROR_QUANTIFIER)
+	}
+	r.pos++
+	r.out.WriteString(r.src[start:r.pos])
+	return nil
+}
+
+// escape parses a single character escape or a category escape. Inside a
+// character class the escaped character is written for a class.
+func (r *iregexp) escape(inClass bool) error {
+	c, ok, err := r.escapedChar()
+	if err != nil || ok {
+		if err == nil {
+			r.out.WriteString(regexpChar(c, inClass))
+		}
+		return err
+	}
+	return r.category()
+}
+
+// escapedChar parses a single character escape, reporting false when the
+// escape is a category escape.
+func (r *iregexp) escapedChar() (rune, bool, error) {
+	r.pos++ // '\'
+	c := r.peek()
+	switch c {
+	case 'n':
+		r.pos++
+		return '\n', true, nil
+	case 'r':
+		r.pos++
+		return '\r', true, nil
+	case 't':
+		r.pos++
+		return '\t', true, nil
+	case '(', ')', '*', '+', '-', '.', '?', '[', '\\', ']', '^', '{', '|', '}':
+		r.pos++
+		return c, true, nil
+	case 'p', 'P':
+		return 0, false, nil
+	}
+	r.pos--
+	return 0, false, r.error(REGEXP_ERROR_ESCAPE)
+}
+
+// category parses the rest of \p{..} or \P{..}.
+func (r *iregexp) category() error {
+	start := r.pos - 1
+	r.pos++ // 'p' or 'P'
+	if r.peek() != '{' {
+		return r.error(REGEXP_ERROR_ESCAPE)
+	}
+	end := strings.IndexByte(r.src[r.pos:], '}')
+	if end < 0 || !iregexpCategories[r.src[r.pos+1:r.pos+end]] {
+		r.pos = start
+		return r.error(REGEXP_ERROR_CATEGORY)
+	}
+	r.pos += end + 1
+	r.out.WriteString(r.src[start:r.pos])
+	return nil
+}
+
+// class parses "[" [ "^" ] ( "-" / item ) *item [ "-" ] "]", where an item is
+// a character, a range of characters or a category escape.
+func (r *iregexp) class() error {
+	start := r.pos
+	r.pos++
+	r.out.WriteByte('[')
+	if r.peek() == '^' {
+		r.pos++
+		r.out.WriteByte('^')
+	}
+	items := 0
+	if r.peek() == '-' {
+		r.pos++
+		r.out.WriteString(`\-`)
+		items++
+	}
+	for {
+		switch r.peek() {
+		case -1:
+			r.pos = start
+			return r.error(REGEXP_ERROR_UNTERMINATED_CLASS)
+		case ']':
+			if items == 0 {
+				r.pos = start
+				return r.error(REGEXP_ERROR_EMPTY_CLASS)
+			}
+			r.pos++
+			r.out.WriteByte(']')
+			return nil
+		case '-':
+			if r.pos+1 < len(r.src) && r.src[r.pos+1] == ']' {
+				r.pos++
+				r.out.WriteString(`\-`)
+				continue
+			}
+			return r.error(REGEXP_ERROR_CLASS_CHAR)
+		}
+		if strings.HasPrefix(r.src[r.pos:], `\p`) || strings.HasPrefix(r.src[r.pos:], `\P`) {
+			r.pos++
+			if err := r.category(); err != nil {
+				return err
+			}
+			items++
+			continue
+		}
+		low, err := r.classChar()
+		if err != nil {
+			return err
+		}
+		items++
+		if r.peek() != '-' || r.pos+1 >= len(r.src) || r.src[r.pos+1] == ']' {
+			r.out.WriteString(regexpChar(low, true))
+			continue
+		}
+		r.pos++
+		rangePos := r.pos
+		high, err := r.classChar()
+		if err != nil {
+			return err
+		}
+		if high < low {
+			r.pos = rangePos
+			return r.error(REGEXP_ERROR_RANGE)
+		}
+		r.out.WriteString(regexpChar(low, true) + "-" + regexpChar(high, true))
+	}
+}
+
+// classChar parses a character of a character class, possibly escaped.
+func (r *iregexp) classChar() (rune, error) {
+	switch r.peek() {
+	case '\\':
+		c, ok, err := r.escapedChar()
+		if err == nil && !ok {
+			err = r.error(REGEXP_ERROR_ESCAPE)
+		}
+		return c, err
+	case '[', ']', '-':
+		return 0, r.error(REGEXP_ERROR_CLASS_CHAR)
+	}
+	return r.next()
+}
+
+// regexpChar writes c so that it stands for itself in PCRE and RE2.
+func regexpChar(c rune, inClass bool) string {
+	switch {
+	case c < 0x20 || c == 0x7f:
+		return fmt.Sprintf(`\x{%x}`, c)
+	case inClass && strings.ContainsRune(`\]-[^`, c):
+		return `\` + string(c)
+	case !inClass && strings.ContainsRune(`\^$.|?*+()[]{}`, c):
+		return `\` + string(c)
+	}
+	return string(c)
+}
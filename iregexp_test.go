@@ -0,0 +1,100 @@
+package gojimongo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTranslateIRegexp(t *testing.T) {
+	patterns := map[string]string{
+		`abc`:             `abc`,
+		`a.c`:             `a[^\n\r]c`,
+		`^a$`:             `\^a\$`,
+		`(ab|cd)+`:        `(?:ab|cd)+`,
+		`a{2}b{1,}c{0,3}`: `a{2}b{1,}c{0,3}`,
+		`\p{Lu}\P{Nd}`:    `\p{Lu}\P{Nd}`,
+		`\.\*\n`:          `\.\*\x{a}`,
+		`[a-z0-9_]`:       `[a-z0-9_]`,
+		`[^.^$]`:          `[^.\^$]`,
+		`[-a]`:            `[\-a]`,
+		`[a-]`:            `[a\-]`,
+		`[\]\\\p{L}]`:     `[\]\\\p{L}]`,
+		"é\t":             `é\x{9}`,
+		``:                ``,
+	}
+	for pattern, expected := range patterns {
+		translated, err := translateIRegexp(pattern, false)
+		if err != nil {
+			t.Errorf("translateIRegexp(%q) = %v", pattern, err)
+			continue
+		}
+		if translated != expected {
+			t.Errorf("translateIRegexp(%q) = %s; expected %s", pattern, translated, expected)
+		}
+	}
+	anchored, _ := translateIRegexp(`a|b`, true)
+	if anchored != `^(?:a|b)\z` {
+		t.Errorf("translateIRegexp(`a|b`, true) = %s", anchored)
+	}
+}
+
+func TestTranslateIRegexpErrors(t *testing.T) {
+	patterns := map[string]int{
+		`(ab`:                     4,
+		`ab)`:                     3,
+		`*a`:                      1,
+		`a**`:                     3,
+		`a*?`:                     3,
+		`a{}`:                     3,
+		`a{1,2`:                   6,
+		`a{3,1}`:                  5,
+		`a{1001}`:                 3,
+		`a{1,1001}`:               5,
+		`a{99999999999999999999}`: 3,
+		`\d`:                      1,
+		`\p{IsLatin}`:             1,
+		`[]`:                      1,
+		`[abc`:                    1,
+		`[z-a]`:                   4,
+		`[a[b]`:                   3,
+		`a]`:                      2,
+		`(?:a)`:                   2,
+		"\xff":                    1,
+	}
+	for pattern, position := range patterns {
+		_, err := translateIRegexp(pattern, false)
+		var rerr *RegexpError
+		if !errors.As(err, &rerr) {
+			t.Errorf("translateIRegexp(%q) = %v; expected a RegexpError", pattern, err)
+			continue
+		}
+		if rerr.Position != position {
+			t.Errorf("translateIRegexp(%q) failed at %d (%s); expected %d", pattern, rerr.Position, rerr.Reason, position)
+		}
+	}
+}
+
+func TestCompileRegexpFunctions(t *testing.T) {
+	queries := map[string]bool{
+		"$[?match(@.name, 'J.*')]":     true,
+		"$[?search(@.name, '[A-Z]')]":  true,
+		"$[?match(@.name, @.pattern)]": true,
+		"$[?match(@.name, 'a(b')]":     false,
+		"$[?search(@.name, '\\\\w+')]": false,
+		"$[?match(@.name)]":            false,
+		"$[?search(@.a, 'x', 'y')]":    false,
+		"$.a[?@.b[?match(@, '[')]]":    false,
+		"$[?match(@.a, 'a{3,1}')]":     false,
+		"$[?match(@.a, 'a{1,1000}')]":  true,
+	}
+	c := &Compiler{}
+	for query, valid := range queries {
+		_, err := c.Compile(query)
+		if valid && err != nil {
+			t.Errorf("Compile(%q) = %v", query, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Compile(%q) succeeded; expected an error", query)
+		}
+	}
+}
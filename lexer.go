@@ -2,7 +2,10 @@ package gojimongo
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 type Lexer struct {
@@ -112,7 +115,11 @@ func (l *Lexer) Run(value string) error {
 					l.tokens = append(l.tokens, FALSE)
 				default:
 					l.lexemes = append(l.lexemes, identifier)
-					l.tokens = append(l.tokens, IDENTIFIER)
+					if fn, ok := functionTokens[identifier]; ok {
+						l.tokens = append(l.tokens, fn)
+					} else {
+						l.tokens = append(l.tokens, IDENTIFIER)
+					}
 				}
 				continue
 			}
@@ -128,10 +135,11 @@ func (l *Lexer) handleStringLiteral(value string, quote byte) error {
 		if value[l.curr] == '\\' { // Handle escaped characters
 			l.curr++ // Skip the backslash
 			if l.curr < len(value) {
-				// Allow escaping the quote itself
-				if value[l.curr] == quote || value[l.curr] == '\\' {
-					l.curr++ // Move past the escaped character
+				n := escapeLength(value[l.curr:], quote)
+				if n == 0 {
+					return fmt.Errorf("invalid escape sequence in string literal at position %d", l.curr)
 				}
+				l.curr += n // Move past the escaped character
 			}
 		} else {
 			l.curr++ // Move to the next character in the string
@@ -149,6 +157,82 @@ func (l *Lexer) handleStringLiteral(value string, quote byte) error {
 	return nil
 }
 
+// escapeLength reports how many bytes of s, which follows a backslash in a
+// string literal delimited by quote, form an escape sequence allowed by
+// RFC 9535, or 0 when the escape is invalid. A \u escape of a high surrogate
+// must be followed by the escape of a low surrogate.
+func escapeLength(s string, quote byte) int {
+	switch s[0] {
+	case 'b', 'f', 'n', 'r', 't', '/', '\\', quote:
+		return 1
+	case 'u':
+		r, n := unquoteUnicode(s[1:])
+		if n == 0 || n == 4 && utf16.IsSurrogate(r) || n == 10 && r == utf8.RuneError {
+			return 0
+		}
+		return n + 1
+	}
+	return 0
+}
+
+// unquote turns a STRING lexeme, which keeps its surrounding quotes, into the
+// string it denotes, resolving the escape sequences allowed by RFC 9535.
+func unquote(lexeme string) string {
+	if len(lexeme) < 2 {
+		return lexeme
+	}
+	body := lexeme[1 : len(lexeme)-1]
+	if !strings.ContainsRune(body, '\\') {
+		return body
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i+1 == len(body) {
+			b.WriteByte(body[i])
+			continue
+		}
+		i++
+		switch body[i] {
+		case 'b': b.WriteByte('\b')
+		case 'f': b.WriteByte('\f')
+		case 'n': b.WriteByte('\n')
+		case 'r': b.WriteByte('\r')
+		case 't': b.WriteByte('\t')
+		case 'u':
+			r, n := unquoteUnicode(body[i+1:])
+			if n == 0 {
+				b.WriteString("\\u")
+				continue
+			}
+			b.WriteRune(r)
+			i += n
+		default:
+			b.WriteByte(body[i])
+		}
+	}
+	return b.String()
+}
+
+// unquoteUnicode decodes the hex digits following a \u escape, including a
+// trailing low surrogate, and reports how many bytes it consumed.
+func unquoteUnicode(s string) (rune, int) {
+	if len(s) < 4 {
+		return 0, 0
+	}
+	hi, err := strconv.ParseUint(s[:4], 16, 16)
+	if err != nil {
+		return 0, 0
+	}
+	r := rune(hi)
+	if utf16.IsSurrogate(r) && len(s) >= 10 && s[4] == '\\' && s[5] == 'u' {
+		lo, err := strconv.ParseUint(s[6:10], 16, 16)
+		if err == nil {
+			return utf16.DecodeRune(r, rune(lo)), 10
+		}
+	}
+	return r, 4
+}
+
 func isDigit(char byte) bool {
 	return char <= '9' && char >= '0'
 }
@@ -70,6 +70,9 @@ func TestLexer(t *testing.T) {
 		"$.books[?@.isbn != null]": {
 			DOLLAR, DOT, IDENTIFIER, LBRACK, QUESTION_MARK, AT, DOT, IDENTIFIER, NEQ, NULL, RBRACK,
 		},
+		"$[?length(@.count) > count(@.*) && match(@.a, 'x')]": {
+			DOLLAR, LBRACK, QUESTION_MARK, LENGTH, LPAREN, AT, DOT, COUNT, RPAREN, GT, COUNT, LPAREN, AT, DOT, STAR, RPAREN, AND, MATCH, LPAREN, AT, DOT, IDENTIFIER, COMMA, STRING, RPAREN, RBRACK,
+		},
 	}
 
 	// Iterate over the map and print the lexemes and corresponding tokens
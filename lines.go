@@ -0,0 +1,194 @@
+package gojimongo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// LineError reports a line of a JSON Lines input that could not be decoded
+// or evaluated. The line is skipped and the input processed further.
+type LineError struct {
+	Line int // 1-based
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("[gojimongo][lines]: line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// LinesOption configures FilterLines and SelectLines.
+type LinesOption func(*linesConfig)
+
+type linesConfig struct {
+	workers int
+	onError func(*LineError)
+}
+
+// WithWorkers sets how many lines are evaluated concurrently. The default
+// is GOMAXPROCS.
+func WithWorkers(n int) LinesOption {
+	return func(c *linesConfig) {
+		c.workers = max(n, 1)
+	}
+}
+
+// WithLineErrors reports each malformed line to fn, in input order, instead
+// of returning them joined once the input is processed.
+func WithLineErrors(fn func(*LineError)) LinesOption {
+	return func(c *linesConfig) {
+		c.onError = fn
+	}
+}
+
+// FilterLines writes to w, unchanged, each line of the JSON Lines input r
+// q selects a node from. Each record is the root of the query, which tests
+// a record as a whole through $, as in $[?$.level == 'error'].
+//
+// Lines are evaluated concurrently by bounded workers and written in input
+// order. Blank lines are skipped; malformed lines are reported as LineError
+// without stopping the processing. Read and write errors stop it.
+func FilterLines(q Query, r io.Reader, w io.Writer, opts ...LinesOption) error {
+	return processLines(r, w, opts, func(line []byte) ([][]byte, error) {
+		nodes, err := evaluateLine(q, line)
+		if err != nil || len(nodes) == 0 {
+			return nil, err
+		}
+		return [][]byte{line}, nil
+	})
+}
+
+// SelectLines writes to w each node q selects from each line of the JSON
+// Lines input r, as a line of JSON. Records are read, and lines processed,
+// as FilterLines does.
+func SelectLines(q Query, r io.Reader, w io.Writer, opts ...LinesOption) error {
+	return processLines(r, w, opts, func(line []byte) ([][]byte, error) {
+		nodes, err := evaluateLine(q, line)
+		if err != nil {
+			return nil, err
+		}
+		out := make([][]byte, len(nodes))
+		for i, node := range nodes {
+			if out[i], err = json.Marshal(node); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	})
+}
+
+func evaluateLine(q Query, line []byte) ([]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var record any
+	if err := dec.Decode(&record); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("more than one value on the line")
+	}
+	return Evaluate(q, record)
+}
+
+type lineJob struct {
+	line   int
+	data   []byte
+	result chan lineResult
+}
+
+type lineResult struct {
+	line int
+	out  [][]byte
+	err  error
+}
+
+// processLines runs process on each non-blank line of r and writes what it
+// returns to w, one line each, in input order.
+func processLines(r io.Reader, w io.Writer, opts []LinesOption, process func([]byte) ([][]byte, error)) error {
+	config := linesConfig{workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	jobs := make(chan lineJob)
+	// pending holds the results in input order; its capacity bounds the
+	// lines read ahead of the one being written.
+	pending := make(chan chan lineResult, 2*config.workers)
+	done := make(chan struct{})
+	var readErr error
+	for range config.workers {
+		go func() {
+			for job := range jobs {
+				out, err := process(job.data)
+				job.result <- lineResult{job.line, out, err}
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		br := bufio.NewReader(r)
+		for n := 1; ; n++ {
+			data, err := br.ReadBytes('\n')
+			if line := bytes.TrimRight(data, "\r\n"); len(bytes.TrimSpace(line)) > 0 {
+				job := lineJob{n, line, make(chan lineResult, 1)}
+				select {
+				case pending <- job.result:
+				case <-done:
+					return
+				}
+				jobs <- job
+			}
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+		}
+	}()
+
+	bw := bufio.NewWriter(w)
+	var lineErrs []error
+	var writeErr error
+	for result := range pending {
+		res := <-result
+		if writeErr != nil {
+			continue
+		}
+		if res.err != nil {
+			lerr := &LineError{res.line, res.err}
+			if config.onError != nil {
+				config.onError(lerr)
+			} else {
+				lineErrs = append(lineErrs, lerr)
+			}
+			continue
+		}
+		for _, out := range res.out {
+			bw.Write(out)
+			if err := bw.WriteByte('\n'); err != nil {
+				writeErr = err
+				close(done)
+				break
+			}
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if readErr != nil {
+		return readErr
+	}
+	return errors.Join(lineErrs...)
+}
@@ -0,0 +1,103 @@
+package gojimongo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const linesInput = `{"level": "info", "latency": 120, "request": {"id": "a1"}}
+{"level": "error", "latency": 900, "request": {"id": "b2"}}
+
+{"level": "error", "latency": 90, "request": {"id": "c3"}}
+{"level": "error", "latency":
+{"level": "error", "latency": 501, "request": {"id": 12345678901234567890}}
+`
+
+func TestFilterLines(t *testing.T) {
+	c := &Compiler{}
+	q, err := c.Compile("$[?($.level == 'error' && $.latency > 500)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = FilterLines(q, strings.NewReader(linesInput), &out)
+	expected := `{"level": "error", "latency": 900, "request": {"id": "b2"}}
+{"level": "error", "latency": 501, "request": {"id": 12345678901234567890}}
+`
+	if out.String() != expected {
+		t.Errorf("FilterLines = %s; expected %s", out.String(), expected)
+	}
+	var lerr *LineError
+	if !errors.As(err, &lerr) || lerr.Line != 5 {
+		t.Errorf("FilterLines = %v; expected an error on line 5", err)
+	}
+}
+
+func TestSelectLines(t *testing.T) {
+	c := &Compiler{}
+	queries := map[string]string{
+		"$.request.id":                       "\"a1\"\n\"b2\"\n\"c3\"\n12345678901234567890\n",
+		"$[?$.latency < 100].id":             "\"c3\"\n",
+		"$[?@.latency < 100]":                "",
+		"$.request[?@ == 'a1' || @ == 'c3']": "\"a1\"\n\"c3\"\n",
+		"$.missing":                          "",
+	}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		var out bytes.Buffer
+		lines := []int{}
+		err = SelectLines(q, strings.NewReader(linesInput), &out, WithWorkers(3), WithLineErrors(func(e *LineError) {
+			lines = append(lines, e.Line)
+		}))
+		if err != nil {
+			t.Errorf("SelectLines(%q) = %v", query, err)
+		}
+		if out.String() != expected {
+			t.Errorf("SelectLines(%q) = %q; expected %q", query, out.String(), expected)
+		}
+		if len(lines) != 1 || lines[0] != 5 {
+			t.Errorf("SelectLines(%q) reported lines %v; expected [5]", query, lines)
+		}
+	}
+}
+
+func TestSelectLinesOrder(t *testing.T) {
+	var in, expected strings.Builder
+	for i := range 1000 {
+		fmt.Fprintf(&in, "{\"n\": %d, \"pad\": %q}\n", i, strings.Repeat("x", i%17*100))
+		fmt.Fprintf(&expected, "%d\n", i)
+	}
+	c := &Compiler{}
+	q, _ := c.Compile("$.n")
+	var out bytes.Buffer
+	if err := SelectLines(q, strings.NewReader(in.String()), &out, WithWorkers(8)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected.String() {
+		t.Errorf("SelectLines did not preserve the input order")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestSelectLinesWriteError(t *testing.T) {
+	var in strings.Builder
+	for i := range 10000 {
+		fmt.Fprintf(&in, "{\"n\": %d}\n", i)
+	}
+	c := &Compiler{}
+	q, _ := c.Compile("$.n")
+	if err := SelectLines(q, strings.NewReader(in.String()), failingWriter{}); err == nil || err.Error() != "disk full" {
+		t.Errorf("SelectLines = %v; expected the write error", err)
+	}
+}
@@ -0,0 +1,247 @@
+package gojimongo
+
+import (
+	"slices"
+)
+
+// MutateOption configures Set, Delete and Apply.
+type MutateOption func(*mutateConfig)
+
+type mutateConfig struct {
+	createMissing bool
+	tests         bool
+}
+
+// CreateMissing makes Set and Apply create the missing objects along a path
+// of member names, such as $.a.b.c, and the member the path ends with. It
+// has no effect on other queries.
+func CreateMissing() MutateOption {
+	return func(c *mutateConfig) {
+		c.createMissing = true
+	}
+}
+
+func (q *AbsQuery) Set(doc, value any, opts ...MutateOption) (any, error) {
+	return mutate(q, q.segments, doc, func(any) (any, bool) { return value, true }, opts)
+}
+
+func (q *RelQuery) Set(doc, value any, opts ...MutateOption) (any, error) {
+	return mutate(q, q.segments, doc, func(any) (any, bool) { return value, true }, opts)
+}
+
+func (q *AbsQuery) Delete(doc any) (any, error) {
+	return mutate(q, q.segments, doc, func(any) (any, bool) { return nil, false }, nil)
+}
+
+func (q *RelQuery) Delete(doc any) (any, error) {
+	return mutate(q, q.segments, doc, func(any) (any, bool) { return nil, false }, nil)
+}
+
+func (q *AbsQuery) Apply(doc any, fn func(old any) any, opts ...MutateOption) (any, error) {
+	return mutate(q, q.segments, doc, func(old any) (any, bool) { return fn(old), true }, opts)
+}
+
+func (q *RelQuery) Apply(doc any, fn func(old any) any, opts ...MutateOption) (any, error) {
+	return mutate(q, q.segments, doc, func(old any) (any, bool) { return fn(old), true }, opts)
+}
+
+// mutate replaces each node q selects from doc with what op returns for it,
+// or deletes it when op does not keep it. Nodes are processed in reverse
+// document order, descendants before their ancestors and the elements of an
+// array from the end, so that the paths of the nodes left to process stay
+// valid as elements shift.
+func mutate(q Query, segs []Segment, doc any, op func(old any) (any, bool), opts []MutateOption) (any, error) {
+	config := mutateConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	nodes, err := EvaluateNodes(q, doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 && config.createMissing {
+		if names, ok := namePath(segs); ok {
+			return createAt(doc, names, op), nil
+		}
+	}
+	for _, n := range reverseNodes(nodes) {
+		doc = mutateAt(doc, n.Path, op)
+	}
+	return doc, nil
+}
+
+// reverseNodes sorts nodes in reverse document order and drops the nodes
+// selected more than once.
+func reverseNodes(nodes []Node) []Node {
+	nodes = slices.Clone(nodes)
+	slices.SortStableFunc(nodes, func(a, b Node) int { return comparePaths(b.Path, a.Path) })
+	return slices.CompactFunc(nodes, func(a, b Node) bool { return comparePaths(a.Path, b.Path) == 0 })
+}
+
+// comparePaths orders paths in document order: a node comes before its
+// descendants and elements by index.
+func comparePaths(a, b NormalizedPath) int {
+	for i := range min(len(a), len(b)) {
+		switch x := a[i].(type) {
+		case int:
+			y, ok := b[i].(int)
+			if !ok {
+				return -1
+			}
+			if x != y {
+				return x - y
+			}
+		case string:
+			y, ok := b[i].(string)
+			if !ok {
+				return 1
+			}
+			if x != y {
+				return compareStrings(x, y)
+			}
+		}
+	}
+	return len(a) - len(b)
+}
+
+func compareStrings(a, b string) int {
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// mutateAt returns node with op applied to its descendant at path. Paths
+// that no longer lead to a node are left alone.
+func mutateAt(node any, path NormalizedPath, op func(old any) (any, bool)) any {
+	if len(path) == 0 {
+		value, keep := op(node)
+		if !keep {
+			return nil
+		}
+		return value
+	}
+	child, ok := evalChild(node, path[0])
+	if !ok {
+		return node
+	}
+	if len(path) > 1 {
+		return replaceChild(node, path[0], mutateAt(child, path[1:], op))
+	}
+	value, keep := op(child)
+	if !keep {
+		return deleteChild(node, path[0])
+	}
+	return replaceChild(node, path[0], value)
+}
+
+// evalChild returns the member or element of node key names.
+func evalChild(node, key any) (any, bool) {
+	if name, ok := key.(string); ok {
+		return evalMember(node, name)
+	}
+	elements, ok := evalElements(node)
+	i := key.(int)
+	if !ok || i >= len(elements) {
+		return nil, false
+	}
+	return elements[i], true
+}
+
+func replaceChild(node, key, value any) any {
+	switch n := node.(type) {
+	case map[string]any:
+		n[key.(string)] = value
+	case D:
+		for i := range n {
+			if n[i].Key == key {
+				n[i].Value = value
+				break
+			}
+		}
+	case []any:
+		n[key.(int)] = value
+	case A:
+		n[key.(int)] = value
+	}
+	return node
+}
+
+func deleteChild(node, key any) any {
+	switch n := node.(type) {
+	case map[string]any:
+		delete(n, key.(string))
+	case D:
+		i := slices.IndexFunc(n, func(e E) bool { return e.Key == key })
+		return slices.Delete(n, i, i+1)
+	case []any:
+		return slices.Delete(n, key.(int), key.(int)+1)
+	case A:
+		return slices.Delete(n, key.(int), key.(int)+1)
+	}
+	return node
+}
+
+// namePath returns the member names segs select when each segment selects
+// one member by name.
+func namePath(segs []Segment) ([]string, bool) {
+	names := make([]string, len(segs))
+	for i, seg := range segs {
+		var sel Selector
+		switch s := seg.(type) {
+		case *DotChildSegment:
+			sel = s.selector
+		case *ChildSegment:
+			if len(s.selectors) != 1 {
+				return nil, false
+			}
+			sel = s.selectors[0]
+		default:
+			return nil, false
+		}
+		switch s := sel.(type) {
+		case *NameSelector:
+			names[i] = s.value
+		case *StringExpr:
+			names[i] = unquote(s.value)
+		default:
+			return nil, false
+		}
+	}
+	return names, len(names) > 0
+}
+
+// createAt returns node with the member at the end of names set to what op
+// returns for nil, creating the objects missing on the way. Objects are
+// created as D inside D, and as map[string]any otherwise. A member on the
+// way that is not an object is left alone.
+func createAt(node any, names []string, op func(old any) (any, bool)) any {
+	if len(names) == 0 {
+		value, _ := op(node)
+		return value
+	}
+	if node == nil {
+		node = map[string]any{}
+	}
+	child, ok := evalMember(node, names[0])
+	if !ok {
+		if len(names) > 1 {
+			if _, ordered := node.(D); ordered {
+				child = D{}
+			} else {
+				child = map[string]any{}
+			}
+		}
+		switch n := node.(type) {
+		case map[string]any:
+			n[names[0]] = createAt(child, names[1:], op)
+		case D:
+			node = append(n, E{names[0], createAt(child, names[1:], op)})
+		}
+		return node
+	}
+	if _, isObject := evalMembers(child); !isObject && len(names) > 1 {
+		return node
+	}
+	return replaceChild(node, names[0], createAt(child, names[1:], op))
+}
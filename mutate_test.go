@@ -0,0 +1,120 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const mutateDocument = `{"a": [1, 2, 3, 4, 5], "b": {"c": {"d": 1}, "e": [{"d": 2}, {"x": 3}]}, "f": "s"}`
+
+func decodeMutateDocument(t *testing.T) any {
+	var doc any
+	if err := json.Unmarshal([]byte(mutateDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestQuerySet(t *testing.T) {
+	queries := map[string]string{
+		"$.f":            `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":0}`,
+		"$.a[?@ > 3]":    `{"a":[1,2,3,0,0],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$..d":           `{"a":[1,2,3,4,5],"b":{"c":{"d":0},"e":[{"d":0},{"x":3}]},"f":"s"}`,
+		"$.b..*":         `{"a":[1,2,3,4,5],"b":{"c":0,"e":0},"f":"s"}`,
+		"$.a[-1]":        `{"a":[1,2,3,4,0],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$.missing.deep": `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$":              `0`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		doc, err := q.Set(decodeMutateDocument(t), 0)
+		if err != nil {
+			t.Errorf("Set(%q) = %v", query, err)
+			continue
+		}
+		if got := mustMarshal(doc); got != expected {
+			t.Errorf("Set(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+}
+
+func TestQueryDelete(t *testing.T) {
+	queries := map[string]string{
+		"$.f":           `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]}}`,
+		"$.a[?@ != 3]":  `{"a":[3],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$.a[1,3,1]":    `{"a":[1,3,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$.a[::2]":      `{"a":[2,4],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$..d":          `{"a":[1,2,3,4,5],"b":{"c":{},"e":[{},{"x":3}]},"f":"s"}`,
+		"$..[?@.d]":     `{"a":[1,2,3,4,5],"b":{"e":[{"x":3}]},"f":"s"}`,
+		"$..*":          `{}`,
+		"$.b.e[?@.x].x": `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{}]},"f":"s"}`,
+		"$":             `null`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		doc, err := q.Delete(decodeMutateDocument(t))
+		if err != nil {
+			t.Errorf("Delete(%q) = %v", query, err)
+			continue
+		}
+		if got := mustMarshal(doc); got != expected {
+			t.Errorf("Delete(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+}
+
+func TestQueryApply(t *testing.T) {
+	c := &Compiler{}
+	q, _ := c.Compile("$.a[1:3]")
+	doc, err := q.Apply(decodeMutateDocument(t), func(old any) any {
+		return old.(float64) * 10
+	})
+	if got, expected := mustMarshal(doc), `{"a":[1,20,30,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`; err != nil || got != expected {
+		t.Errorf("Apply($.a[1:3]) = %s, %v; expected %s", got, err, expected)
+	}
+
+	ordered := D{{"z", 1}, {"a", A{D{{"k", 1}}, D{{"k", 2}}}}}
+	q, _ = c.Compile("$.a[?@.k == 1]")
+	doc, err = q.Delete(ordered)
+	if got, expected := mustMarshal(doc), `{"z":1,"a":[{"k":2}]}`; err != nil || got != expected {
+		t.Errorf("Delete on D = %s, %v; expected %s", got, err, expected)
+	}
+}
+
+func TestQuerySetCreateMissing(t *testing.T) {
+	queries := map[string]string{
+		"$.b.c.d":      `{"a":[1,2,3,4,5],"b":{"c":{"d":true},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$.b.x.y['z']": `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}],"x":{"y":{"z":true}}},"f":"s"}`,
+		"$.new.deep":   `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s","new":{"deep":true}}`,
+		"$.f.x":        `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+		"$.b.e[0].y":   `{"a":[1,2,3,4,5],"b":{"c":{"d":1},"e":[{"d":2},{"x":3}]},"f":"s"}`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		doc, err := q.Set(decodeMutateDocument(t), true, CreateMissing())
+		if err != nil {
+			t.Errorf("Set(%q) = %v", query, err)
+			continue
+		}
+		if got := mustMarshal(doc); got != expected {
+			t.Errorf("Set(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+	q, _ := c.Compile("$.a.b")
+	doc, _ := q.Set(D{{"z", 0}}, 1, CreateMissing())
+	if got := mustMarshal(doc); got != `{"z":0,"a":{"b":1}}` {
+		t.Errorf("Set($.a.b) on D = %s", got)
+	}
+}
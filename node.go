@@ -0,0 +1,112 @@
+package gojimongo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NormalizedPath locates a node in a document as RFC 9535 Normalized Paths
+// do, as the member names (string) and array indexes (int) leading to it
+// from the root. The root's path is empty.
+type NormalizedPath []any
+
+// Node is a node a query selects along with its location.
+type Node struct {
+	Path  NormalizedPath
+	Value any
+}
+
+func pathError(value string) error {
+	return fmt.Errorf("[gojimongo][path]: %s", value)
+}
+
+// child returns the path of the member or element key of the node at p.
+func (p NormalizedPath) child(key any) NormalizedPath {
+	path := make(NormalizedPath, len(p)+1)
+	copy(path, p)
+	path[len(p)] = key
+	return path
+}
+
+// String renders p as a Normalized Path, e.g. $['store']['book'][2].
+func (p NormalizedPath) String() string {
+	var b strings.Builder
+	b.WriteByte('$')
+	for _, key := range p {
+		switch key := key.(type) {
+		case int:
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(key))
+			b.WriteByte(']')
+		case string:
+			b.WriteString("['")
+			writeNormalizedName(&b, key)
+			b.WriteString("']")
+		}
+	}
+	return b.String()
+}
+
+// writeNormalizedName escapes a member name as RFC 9535 section 2.7 requires.
+func writeNormalizedName(b *strings.Builder, name string) {
+	for _, r := range name {
+		switch r {
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+}
+
+// Pointer renders p as a JSON Pointer (RFC 6901), e.g. /store/book/2. The
+// root's pointer is the empty string.
+func (p NormalizedPath) Pointer() string {
+	var b strings.Builder
+	for _, key := range p {
+		b.WriteByte('/')
+		switch key := key.(type) {
+		case int:
+			b.WriteString(strconv.Itoa(key))
+		case string:
+			b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(key))
+		}
+	}
+	return b.String()
+}
+
+// Dotted renders p as a MongoDB dotted path, e.g. store.book.2. It fails on
+// member names a dotted path cannot hold: empty names, names containing a
+// dot and names starting with a dollar sign.
+func (p NormalizedPath) Dotted() (string, error) {
+	fields := make([]string, len(p))
+	for i, key := range p {
+		switch key := key.(type) {
+		case int:
+			fields[i] = strconv.Itoa(key)
+		case string:
+			if key == "" || strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+				return "", pathError(fmt.Sprintf("%s: %s", p[:i+1], MONGO_ERROR_FIELD_NAME))
+			}
+			fields[i] = key
+		}
+	}
+	return strings.Join(fields, "."), nil
+}
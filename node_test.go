@@ -0,0 +1,93 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNormalizedPath(t *testing.T) {
+	paths := map[string][3]string{
+		"":                   {"$", "", ""},
+		"store book 2 title": {"$['store']['book'][2]['title']", "/store/book/2/title", "store.book.2.title"},
+		"a/b m~n":            {"$['a/b']['m~n']", "/a~1b/m~0n", "a/b.m~n"},
+		"it's back\\slash":   {`$['it\'s']['back\\slash']`, "/it's/back\\slash", "it's.back\\slash"},
+		"tab\t nul\x00":      {`$['tab\t']['nul\u0000']`, "/tab\t/nul\x00", "tab\t.nul\x00"},
+	}
+	for keys, expected := range paths {
+		var p NormalizedPath
+		for _, key := range strings.Split(keys, " ") {
+			if key == "" {
+				break
+			}
+			if key == "2" {
+				p = append(p, 2)
+				continue
+			}
+			p = append(p, key)
+		}
+		if s := p.String(); s != expected[0] {
+			t.Errorf("%q.String() = %s; expected %s", keys, s, expected[0])
+		}
+		if s := p.Pointer(); s != expected[1] {
+			t.Errorf("%q.Pointer() = %s; expected %s", keys, s, expected[1])
+		}
+		if s, err := p.Dotted(); err != nil || s != expected[2] {
+			t.Errorf("%q.Dotted() = %s, %v; expected %s", keys, s, err, expected[2])
+		}
+	}
+	for _, p := range []NormalizedPath{{"a.b"}, {"a", "$b"}, {""}} {
+		if _, err := p.Dotted(); err == nil {
+			t.Errorf("%s.Dotted() succeeded; expected an error", p)
+		}
+	}
+}
+
+func TestEvaluateNodes(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(evalDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string][]string{
+		"$..author": {
+			"$['store']['book'][0]['author']",
+			"$['store']['book'][1]['author']",
+			"$['store']['book'][2]['author']",
+			"$['store']['book'][3]['author']",
+		},
+		"$.store..price": {
+			"$['store']['bicycle']['price']",
+			"$['store']['book'][0]['price']",
+			"$['store']['book'][1]['price']",
+			"$['store']['book'][2]['price']",
+			"$['store']['book'][3]['price']",
+		},
+		"$..book[?(@.isbn)]":    {"$['store']['book'][2]", "$['store']['book'][3]"},
+		"$..book[-1:]['title']": {"$['store']['book'][3]['title']"},
+		"$.store.*":             {"$['store']['bicycle']", "$['store']['book']"},
+		"$":                     {"$"},
+		"@.expensive":           {"$['expensive']"},
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		// Paths must not depend on map iteration order.
+		for range 3 {
+			nodes, err := q.SelectNodes(doc)
+			if err != nil {
+				t.Fatalf("SelectNodes(%q) = %v", query, err)
+			}
+			got := make([]string, len(nodes))
+			for i, n := range nodes {
+				got[i] = n.Path.String()
+			}
+			if strings.Join(got, " ") != strings.Join(expected, " ") {
+				t.Errorf("SelectNodes(%q) = %v; expected %v", query, got, expected)
+				break
+			}
+		}
+	}
+}
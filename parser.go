@@ -36,6 +36,8 @@ type Visitor interface {
 	visitTypedArrayExpr(value *TypedArrayExpr)
 	visitTypedIntExpr(value *TypedIntExpr)
 	visitTypedBoolExpr(value *TypedBoolExpr)
+	visitTypedDecimalExpr(value *TypedDecimalExpr)
+	visitTypedObjectExpr(value *TypedObjectExpr)
 	visitNullExpr(value *NullExpr)
 	visitParExpr(value *ParExpr)
 	visitFnExpr(value *FnExpr)
@@ -58,6 +60,7 @@ type Visitor interface {
 	visitWildcardSelector(value *WildCardSelector)
 	visitSliceSelector(value *SliceSelector)
 	visitNameSelector(value *NameSelector)
+	visitPointerSelector(value *PointerSelector)
 
 	visitDotChildSegment(value *DotChildSegment)
 	visitChildSegment(value *ChildSegment)
@@ -78,13 +81,26 @@ func (p *Parser) error(value string) error {
 // QUERIES
 type Query interface {
 	accept(visitor Visitor)
+	// Select returns the nodes the query selects from doc, in memory. See
+	// VisitorEval for the documents it reads.
+	Select(doc any) ([]any, error)
+	// SelectNodes is Select returning the Normalized Path of each node too.
+	SelectNodes(doc any) ([]Node, error)
+	// Set, Delete and Apply rewrite the nodes the query selects from doc, a
+	// tree of map[string]any, []any, D and A, in place. They return the
+	// document, which differs from doc when the root itself is selected or
+	// is an array losing elements. See mutate.go.
+	Set(doc, value any, opts ...MutateOption) (any, error)
+	Delete(doc any) (any, error)
+	Apply(doc any, fn func(old any) any, opts ...MutateOption) (any, error)
 }
 
 type RelQuery struct { 
 	segments  []Segment 
+	prepared  preparedCache
 }
 
-type AbsQuery struct { segments  []Segment }
+type AbsQuery struct { segments  []Segment; prepared preparedCache }
 
 // SEGMENTS
 type Segment interface{
@@ -104,6 +120,10 @@ type WildCardSelector struct {}
 type SliceSelector struct { start Expr; stop Expr; step Expr }
 type NameSelector struct { value string }
 type FilterSelector struct { cond Expr }
+// PointerSelector is a JSON Pointer reference token made of digits, built by
+// QueryFromPointer: it selects the element at index of an array, or the
+// member named after index of an object.
+type PointerSelector struct { index int }
 type FnExpr struct { name string; params []Expr }
 
 // EXPRESSIONS
@@ -278,7 +298,7 @@ func (p *Parser) dotSelector() (Selector, error) {
 
 func (p *Parser) descendantSegment() (Segment, error) {
 	selectors := []Selector{}
-	if p.matchCurr(IDENTIFIER) {
+	if p.matchName() {
 		s, err := p.dotSelector()
 		if err != nil {
 			return nil, err
@@ -361,7 +381,7 @@ func (p *Parser) filter() (Selector, error) {
 
 func (p *Parser) fn() (Expr, error) {
 	expr := &FnExpr{}
-	if p.matchCurr(IDENTIFIER) {
+	if p.matchName() {
 		lex := p.currLex()
 		expr.name = lex
 		p.advTok()
@@ -547,7 +567,7 @@ func (p *Parser) literal() (Expr, error) {
 	case TRUE: return p.true(), nil
 	case NULL: return p.null(), nil
 	case LPAREN: return p.par()
-	case IDENTIFIER: 
+	case IDENTIFIER, LENGTH, COUNT, MATCH, SEARCH: 
 	if p.matchNext(LPAREN) {
 		return p.fn()
 	} else {
@@ -645,6 +665,22 @@ func (p *Parser) typed() (Expr, error) {
 			return nil, err
 		}
 		return &TypedArrayExpr{ value: expr }, nil
+	case "double":
+		p.advTok()
+		p.advLex()
+		expr, err := p.par() 
+		if err != nil {
+			return nil, err
+		}
+		return &TypedDecimalExpr{ value: expr }, nil
+	case "object":
+		p.advTok()
+		p.advLex()
+		expr, err := p.par() 
+		if err != nil {
+			return nil, err
+		}
+		return &TypedObjectExpr{ value: expr }, nil
 	default:
 		return nil, p.error(PARSER_ERROR_EXPECTED_TYPE)
 	}
@@ -717,6 +753,11 @@ func (p *Parser) matchNext(t TokenType) bool {
 	return p.matchOffset(1, t)
 }
 
+// matchName matches an identifier or a function name read as a member name.
+func (p *Parser) matchName() bool {
+	return p.tokAccessible(0) && p.currTok().isName()
+}
+
 func (p *Parser) matchOffset(offset int, t TokenType) bool {
 	if p.tokAccessible(offset) {
 		return p.tok(offset) == t
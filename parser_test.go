@@ -4,63 +4,73 @@ import (
 	"fmt"
 )
 
-func TestParser(t *testing.T) {
-	queries := map[string]bool{
-		"$.hello":                     					true,
-		"$['hello']":                  					true,
-		"$['hello'][0]":               					true,
-		"$.store.book[0].title":       					true,
-		"$..author":                   					true,
-		"$..book[?(@.price<10)]":      					true,
-		"$..book[?(@.price > 10)]":    					true,
-		"$..book[?(@.price > 10 && @.price < 30)]": 	true,
-		"$..book[?(@.title)]":         					true,
-		"$..book[0:3]":                					true,
-		"$..book[:3]":                 					true,
-		"$..book[1:]":                 					true,
-		"$..book[::-1]":               					true,
-		"$..book[::-1(]":               				false,
-		"$..book[::-1:]":               				false,
-		"$..book[::-1,]":               				false,
-		"$[?@int(count(@.devices) >= 10)]":				true,
-		"@.store..books[?(@.price < 20 && @.author == \"John\")].title[0:10],@.store.magazines[*].title,@.store..*[?(@.published == true || length(@.title) == 5)].authors[1:5:2]": true,
-		"$[*]":                        					true,
-		"$[*,]":                        				false,
-		"$..":                        					false,
-		"$....":                        				false,
-		"@.price":                     					true,
-		"@.books[1].title":            					true,
-		"$..book[?(@.price==null)]":   					true,
-		"$..book[?(@.price!=null)]":   					true,
-		"$..book[?(@.available==true)]": 				true,
-		"$..book[?(@.available==false)]": 				true,
-		"$..book[?(@.price>=10)]":     					true,
-		"$..book[?(@.price<=10)]":     					true,
-		"$..[0]":                      					true,
-		"$..book[::]":                				true, // missing slice values
-		"$.store..book":               					true, // double dot in middle
+// parserQueries maps queries to whether they should compile.
+var parserQueries = map[string]bool{
+	"$.hello":                     					true,
+	"$['hello']":                  					true,
+	"$['hello'][0]":               					true,
+	"$.store.book[0].title":       					true,
+	"$..author":                   					true,
+	"$..book[?(@.price<10)]":      					true,
+	"$..book[?(@.price > 10)]":    					true,
+	"$..book[?(@.price > 10 && @.price < 30)]": 	true,
+	"$..book[?(@.title)]":         					true,
+	"$..book[0:3]":                					true,
+	"$..book[:3]":                 					true,
+	"$..book[1:]":                 					true,
+	"$..book[::-1]":               					true,
+	"$..book[::-1(]":               				false,
+	"$..book[::-1:]":               				false,
+	"$..book[::-1,]":               				false,
+	"$[?@int(count(@.devices) >= 10)]":				true,
+	"@.store..books[?(@.price < 20 && @.author == \"John\")].title[0:10],@.store.magazines[*].title,@.store..*[?(@.published == true || length(@.title) == 5)].authors[1:5:2]": true,
+	"$[*]":                        					true,
+	"$[*,]":                        				false,
+	"$..":                        					false,
+	"$....":                        				false,
+	"@.price":                     					true,
+	"@.books[1].title":            					true,
+	"$..book[?(@.price==null)]":   					true,
+	"$..book[?(@.price!=null)]":   					true,
+	"$..book[?(@.available==true)]": 				true,
+	"$..book[?(@.available==false)]": 				true,
+	"$..book[?(@.price>=10)]":     					true,
+	"$..book[?(@.price<=10)]":     					true,
+	"$..[0]":                      					true,
+	"$..book[::]":                				true, // missing slice values
+	"$.store..book":               					true, // double dot in middle
 
-		// "$..book[?(@.price - 1 < 9)]": true,
-		"$.length()":                  					false,
-		"$.store.length()":            					false,
-		// Invalid queries
-		"$..book[?(@.price >> 10)]":   					false, // invalid operator
-		"$..book[?(@.price = 10)]":    					false, // single =
-		"$..book[?(@.price >< 10)]":   					false,
-		"$..book[?(@.price <)]":       					false,
-		"$..book[?()]":                					false,
-		"$['unclosed":                 					false,
-		"$.store.[book]":              					false,
-		"$..book[?(@.price &&)]":      					false,
-		"$..book[?(&& @.price)]":      					false,
-		"$[?(@.price < 10)":           					false, // unclosed filter
-		"$[]": 						   					false,
-		"":                          					false, // empty
-		"$.name[?(@int(@.name) > @str($.name))]":		true,
-		"$.name[@str(5)]": true,
-	}
+	// "$..book[?(@.price - 1 < 9)]": true,
+	"$.length()":                  					false,
+	"$.store.length()":            					false,
+	// Invalid queries
+	"$..book[?(@.price >> 10)]":   					false, // invalid operator
+	"$..book[?(@.price = 10)]":    					false, // single =
+	"$..book[?(@.price >< 10)]":   					false,
+	"$..book[?(@.price <)]":       					false,
+	"$..book[?()]":                					false,
+	"$['unclosed":                 					false,
+	"$.store.[book]":              					false,
+	"$..book[?(@.price &&)]":      					false,
+	"$..book[?(&& @.price)]":      					false,
+	"$[?(@.price < 10)":           					false, // unclosed filter
+	"$[]": 						   					false,
+	"":                          					false, // empty
+	"$.name[?(@int(@.name) > @str($.name))]":		true,
+	"$.name[@str(5)]": true,
+	"$['a\\'b']":                                 	true,
+	"$[\"a\\\"b\\/c\\n\"]":                         	true,
+	"$['\\u00e9\\uD83D\\uDE00']":                   	true,
+	"$['a\\d']":                                   	false, // invalid escape
+	"$['a\\\"']":                                  	false, // escaped double quote in single quotes
+	"$['\\u00g1']":                                	false,
+	"$['\\uD83D']":                                	false, // lone high surrogate
+	"$['\\uDE00\\uD83D']":                         	false,
+}
+
+func TestParser(t *testing.T) {
 	c := &Compiler{}
-	for query, shouldPass := range queries {
+	for query, shouldPass := range parserQueries {
 		_, err := c.Compile(query)
 		if ((err == nil) && !shouldPass) || ((err != nil) && shouldPass) {
 			fmt.Printf("Tokens: %s\n", c.lexer.tokens)
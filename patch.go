@@ -0,0 +1,348 @@
+package gojimongo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	PATCH_ERROR_OP      = "unknown operation"
+	PATCH_ERROR_POINTER = "invalid JSON Pointer"
+	PATCH_ERROR_MISSING = "no value at the path"
+	PATCH_ERROR_PARENT  = "no object or array holds the path"
+	PATCH_ERROR_INDEX   = "array index out of range"
+	PATCH_ERROR_MOVE    = "a value cannot be moved into itself"
+	PATCH_ERROR_TEST    = "value differs"
+)
+
+// PatchOp is a JSON Patch (RFC 6902) operation.
+type PatchOp struct {
+	Op    string `json:"op"` // add, remove, replace, move, copy or test
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"` // the source of move and copy
+	Value any    `json:"value,omitempty"`
+}
+
+// MarshalJSON writes the value of add, replace and test operations even when
+// it is null, and leaves it out of the others.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	d := D{{"op", op.Op}, {"path", op.Path}}
+	if op.Op == "move" || op.Op == "copy" {
+		d = append(d, E{"from", op.From})
+	}
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		d = append(d, E{"value", op.Value})
+	}
+	return d.MarshalJSON()
+}
+
+// WithTestOps makes PatchSet, PatchDelete and PatchUpdate start the patch
+// with a test operation for each node they change, guarding against the
+// document having been modified since the patch was built.
+func WithTestOps() MutateOption {
+	return func(c *mutateConfig) {
+		c.tests = true
+	}
+}
+
+// PatchSet returns the patch Set would apply to doc: a replace operation for
+// each node q selects. With CreateMissing, a path of member names missing
+// from doc is added.
+func PatchSet(q Query, doc, value any, opts ...MutateOption) ([]PatchOp, error) {
+	return patch(q, doc, func(any) (any, bool) { return value, true }, opts)
+}
+
+// PatchDelete returns the patch Delete would apply to doc: a remove operation
+// for each node q selects, elements of arrays from the end.
+func PatchDelete(q Query, doc any, opts ...MutateOption) ([]PatchOp, error) {
+	return patch(q, doc, func(any) (any, bool) { return nil, false }, opts)
+}
+
+// PatchUpdate returns the patch Apply would apply to doc: a replace operation
+// setting each node q selects to what fn returns for it.
+func PatchUpdate(q Query, doc any, fn func(old any) any, opts ...MutateOption) ([]PatchOp, error) {
+	return patch(q, doc, func(old any) (any, bool) { return fn(old), true }, opts)
+}
+
+// patch builds the operations of mutate. They are ordered as mutate applies
+// them, so each path holds when its operation is applied.
+func patch(q Query, doc any, op func(old any) (any, bool), opts []MutateOption) ([]PatchOp, error) {
+	config := mutateConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	nodes, err := EvaluateNodes(q, doc)
+	if err != nil {
+		return nil, err
+	}
+	tests, ops := []PatchOp{}, []PatchOp{}
+	if len(nodes) == 0 && config.createMissing {
+		var segs []Segment
+		switch q := q.(type) {
+		case *AbsQuery:
+			segs = q.segments
+		case *RelQuery:
+			segs = q.segments
+		}
+		if names, ok := namePath(segs); ok {
+			if add, ok := patchCreate(doc, names, op); ok {
+				ops = append(ops, add)
+			}
+		}
+	}
+	for _, n := range reverseNodes(nodes) {
+		pointer := n.Path.Pointer()
+		if config.tests {
+			tests = append(tests, PatchOp{Op: "test", Path: pointer, Value: n.Value})
+		}
+		if value, keep := op(n.Value); keep {
+			ops = append(ops, PatchOp{Op: "replace", Path: pointer, Value: value})
+		} else {
+			ops = append(ops, PatchOp{Op: "remove", Path: pointer})
+		}
+	}
+	return append(tests, ops...), nil
+}
+
+// patchCreate returns the add operation creating the first member of names
+// missing from doc, holding the objects down to the last member.
+func patchCreate(doc any, names []string, op func(old any) (any, bool)) (PatchOp, bool) {
+	var path NormalizedPath
+	node := doc
+	for i, name := range names {
+		if _, ok := evalMembers(node); !ok {
+			return PatchOp{}, false
+		}
+		child, ok := evalMember(node, name)
+		if !ok {
+			var object any
+			if _, ordered := node.(D); ordered && i+1 < len(names) {
+				object = D{}
+			}
+			value := createAt(object, names[i+1:], op)
+			return PatchOp{Op: "add", Path: path.child(name).Pointer(), Value: value}, true
+		}
+		path, node = path.child(name), child
+	}
+	return PatchOp{}, false
+}
+
+func patchError(i int, op PatchOp, reason string) error {
+	return fmt.Errorf("[gojimongo][patch]: operation %d (%s %s): %s", i, op.Op, op.Path, reason)
+}
+
+// ApplyPatch applies patch to doc, a tree of map[string]any, []any, D and A,
+// and returns the patched document. The patch applies as a whole or not at
+// all: doc itself is left unchanged, the operations working on a copy.
+// Values are compared by test as the evaluator compares them, numbers by
+// value whatever their Go type.
+func ApplyPatch(doc any, patch []PatchOp) (any, error) {
+	doc = deepCopy(doc)
+	for i, op := range patch {
+		var err error
+		doc, err = applyPatchOp(doc, op)
+		if err != nil {
+			return nil, patchError(i, op, err.Error())
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOp(doc any, op PatchOp) (any, error) {
+	path, err := pointerTokens(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return patchAdd(doc, path, deepCopy(op.Value))
+	case "remove":
+		if _, err := patchGet(doc, path); err != nil {
+			return nil, err
+		}
+		return mutateAt(doc, resolveIndexes(doc, path), func(any) (any, bool) { return nil, false }), nil
+	case "replace":
+		if _, err := patchGet(doc, path); err != nil {
+			return nil, err
+		}
+		value := deepCopy(op.Value)
+		return mutateAt(doc, resolveIndexes(doc, path), func(any) (any, bool) { return value, true }), nil
+	case "move", "copy":
+		from, err := pointerTokens(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := patchGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return patchAdd(doc, path, deepCopy(value))
+		}
+		if len(from) < len(path) && slices.Equal(from, path[:len(from)]) {
+			return nil, errors.New(PATCH_ERROR_MOVE)
+		}
+		doc = mutateAt(doc, resolveIndexes(doc, from), func(any) (any, bool) { return nil, false })
+		return patchAdd(doc, path, value)
+	case "test":
+		value, err := patchGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !evalEqual(value, op.Value) {
+			return nil, errors.New(PATCH_ERROR_TEST)
+		}
+		return doc, nil
+	}
+	return nil, errors.New(PATCH_ERROR_OP)
+}
+
+// pointerUnescaper unescapes the reference tokens of a JSON Pointer.
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// pointerTokens splits a JSON Pointer into its unescaped reference tokens.
+// A '~' must be escaped as "~0", and a '/' as "~1".
+func pointerTokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%s %q", PATCH_ERROR_POINTER, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		if strings.Count(token, "~") != strings.Count(token, "~0")+strings.Count(token, "~1") {
+			return nil, fmt.Errorf("%s %q", PATCH_ERROR_POINTER, pointer)
+		}
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the reference token of an array element, which must not
+// have leading zeros.
+func arrayIndex(token string, n int) (int, bool) {
+	if token == "" || len(token) > 1 && token[0] == '0' || strings.Trim(token, "0123456789") != "" {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	return i, err == nil && i < n
+}
+
+// patchGet returns the value at path.
+func patchGet(doc any, path []string) (any, error) {
+	node := doc
+	for _, token := range path {
+		if elements, ok := evalElements(node); ok {
+			i, ok := arrayIndex(token, len(elements))
+			if !ok {
+				return nil, errors.New(PATCH_ERROR_INDEX)
+			}
+			node = elements[i]
+			continue
+		}
+		child, ok := evalMember(node, token)
+		if !ok {
+			return nil, errors.New(PATCH_ERROR_MISSING)
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// resolveIndexes returns path, which leads to a value of doc, as a
+// NormalizedPath.
+func resolveIndexes(doc any, path []string) NormalizedPath {
+	resolved := make(NormalizedPath, len(path))
+	node := doc
+	for i, token := range path {
+		if elements, ok := evalElements(node); ok {
+			index, _ := arrayIndex(token, len(elements))
+			resolved[i], node = index, elements[index]
+			continue
+		}
+		resolved[i] = token
+		node, _ = evalMember(node, token)
+	}
+	return resolved
+}
+
+// patchAdd adds value at path: it replaces the root or an existing member,
+// creates a member, or inserts an element, "-" appending it.
+func patchAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := patchGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	parentPath := resolveIndexes(doc, path[:len(path)-1])
+	if elements, ok := evalElements(parent); ok {
+		i := len(elements)
+		if last != "-" {
+			if i, ok = arrayIndex(last, len(elements)+1); !ok {
+				return nil, errors.New(PATCH_ERROR_INDEX)
+			}
+		}
+		return mutateAt(doc, parentPath, func(old any) (any, bool) {
+			switch old := old.(type) {
+			case A:
+				return slices.Insert(old, i, value), true
+			case []any:
+				return slices.Insert(old, i, value), true
+			}
+			return old, true
+		}), nil
+	}
+	if _, ok := evalMembers(parent); !ok {
+		return nil, errors.New(PATCH_ERROR_PARENT)
+	}
+	return mutateAt(doc, parentPath, func(old any) (any, bool) {
+		switch old := old.(type) {
+		case map[string]any:
+			old[last] = value
+		case D:
+			if _, exists := old.Get(last); !exists {
+				return append(old, E{last, value}), true
+			}
+			return replaceChild(old, last, value), true
+		}
+		return old, true
+	}), nil
+}
+
+// deepCopy copies a tree of map[string]any, []any, D and A.
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, member := range v {
+			c[k] = deepCopy(member)
+		}
+		return c
+	case D:
+		c := make(D, len(v))
+		for i, e := range v {
+			c[i] = E{e.Key, deepCopy(e.Value)}
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, element := range v {
+			c[i] = deepCopy(element)
+		}
+		return c
+	case A:
+		c := make(A, len(v))
+		for i, element := range v {
+			c[i] = deepCopy(element)
+		}
+		return c
+	}
+	return value
+}
@@ -0,0 +1,137 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const patchDocument = `{"items": [{"sku": "X", "qty": 1}, {"sku": "Y", "qty": 2}, {"sku": "X", "qty": 5}], "meta": {"a~b": 1, "c/d": 2}}`
+
+func TestPatchGeneration(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(patchDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	c := &Compiler{}
+	compile := func(query string) Query {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		return q
+	}
+	patches := map[string]func() ([]PatchOp, error){
+		`[{"op":"replace","path":"/items/2/qty","value":3},{"op":"replace","path":"/items/0/qty","value":3}]`: func() ([]PatchOp, error) {
+			return PatchSet(compile("$.items[?(@.sku=='X')].qty"), doc, 3)
+		},
+		`[{"op":"test","path":"/items/2","value":{"qty":5,"sku":"X"}},{"op":"test","path":"/items/0","value":{"qty":1,"sku":"X"}},{"op":"remove","path":"/items/2"},{"op":"remove","path":"/items/0"}]`: func() ([]PatchOp, error) {
+			return PatchDelete(compile("$.items[?(@.sku=='X')]"), doc, WithTestOps())
+		},
+		`[{"op":"replace","path":"/meta/c~1d","value":20},{"op":"replace","path":"/meta/a~0b","value":10}]`: func() ([]PatchOp, error) {
+			return PatchUpdate(compile("$.meta.*"), doc, func(old any) any { return old.(float64) * 10 })
+		},
+		`[{"op":"add","path":"/meta/x","value":{"y":null}}]`: func() ([]PatchOp, error) {
+			return PatchSet(compile("$.meta.x.y"), doc, nil, CreateMissing())
+		},
+		`[]`: func() ([]PatchOp, error) {
+			return PatchSet(compile("$.meta.x.y"), doc, nil)
+		},
+	}
+	for expected, build := range patches {
+		ops, err := build()
+		if err != nil {
+			t.Errorf("%s: %v", expected, err)
+			continue
+		}
+		if got := mustMarshal(ops); got != expected {
+			t.Errorf("patch = %s; expected %s", got, expected)
+		}
+		patched, err := ApplyPatch(doc, ops)
+		if err != nil {
+			t.Errorf("ApplyPatch(%s) = %v", mustMarshal(ops), err)
+			continue
+		}
+		if mustMarshal(patched) == mustMarshal(doc) && len(ops) > 0 {
+			t.Errorf("ApplyPatch(%s) left the document unchanged", mustMarshal(ops))
+		}
+	}
+	if mustMarshal(doc) != mustMarshal(mustUnmarshal(patchDocument)) {
+		t.Errorf("ApplyPatch modified the document it was given")
+	}
+}
+
+func TestPatchMatchesMutation(t *testing.T) {
+	c := &Compiler{}
+	for _, query := range []string{"$..qty", "$.items[::2]", "$..[?@.sku == 'X']", "$.items[0,0,1]", "$.meta"} {
+		q, _ := c.Compile(query)
+		ops, err := PatchDelete(q, mustUnmarshal(patchDocument), WithTestOps())
+		if err != nil {
+			t.Fatalf("PatchDelete(%q) = %v", query, err)
+		}
+		patched, err := ApplyPatch(mustUnmarshal(patchDocument), ops)
+		if err != nil {
+			t.Errorf("ApplyPatch(%s) = %v", mustMarshal(ops), err)
+			continue
+		}
+		deleted, _ := q.Delete(mustUnmarshal(patchDocument))
+		if mustMarshal(patched) != mustMarshal(deleted) {
+			t.Errorf("%q: patched %s, deleted %s", query, mustMarshal(patched), mustMarshal(deleted))
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	patches := map[string]string{
+		`[{"op":"add","path":"/a/1","value":9}]`:                                    `{"a":[1,9,2],"o":{"k":"v"}}`,
+		`[{"op":"add","path":"/a/-","value":9}]`:                                    `{"a":[1,2,9],"o":{"k":"v"}}`,
+		`[{"op":"add","path":"/o/n","value":null}]`:                                 `{"a":[1,2],"o":{"k":"v","n":null}}`,
+		`[{"op":"add","path":"","value":[]}]`:                                       `[]`,
+		`[{"op":"move","from":"/o/k","path":"/a/0"}]`:                               `{"a":["v",1,2],"o":{}}`,
+		`[{"op":"copy","from":"/o","path":"/p"}]`:                                   `{"a":[1,2],"o":{"k":"v"},"p":{"k":"v"}}`,
+		`[{"op":"test","path":"/a","value":[1.0,2]},{"op":"remove","path":"/a/0"}]`: `{"a":[2],"o":{"k":"v"}}`,
+		`[{"op":"test","path":"/a/0","value":2}]`:                                   ``,
+		`[{"op":"remove","path":"/a/2"}]`:                                           ``,
+		`[{"op":"remove","path":"/a/01"}]`:                                          ``,
+		`[{"op":"add","path":"/a/3","value":0}]`:                                    ``,
+		`[{"op":"replace","path":"/x","value":0}]`:                                  ``,
+		`[{"op":"add","path":"/x/y","value":0}]`:                                    ``,
+		`[{"op":"move","from":"/o","path":"/o/k"}]`:                                 ``,
+		`[{"op":"add","path":"a","value":0}]`:                                       ``,
+		`[{"op":"add","path":"/o/~2","value":0}]`:                                   ``,
+		`[{"op":"add","path":"/o/k~","value":0}]`:                                   ``,
+		`[{"op":"copy","from":"/~o","path":"/p"}]`:                                  ``,
+		`[{"op":"frobnicate","path":"/a"}]`:                                         ``,
+		`[{"op":"add","path":"/o/z","value":0},{"op":"remove","path":"/nope"}]`:     ``,
+	}
+	for patch, expected := range patches {
+		var ops []PatchOp
+		if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+		doc := mustUnmarshal(`{"a":[1,2],"o":{"k":"v"}}`)
+		patched, err := ApplyPatch(doc, ops)
+		if expected == "" {
+			if err == nil || !strings.HasPrefix(err.Error(), "[gojimongo][patch]") {
+				t.Errorf("ApplyPatch(%s) = %s, %v; expected an error", patch, mustMarshal(patched), err)
+			}
+			if mustMarshal(doc) != `{"a":[1,2],"o":{"k":"v"}}` {
+				t.Errorf("ApplyPatch(%s) modified the document", patch)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ApplyPatch(%s) = %v", patch, err)
+			continue
+		}
+		if got := mustMarshal(patched); got != expected {
+			t.Errorf("ApplyPatch(%s) = %s; expected %s", patch, got, expected)
+		}
+	}
+}
+
+func mustUnmarshal(s string) any {
+	var v any
+	json.Unmarshal([]byte(s), &v)
+	return v
+}
@@ -0,0 +1,110 @@
+package gojimongo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	POINTER_ERROR_SELECTOR = "only names and non-negative indexes convert to a JSON Pointer"
+	POINTER_ERROR_SEGMENT  = "descendant segments do not convert to a JSON Pointer"
+)
+
+func pointerError(value string) error {
+	return fmt.Errorf("[gojimongo][pointer]: %s", value)
+}
+
+// QueryFromPointer converts a JSON Pointer (RFC 6901) into the query
+// selecting the value it references, one ChildSegment per reference token.
+// A token made of digits references an element of an array or a member of
+// an object, whichever its parent is, so it converts to a PointerSelector
+// selecting either. The segment [0,'0'] selects the same node, but with two
+// selectors it is not singular, while the PointerSelector is.
+func QueryFromPointer(pointer string) (*AbsQuery, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, pointerError(err.Error())
+	}
+	q := &AbsQuery{segments: make([]Segment, len(tokens))}
+	for i, token := range tokens {
+		if index, ok := arrayIndex(token, int(^uint(0)>>1)); ok {
+			q.segments[i] = &ChildSegment{selectors: []Selector{&PointerSelector{index: index}}}
+			continue
+		}
+		var b strings.Builder
+		b.WriteByte('\'')
+		writeNormalizedName(&b, token)
+		b.WriteByte('\'')
+		q.segments[i] = &ChildSegment{selectors: []Selector{&StringExpr{value: b.String()}}}
+	}
+	return q, nil
+}
+
+// PointerOf converts a query of names and non-negative indexes, a singular
+// query, into the JSON Pointer referencing the node it selects. The
+// PointerSelectors QueryFromPointer builds, and segments selecting both an
+// index and the member named after it, convert to their token. Wildcards,
+// slices, filters, negative indexes and descendant segments fail.
+func PointerOf(q Query) (string, error) {
+	var segs []Segment
+	switch q := q.(type) {
+	case *AbsQuery:
+		segs = q.segments
+	case *RelQuery:
+		segs = q.segments
+	}
+	path := make(NormalizedPath, len(segs))
+	for i, seg := range segs {
+		var sels []Selector
+		switch s := seg.(type) {
+		case *DotChildSegment:
+			sels = []Selector{s.selector}
+		case *ChildSegment:
+			sels = s.selectors
+		default:
+			return "", pointerError(fmt.Sprintf("%s: %s", nodeName(seg), POINTER_ERROR_SEGMENT))
+		}
+		key, err := pointerKey(sels)
+		if err != nil {
+			return "", err
+		}
+		path[i] = key
+	}
+	return path.Pointer(), nil
+}
+
+// pointerKey returns the member name or index the selectors of a segment
+// select.
+func pointerKey(sels []Selector) (any, error) {
+	keys := make([]any, len(sels))
+	for i, sel := range sels {
+		switch s := sel.(type) {
+		case *NameSelector:
+			keys[i] = s.value
+		case *StringExpr:
+			keys[i] = unquote(s.value)
+		case *IntExpr:
+			keys[i] = s.value
+		case *PointerSelector:
+			keys[i] = s.index
+		default:
+			return nil, pointerError(fmt.Sprintf("%s: %s", nodeName(sel), POINTER_ERROR_SELECTOR))
+		}
+	}
+	if len(keys) == 1 {
+		return keys[0], nil
+	}
+	if len(keys) == 2 {
+		index, isIndex := keys[0].(int)
+		name, isName := keys[1].(string)
+		if !isIndex {
+			index, isIndex = keys[1].(int)
+			name, isName = keys[0].(string)
+		}
+		if isIndex && isName && strconv.Itoa(index) == name {
+			return index, nil
+		}
+	}
+	return nil, pointerError(fmt.Sprintf("ChildSegment: %s", POINTER_ERROR_SELECTOR))
+}
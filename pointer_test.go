@@ -0,0 +1,128 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQueryFromPointer(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(evalDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	pointers := map[string][2]string{
+		"":                    {`{}`, ``},
+		"/store/book/0/title": {`{"store.book.0.title":{"$exists":true}}`, `["Sayings of the Century"]`},
+		"/store/bicycle":      {`{"store.bicycle":{"$exists":true}}`, `[{"color":"red","price":399}]`},
+		"/store/book/01":      {`{"store.book.01":{"$exists":true}}`, `[]`},
+		"/store/book/-":       {`{"store.book.-":{"$exists":true}}`, `[]`},
+	}
+	for pointer, expected := range pointers {
+		q, err := QueryFromPointer(pointer)
+		if err != nil {
+			t.Errorf("QueryFromPointer(%q) = %v", pointer, err)
+			continue
+		}
+		filter, err := MongoFilter(q)
+		if err != nil || filter.String() != expected[0] {
+			t.Errorf("MongoFilter(%q) = %s, %v; expected %s", pointer, filter, err, expected[0])
+		}
+		if pointer != "" {
+			nodes, _ := q.Select(doc)
+			if got := mustMarshal(nodes); got != expected[1] {
+				t.Errorf("Select(%q) = %s; expected %s", pointer, got, expected[1])
+			}
+		}
+		back, err := PointerOf(q)
+		if err != nil || back != pointer {
+			t.Errorf("PointerOf(QueryFromPointer(%q)) = %q, %v", pointer, back, err)
+		}
+	}
+	q, _ := QueryFromPointer("/a~1b/m~0n/0")
+	nodes, _ := q.Select(map[string]any{"a/b": map[string]any{"m~n": map[string]any{"0": "member"}}})
+	if got := mustMarshal(nodes); got != `["member"]` {
+		t.Errorf(`Select("/a~1b/m~0n/0") = %s; expected ["member"]`, got)
+	}
+	for _, pointer := range []string{"a/b", "/a~2", "/a~"} {
+		if _, err := QueryFromPointer(pointer); err == nil {
+			t.Errorf("QueryFromPointer(%q) succeeded; expected an error", pointer)
+		}
+	}
+}
+
+func TestPointerOf(t *testing.T) {
+	queries := map[string]string{
+		"$":                     "",
+		"$.store.book[0].title": "/store/book/0/title",
+		"$['a/b']['m~n']":       "/a~1b/m~0n",
+		"@.a[2]":                "/a/2",
+		"$.a['0', 0]":           "/a/0",
+		"$..a":                  "DescendantSegment",
+		"$.a[*]":                "WildCardSelector",
+		"$.a[1:2]":              "SliceSelector",
+		"$.a[?@.b]":             "FilterSelector",
+		"$.a[-1]":               "MinusExpr",
+		"$.a['b','c']":          "ChildSegment",
+		"$.a[0,'1']":            "ChildSegment",
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		pointer, err := PointerOf(q)
+		if strings.HasPrefix(expected, "/") || query == "$" {
+			if err != nil || pointer != expected {
+				t.Errorf("PointerOf(%q) = %q, %v; expected %q", query, pointer, err, expected)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected+":") {
+			t.Errorf("PointerOf(%q) = %q, %v; expected an error on %s", query, pointer, err, expected)
+		}
+	}
+}
+
+// TestQueryFromPointerSingular runs the singular queries of pointers with
+// numeric tokens through the APIs taking one.
+func TestQueryFromPointerSingular(t *testing.T) {
+	doc := map[string]any{
+		"items": []any{map[string]any{"name": "first"}},
+		"index": map[string]any{"0": map[string]any{"name": "member"}},
+	}
+	pointers := map[string][2]string{
+		"/items/0/name": {"first", `{"$set":{"items.0.name":1}}`},
+		"/index/0/name": {"member", `{"$set":{"index.0.name":1}}`},
+	}
+	for pointer, expected := range pointers {
+		q, err := QueryFromPointer(pointer)
+		if err != nil {
+			t.Fatalf("QueryFromPointer(%q) = %v", pointer, err)
+		}
+		if !IsSingular(q) {
+			t.Errorf("IsSingular(%q) = false", pointer)
+		}
+		if name, ok, err := Get[string](q, doc); name != expected[0] || !ok || err != nil {
+			t.Errorf("Get[string](%q) = %q, %t, %v; expected %q", pointer, name, ok, err, expected[0])
+		}
+		for _, opts := range [][]EvalOption{nil, {WithBytecode()}} {
+			nodes, err := Prepare(q, opts...).Evaluate(doc)
+			if err != nil || len(nodes) != 1 || nodes[0] != expected[0] {
+				t.Errorf("Prepare(%q).Evaluate() = %v, %v; expected [%s]", pointer, nodes, err, expected[0])
+			}
+		}
+		u, err := MongoUpdate(q, UpdateSet, 1)
+		if err != nil || u.Update.String() != expected[1] {
+			t.Errorf("MongoUpdate(%q) = %v, %v; expected %s", pointer, u, err, expected[1])
+		}
+		if _, err := MongoPipeline(q); err != nil {
+			t.Errorf("MongoPipeline(%q) = %v", pointer, err)
+		}
+	}
+	q, _ := QueryFromPointer("/items/1/name")
+	if _, ok, err := Get[string](q, doc); ok || err != nil {
+		t.Errorf(`Get[string]("/items/1/name") = %t, %v; expected no node`, ok, err)
+	}
+}
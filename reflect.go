@@ -0,0 +1,365 @@
+package gojimongo
+
+import (
+	"encoding"
+	"encoding/json"
+	"iter"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// reflectNode adapts any Go value, walked by reflection.
+type reflectNode struct {
+	value reflect.Value // the value, pointers and interfaces dereferenced
+	orig  reflect.Value // the value as found in its parent, returned in results
+	tag   string        // the struct tag naming fields, "json" or "bson"
+	kind  NodeKind
+}
+
+// structField is a field of a struct as its tag presents it.
+type structField struct {
+	name      string
+	index     []int
+	tagged    bool // named by its tag rather than after the field
+	omitEmpty bool
+	omitZero  bool
+}
+
+// structFields are the fields of a struct type in declaration order.
+type structFields struct {
+	list   []structField
+	byName map[string]int
+}
+
+type structFieldsKey struct {
+	t   reflect.Type
+	tag string
+}
+
+// structFieldsCache holds the structFields of every struct type walked.
+var structFieldsCache sync.Map
+
+// scalarTypes are the predeclared types scalars of each kind are read as.
+var scalarTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeFor[bool](),
+	reflect.Int:     reflect.TypeFor[int](),
+	reflect.Int8:    reflect.TypeFor[int8](),
+	reflect.Int16:   reflect.TypeFor[int16](),
+	reflect.Int32:   reflect.TypeFor[int32](),
+	reflect.Int64:   reflect.TypeFor[int64](),
+	reflect.Uint:    reflect.TypeFor[uint](),
+	reflect.Uint8:   reflect.TypeFor[uint8](),
+	reflect.Uint16:  reflect.TypeFor[uint16](),
+	reflect.Uint32:  reflect.TypeFor[uint32](),
+	reflect.Uint64:  reflect.TypeFor[uint64](),
+	reflect.Float32: reflect.TypeFor[float32](),
+	reflect.Float64: reflect.TypeFor[float64](),
+	reflect.String:  reflect.TypeFor[string](),
+}
+
+var (
+	jsonMarshaler = reflect.TypeFor[json.Marshaler]()
+	textMarshaler = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// NewReflectTree returns doc, a Go value of any type, as a TreeNode, naming
+// struct fields after their tag key, "json" or "bson". Fields tagged "-" are
+// hidden, and fields tagged omitempty or omitzero do not exist when empty,
+// as they would not once marshaled. A promoted field is hidden by a field of
+// the same name declared closer to the struct, and fields tied at the same
+// depth hide each other unless exactly one is tagged, as with encoding/json.
+// Struct fields are yielded in declaration order, map entries in sorted key
+// order.
+//
+// Nil pointers, interfaces, maps and slices are null. Structs marshaling
+// themselves, such as time.Time, maps without string keys, byte slices,
+// channels and functions are of KindOther.
+func NewReflectTree(doc any, tagKey string) TreeNode {
+	return reflectTree(reflect.ValueOf(doc), tagKey)
+}
+
+func reflectTree(v reflect.Value, tag string) TreeNode {
+	n := reflectNode{orig: v, tag: tag}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			n.kind = KindNull
+			return n
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		n.kind = KindNull
+		return n
+	}
+	if v.CanInterface() {
+		switch x := v.Interface().(type) {
+		case D, A, json.Number:
+			return jsonNode{x}
+		}
+	}
+	n.value = v
+	n.kind = reflectKind(v)
+	return n
+}
+
+func reflectKind(v reflect.Value) NodeKind {
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Bool:
+		return KindBool
+	case reflect.String:
+		return KindString
+	case reflect.Struct:
+		if t.Implements(jsonMarshaler) || t.Implements(textMarshaler) ||
+			reflect.PointerTo(t).Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(textMarshaler) {
+			return KindOther
+		}
+		return KindObject
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return KindOther
+		}
+		if v.IsNil() {
+			return KindNull
+		}
+		return KindObject
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return KindOther
+		}
+		if v.IsNil() {
+			return KindNull
+		}
+		return KindArray
+	case reflect.Array:
+		return KindArray
+	}
+	if _, ok := scalarTypes[t.Kind()]; ok {
+		return KindNumber
+	}
+	return KindOther
+}
+
+func (n reflectNode) Kind() NodeKind {
+	return n.kind
+}
+
+// Value returns scalars as values of their predeclared type, so that named
+// types such as `type Status string` compare as their kind.
+func (n reflectNode) Value() any {
+	switch n.kind {
+	case KindNull:
+		return nil
+	case KindBool, KindNumber, KindString:
+		return n.value.Convert(scalarTypes[n.value.Kind()]).Interface()
+	}
+	return n.orig.Interface()
+}
+
+// Members yields the members of a struct or map in document order.
+func (n reflectNode) Members() iter.Seq2[string, TreeNode] {
+	return func(yield func(string, TreeNode) bool) {
+		if n.kind != KindObject {
+			return
+		}
+		if n.value.Kind() == reflect.Map {
+			keys := n.value.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, k := range keys {
+				if !yield(k.String(), reflectTree(n.value.MapIndex(k), n.tag)) {
+					return
+				}
+			}
+			return
+		}
+		for _, f := range cachedStructFields(n.value.Type(), n.tag).list {
+			if value, ok := n.field(f); ok && !yield(f.name, value) {
+				return
+			}
+		}
+	}
+}
+
+// Member returns the member named name of a struct or map.
+func (n reflectNode) Member(name string) (TreeNode, bool) {
+	if n.kind != KindObject {
+		return nil, false
+	}
+	if n.value.Kind() == reflect.Map {
+		value := n.value.MapIndex(reflect.ValueOf(name).Convert(n.value.Type().Key()))
+		if !value.IsValid() {
+			return nil, false
+		}
+		return reflectTree(value, n.tag), true
+	}
+	fields := cachedStructFields(n.value.Type(), n.tag)
+	i, ok := fields.byName[name]
+	if !ok {
+		return nil, false
+	}
+	return n.field(fields.list[i])
+}
+
+// field returns the value of f, which is absent when it is omitted or when
+// it is promoted from a nil embedded pointer.
+func (n reflectNode) field(f structField) (TreeNode, bool) {
+	value, err := n.value.FieldByIndexErr(f.index)
+	if err != nil {
+		return nil, false
+	}
+	if f.omitEmpty && isEmptyValue(value) || f.omitZero && value.IsZero() {
+		return nil, false
+	}
+	return reflectTree(value, n.tag), true
+}
+
+func (n reflectNode) Len() int {
+	if n.kind != KindArray {
+		return 0
+	}
+	return n.value.Len()
+}
+
+func (n reflectNode) Index(i int) TreeNode {
+	return reflectTree(n.value.Index(i), n.tag)
+}
+
+// unreflect returns the Go value a result stands for.
+func unreflect(value any) any {
+	if n, ok := value.(reflectNode); ok {
+		return n.orig.Interface()
+	}
+	return value
+}
+
+// isEmptyValue reports whether v is empty as omitempty understands it.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// cachedStructFields returns the fields of struct type t named by tag,
+// computing them once per type.
+func cachedStructFields(t reflect.Type, tag string) *structFields {
+	key := structFieldsKey{t, tag}
+	if fields, ok := structFieldsCache.Load(key); ok {
+		return fields.(*structFields)
+	}
+	names := []string{}
+	byName := map[string][]structField{}
+	for _, f := range collectStructFields(t, tag, nil, map[reflect.Type]bool{}) {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+	fields := &structFields{byName: map[string]int{}}
+	for _, name := range names {
+		if f, ok := dominantField(byName[name]); ok {
+			fields.byName[name] = len(fields.list)
+			fields.list = append(fields.list, f)
+		}
+	}
+	cached, _ := structFieldsCache.LoadOrStore(key, fields)
+	return cached.(*structFields)
+}
+
+// dominantField returns the field of a name hiding the others, as
+// encoding/json picks it: the one declared closest to the struct, or the
+// only one tagged among those. Fields tied otherwise hide each other.
+func dominantField(fields []structField) (structField, bool) {
+	depth := len(fields[0].index)
+	for _, f := range fields[1:] {
+		depth = min(depth, len(f.index))
+	}
+	closest := []structField{}
+	for _, f := range fields {
+		if len(f.index) == depth {
+			closest = append(closest, f)
+		}
+	}
+	if len(closest) == 1 {
+		return closest[0], true
+	}
+	tagged := []structField{}
+	for _, f := range closest {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return structField{}, false
+}
+
+// collectStructFields lists the exported fields of t, inlining the fields of
+// structs tagged inline and, with json tags, of untagged embedded structs,
+// exported or not. Fields tagged "-" are hidden, while "-," names a field
+// "-". Untagged fields are named after the field, lowercased with bson tags
+// as the MongoDB driver does.
+func collectStructFields(t reflect.Type, tag string, index []int, inlined map[reflect.Type]bool) []structField {
+	inlined[t] = true
+	defer delete(inlined, t)
+	fields := []structField{}
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		value := sf.Tag.Get(tag)
+		if value == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(value, ",")
+		fieldIndex := append(index[:len(index):len(index)], i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		inline := hasTagOption(options, "inline") || sf.Anonymous && name == "" && tag != "bson"
+		if !sf.IsExported() && !(sf.Anonymous && inline && ft.Kind() == reflect.Struct) {
+			// the exported fields of an unexported embedded struct are
+			// still promoted
+			continue
+		}
+		if inline && ft.Kind() == reflect.Struct {
+			if !inlined[ft] {
+				fields = append(fields, collectStructFields(ft, tag, fieldIndex, inlined)...)
+			}
+			continue
+		}
+		tagged := name != ""
+		if !tagged {
+			name = sf.Name
+			if tag == "bson" {
+				name = strings.ToLower(name)
+			}
+		}
+		fields = append(fields, structField{
+			name:      name,
+			index:     fieldIndex,
+			tagged:    tagged,
+			omitEmpty: hasTagOption(options, "omitempty"),
+			omitZero:  hasTagOption(options, "omitzero"),
+		})
+	}
+	return fields
+}
+
+func hasTagOption(options, option string) bool {
+	for options != "" {
+		var o string
+		o, options, _ = strings.Cut(options, ",")
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
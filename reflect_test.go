@@ -0,0 +1,220 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type reflectStatus string
+
+type ReflectAudit struct {
+	Created time.Time `json:"created" bson:"created"`
+	Author  string    `json:"author,omitempty" bson:"by"`
+}
+
+type reflectItem struct {
+	SKU      string            `json:"sku" bson:"sku"`
+	Qty      int               `json:"qty,omitempty" bson:"qty,omitempty"`
+	Price    float64           `json:"price" bson:"price"`
+	Internal string            `json:"-" bson:"-"`
+	Labels   map[string]string `json:"labels,omitempty" bson:"labels,omitempty"`
+}
+
+type reflectBase struct {
+	Version int    `json:"version" bson:"version"`
+	Dash    string `json:"-," bson:"-,"`
+}
+
+type reflectOrder struct {
+	reflectBase
+	ReflectAudit `bson:",inline"`
+	ID           int            `json:"id" bson:"_id"`
+	Status       reflectStatus  `json:"status" bson:"status"`
+	Items        []*reflectItem `json:"items" bson:"items"`
+	Customer     *struct {
+		Name string
+	} `json:"customer" bson:"customer"`
+	Notes  any
+	secret string
+}
+
+func TestEvaluateStructs(t *testing.T) {
+	order := &reflectOrder{
+		reflectBase:  reflectBase{Version: 2, Dash: "d"},
+		ReflectAudit: ReflectAudit{Author: "ann"},
+		ID:           7,
+		Status:       "open",
+		Items: []*reflectItem{
+			{SKU: "A", Qty: 2, Price: 9.5, Internal: "x", Labels: map[string]string{"b": "2", "a": "1"}},
+			{SKU: "B", Price: 20},
+			nil,
+		},
+		Notes:  []any{"fragile", map[string]any{"floor": 3}},
+		secret: "s",
+	}
+	queries := map[string]string{
+		"$.id":                                 `[7]`,
+		"$.status":                             `["open"]`,
+		"$[?@ == 'open']":                      `["open"]`,
+		"$.items[?@.qty].sku":                  `["A"]`,
+		"$.items[?!@.qty].sku":                 `["B"]`,
+		"$.items[?@.price > 10].sku":           `["B"]`,
+		"$.items[0].Internal":                  `[]`,
+		"$.items[0].labels.*":                  `["1","2"]`,
+		"$.items[2]":                           `[null]`,
+		"$.items[?@ == null]":                  `[null]`,
+		"$.customer":                           `[null]`,
+		"$.author":                             `["ann"]`,
+		"$.version":                            `[2]`,
+		"$['-']":                               `["d"]`,
+		"$.secret":                             `[]`,
+		"$.Notes[1].floor":                     `[3]`,
+		"$..sku":                               `["A","B"]`,
+		"$.items[?length(@.labels) == 2].sku":  `["A"]`,
+		"$.items[?count(@.labels.*) == 2].sku": `["A"]`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		nodes, err := Evaluate(q, order, WithStructTags("json"))
+		if err != nil {
+			t.Errorf("Evaluate(%q) = %v", query, err)
+			continue
+		}
+		got, _ := json.Marshal(nodes)
+		if string(got) != expected {
+			t.Errorf("Evaluate(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+}
+
+func TestEvaluateStructsBSON(t *testing.T) {
+	order := reflectOrder{ReflectAudit: ReflectAudit{Author: "ann"}, ID: 7, Items: []*reflectItem{{SKU: "A"}}}
+	queries := map[string]string{
+		"$._id":            `[7]`,
+		"$.by":             `["ann"]`,
+		"$.items[0].qty":   `[]`,
+		"$.items[0].price": `[0]`,
+		"$.notes":          `[null]`,
+		"$.id":             `[]`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		nodes, err := Evaluate(q, order, WithStructTags("bson"))
+		if err != nil {
+			t.Errorf("Evaluate(%q) = %v", query, err)
+			continue
+		}
+		got, _ := json.Marshal(nodes)
+		if string(got) != expected {
+			t.Errorf("Evaluate(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+}
+
+func TestEvaluateStructsResults(t *testing.T) {
+	item := &reflectItem{SKU: "A"}
+	order := &reflectOrder{Items: []*reflectItem{item}}
+	c := &Compiler{}
+	q, err := c.Compile("$.items[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := EvaluateNodes(q, order, WithStructTags("json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Value != item || nodes[0].Path.String() != "$['items'][0]" {
+		t.Errorf("EvaluateNodes($.items[0]) = %v; expected the item itself", nodes)
+	}
+	typ := reflect.TypeFor[reflectOrder]()
+	if cachedStructFields(typ, "json") != cachedStructFields(typ, "json") {
+		t.Errorf("struct fields are not cached")
+	}
+}
+
+type reflectName struct {
+	Name string
+}
+
+type reflectAlias struct {
+	Name string
+}
+
+type reflectTitle struct {
+	Title string `json:"Name"`
+}
+
+type reflectTie struct {
+	reflectName
+	reflectAlias
+	ID int `json:"id"`
+}
+
+type reflectTaggedTie struct {
+	reflectName
+	reflectTitle
+}
+
+func TestEvaluateStructsPromoted(t *testing.T) {
+	docs := map[string]any{
+		"tie":    reflectTie{reflectName{"a"}, reflectAlias{"b"}, 1},
+		"tagged": reflectTaggedTie{reflectName{"a"}, reflectTitle{"b"}},
+	}
+	queries := map[string]map[string]string{
+		"tie":    {"$.Name": `[]`, "$.id": `[1]`, "$.*": `[1]`},
+		"tagged": {"$.Name": `["b"]`, "$.*": `["b"]`},
+	}
+	c := &Compiler{}
+	for name, doc := range docs {
+		for query, expected := range queries[name] {
+			q, err := c.Compile(query)
+			if err != nil {
+				t.Fatalf("Compile(%q) = %v", query, err)
+			}
+			nodes, err := Evaluate(q, doc, WithStructTags("json"))
+			if err != nil {
+				t.Errorf("Evaluate(%q) = %v", query, err)
+				continue
+			}
+			got, _ := json.Marshal(nodes)
+			if string(got) != expected {
+				t.Errorf("Evaluate(%q) over %s = %s; expected %s", query, name, got, expected)
+			}
+		}
+	}
+}
+
+func TestEvaluateStructsDefaultTags(t *testing.T) {
+	order := &reflectOrder{ID: 7, Items: []*reflectItem{{SKU: "A"}}}
+	queries := map[string]string{
+		"$.id":           `[7]`,
+		"$.items[*].sku": `["A"]`,
+		"$.ID":           `[]`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		nodes, err := Evaluate(q, order)
+		if err != nil {
+			t.Errorf("Evaluate(%q) = %v", query, err)
+			continue
+		}
+		got, _ := json.Marshal(nodes)
+		if string(got) != expected {
+			t.Errorf("Evaluate(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	STREAM_ERROR_DESCENDANT = "descendant segments look back at the nodes above their matches"
+	STREAM_ERROR_SELECTORS  = "segments with several selectors must buffer nodes to order them"
+	STREAM_ERROR_NEGATIVE   = "negative indexes depend on the length of the array"
+	STREAM_ERROR_SLICE      = "only forward slices with non-negative bounds can be streamed"
+	STREAM_ERROR_ROOT       = "filters referring to the root depend on the whole document"
+	STREAM_ERROR_SELECTOR   = "selector cannot be streamed"
+)
+
+// StreamError reports a query EvaluateStream cannot decide on the way down
+// the document. Such queries are evaluated with Evaluate on the decoded
+// document instead.
+type StreamError struct {
+	Node   string // AST node type, e.g. "DescendantSegment"
+	Reason string
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("[gojimongo][stream]: cannot stream %s: %s", e.Node, e.Reason)
+}
+
+// streamer evaluates a query over the tokens of a JSON document.
+type streamer struct {
+	dec  *json.Decoder
+	segs []Segment
+	sels []Selector // the only selector of each segment
+	emit func(Node) error
+}
+
+// Streamable reports why q cannot be evaluated by EvaluateStream, if it
+// cannot. A query streams when each of its segments has one selector among
+// names, non-negative indexes, wildcards, forward slices and filters that
+// only refer to the current node.
+func Streamable(q Query) error {
+	_, err := streamSelectors(q)
+	return err
+}
+
+// EvaluateStream evaluates q over the JSON document r reads, calling emit
+// with each selected node as soon as it is read. Memory use is bounded by
+// the depth of the document and the size of one selected node, or of one
+// element a filter tests. Members are visited in the order of the input and
+// numbers are decoded as json.Number. An error returned by emit stops the
+// evaluation and is returned.
+//
+// Queries Streamable rejects fail with a StreamError before r is read.
+func EvaluateStream(q Query, r io.Reader, emit func(Node) error) error {
+	sels, err := streamSelectors(q)
+	if err != nil {
+		return err
+	}
+	s := &streamer{dec: json.NewDecoder(r), sels: sels, emit: emit}
+	s.dec.UseNumber()
+	switch q := q.(type) {
+	case *AbsQuery:
+		s.segs = q.segments
+	case *RelQuery:
+		s.segs = q.segments
+	}
+	return s.value(NormalizedPath{}, 0)
+}
+
+func streamSelectors(q Query) ([]Selector, error) {
+	var segs []Segment
+	switch q := q.(type) {
+	case *AbsQuery:
+		segs = q.segments
+	case *RelQuery:
+		segs = q.segments
+	}
+	sels := make([]Selector, len(segs))
+	for i, seg := range segs {
+		switch s := seg.(type) {
+		case *DotChildSegment:
+			sels[i] = s.selector
+		case *ChildSegment:
+			if len(s.selectors) != 1 {
+				return nil, &StreamError{nodeName(s), STREAM_ERROR_SELECTORS}
+			}
+			sels[i] = s.selectors[0]
+		default:
+			return nil, &StreamError{nodeName(seg), STREAM_ERROR_DESCENDANT}
+		}
+		if err := streamableSelector(sels[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sels, nil
+}
+
+func streamableSelector(sel Selector) error {
+	switch s := sel.(type) {
+	case *NameSelector, *StringExpr, *IntExpr, *WildCardSelector:
+		return nil
+	case *MinusExpr:
+		return &StreamError{nodeName(s), STREAM_ERROR_NEGATIVE}
+	case *SliceSelector:
+		start, ok1 := sliceBound(s.start)
+		stop, ok2 := sliceBound(s.stop)
+		step, ok3 := sliceBound(s.step)
+		if !ok1 || !ok2 || !ok3 || start != nil && *start < 0 || stop != nil && *stop < 0 || step != nil && *step <= 0 {
+			return &StreamError{nodeName(s), STREAM_ERROR_SLICE}
+		}
+		return nil
+	case *FilterSelector:
+		if refersToRoot(s.cond) {
+			return &StreamError{nodeName(s), STREAM_ERROR_ROOT}
+		}
+		return nil
+	}
+	return &StreamError{nodeName(sel), STREAM_ERROR_SELECTOR}
+}
+
+// refersToRoot reports whether e holds an absolute query, in nested filters
+// included.
+func refersToRoot(e Expr) bool {
+	switch e := e.(type) {
+	case *AbsQuery:
+		return true
+	case *RelQuery:
+		for _, seg := range e.segments {
+			var sels []Selector
+			switch s := seg.(type) {
+			case *DotChildSegment:
+				sels = []Selector{s.selector}
+			case *ChildSegment:
+				sels = s.selectors
+			case *DescendantSegment:
+				sels = s.selectors
+			}
+			for _, sel := range sels {
+				if f, ok := sel.(*FilterSelector); ok && refersToRoot(f.cond) {
+					return true
+				}
+			}
+		}
+		return false
+	case *ParExpr:
+		return refersToRoot(e.value)
+	case *NotExpr:
+		return refersToRoot(e.expr)
+	case *AndExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *OrExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *GtExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *GteExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *LtExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *LteExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *EqeqExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *NeqExpr:
+		return refersToRoot(e.lhs) || refersToRoot(e.rhs)
+	case *FnExpr:
+		for _, param := range e.params {
+			if refersToRoot(param) {
+				return true
+			}
+		}
+		return false
+	}
+	if _, value, ok := castOf(e); ok {
+		return refersToRoot(value)
+	}
+	return false
+}
+
+// value evaluates the selectors from depth on over the next value of the
+// input, the node at path.
+func (s *streamer) value(path NormalizedPath, depth int) error {
+	if depth == len(s.sels) {
+		var value any
+		if err := s.dec.Decode(&value); err != nil {
+			return err
+		}
+		return s.emit(Node{path, value})
+	}
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	sel := s.sels[depth]
+	switch tok {
+	case json.Delim('{'):
+		for s.dec.More() {
+			tok, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			name, _ := tok.(string)
+			if err := s.child(sel, path.child(name), depth); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for i := 0; s.dec.More(); i++ {
+			if err := s.child(sel, path.child(i), depth); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	_, err = s.dec.Token()
+	return err
+}
+
+// child applies sel to the next value of the input, the child of an array
+// or object at path.
+func (s *streamer) child(sel Selector, path NormalizedPath, depth int) error {
+	if f, ok := sel.(*FilterSelector); ok {
+		return s.filter(f, path, depth)
+	}
+	if streamSelects(sel, path[len(path)-1]) {
+		return s.value(path, depth+1)
+	}
+	return s.skip()
+}
+
+// filter decodes the child at path and, when it passes f, evaluates the
+// remaining segments over it in memory.
+func (s *streamer) filter(f *FilterSelector, path NormalizedPath, depth int) error {
+	var value any
+	if err := s.dec.Decode(&value); err != nil {
+		return err
+	}
+	v := NewVisitorEval(nil)
+	n := Node{path, value}
+	v.current = n
+	if !v.test(f.cond) {
+		return v.err
+	}
+	nodes := v.query(s.segs[depth+1:], n)
+	if v.err != nil {
+		return v.err
+	}
+	for _, n := range nodes {
+		if err := s.emit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamSelects reports whether sel selects the member name or the element
+// index key.
+func streamSelects(sel Selector, key any) bool {
+	switch s := sel.(type) {
+	case *WildCardSelector:
+		return true
+	case *NameSelector:
+		return key == s.value
+	case *StringExpr:
+		return key == unquote(s.value)
+	case *IntExpr:
+		return key == s.value
+	case *SliceSelector:
+		i, ok := key.(int)
+		if !ok {
+			return false
+		}
+		start, _ := sliceBound(s.start)
+		stop, _ := sliceBound(s.stop)
+		step, _ := sliceBound(s.step)
+		lower, by := 0, 1
+		if start != nil {
+			lower = *start
+		}
+		if step != nil {
+			by = *step
+		}
+		return i >= lower && (stop == nil || i < *stop) && (i-lower)%by == 0
+	}
+	return false
+}
+
+// skip consumes the next value of the input.
+func (s *streamer) skip() error {
+	depth := 0
+	for {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateStream(t *testing.T) {
+	queries := map[string]string{
+		"$.store.book[*].author":                     `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`,
+		"$.store.book[2].title":                      `["Moby Dick"]`,
+		"$.store.book[1:].price":                     `[12.99,8.99,22.99]`,
+		"$.store.book[::2].title":                    `["Sayings of the Century","Moby Dick"]`,
+		"$.store.*.price":                            `[399]`,
+		"$.store.book[?@.price < 10].title":          `["Sayings of the Century","Moby Dick"]`,
+		"$.store.book[?@.isbn && @.price > 10].isbn": `["0-395-19395-8"]`,
+		"$.store[?@.color]":                          `[{"color":"red","price":399}]`,
+		"$['expensive']":                             `[10]`,
+		"$.expensive.nothing":                        `[]`,
+		"$":                                          `[` + strings.Join(strings.Fields(evalDocument), " ") + `]`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		values := []any{}
+		err = EvaluateStream(q, strings.NewReader(evalDocument), func(n Node) error {
+			values = append(values, n.Value)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("EvaluateStream(%q) = %v", query, err)
+			continue
+		}
+		got, _ := json.Marshal(values)
+		var want any
+		json.Unmarshal([]byte(expected), &want)
+		wanted, _ := json.Marshal(want)
+		if string(got) != string(wanted) {
+			t.Errorf("EvaluateStream(%q) = %s; expected %s", query, got, wanted)
+		}
+	}
+}
+
+func TestEvaluateStreamPaths(t *testing.T) {
+	c := &Compiler{}
+	q, _ := c.Compile("$.store.book[?@.isbn].title")
+	paths := []string{}
+	err := EvaluateStream(q, strings.NewReader(evalDocument), func(n Node) error {
+		paths = append(paths, n.Path.String())
+		return nil
+	})
+	expected := "$['store']['book'][2]['title'] $['store']['book'][3]['title']"
+	if err != nil || strings.Join(paths, " ") != expected {
+		t.Errorf("EvaluateStream = %v, %v; expected %s", paths, err, expected)
+	}
+
+	stop := errors.New("stop")
+	q, _ = c.Compile("$.store.book[*]")
+	calls := 0
+	err = EvaluateStream(q, strings.NewReader(evalDocument), func(n Node) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("EvaluateStream = %v after %d calls; expected to stop after the first", err, calls)
+	}
+}
+
+func TestEvaluateStreamErrors(t *testing.T) {
+	queries := map[string]string{
+		"$..author":                          "DescendantSegment",
+		"$.book[0,1]":                        "ChildSegment",
+		"$.book[-1]":                         "MinusExpr",
+		"$.book[::-1]":                       "SliceSelector",
+		"$.book[-2:]":                        "SliceSelector",
+		"$.book[?@.price > $.expensive]":     "FilterSelector",
+		"$.book[?@.tags[?@ == $.tag]]":       "FilterSelector",
+		"$.book[?length(@.title) > $.limit]": "FilterSelector",
+	}
+	c := &Compiler{}
+	for query, node := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		err = EvaluateStream(q, strings.NewReader(evalDocument), func(Node) error { return nil })
+		var serr *StreamError
+		if !errors.As(err, &serr) {
+			t.Errorf("EvaluateStream(%q) = %v; expected a StreamError", query, err)
+			continue
+		}
+		if serr.Node != node {
+			t.Errorf("EvaluateStream(%q) failed on %s; expected %s", query, serr.Node, node)
+		}
+	}
+	q, _ := c.Compile("$.store.book[*]")
+	err := EvaluateStream(q, strings.NewReader(`{"store": {"book": [1, 2`), func(Node) error { return nil })
+	if err == nil {
+		t.Errorf("EvaluateStream on truncated input succeeded")
+	}
+}
@@ -42,6 +42,7 @@ const (
 	LENGTH
 	COUNT
 	MATCH
+	SEARCH
 
 	// Literals and identifiers
 	INTEGER
@@ -81,6 +82,7 @@ var TokenNames = map[TokenType]string{
 	LENGTH:        "LENGTH",
 	COUNT:         "COUNT",
 	MATCH:         "MATCH",
+	SEARCH:        "SEARCH",
 	INTEGER:       "INTEGER",
 	STRING:        "STRING",
 	IDENTIFIER:    "IDENTIFIER",
@@ -89,6 +91,24 @@ var TokenNames = map[TokenType]string{
 	FALSE: 			"FALSE",
 }
 
+// functionTokens are the tokens of the function extensions' names.
+var functionTokens = map[string]TokenType{
+	"length": LENGTH,
+	"count":  COUNT,
+	"match":  MATCH,
+	"search": SEARCH,
+}
+
+// isName reports whether the token can be read as a member name; function
+// names remain valid member names outside of a call.
+func (t TokenType) isName() bool {
+	switch t {
+	case IDENTIFIER, LENGTH, COUNT, MATCH, SEARCH:
+		return true
+	}
+	return false
+}
+
 func (t TokenType) String() string {
 	if name, exists := TokenNames[t]; exists {
 		return name
@@ -0,0 +1,159 @@
+package gojimongo
+
+import (
+	"iter"
+	"sort"
+)
+
+// NodeKind is the JSON type of a TreeNode.
+type NodeKind int
+
+const (
+	KindNull NodeKind = iota + 1
+	KindBool
+	KindNumber
+	KindString
+	KindArray
+	KindObject
+	// KindOther is a value with no JSON type, such as a channel, which
+	// equals nothing, not even itself.
+	KindOther
+)
+
+// TreeNode is a node of a document tree the evaluator walks. The package
+// adapts the values encoding/json produces, and D and A, with NewJSONTree,
+// and any Go value with NewReflectTree; implementing TreeNode lets queries
+// run over other trees, YAML documents or protobuf messages for instance,
+// without converting them first.
+type TreeNode interface {
+	Kind() NodeKind
+	// Value returns the value of a scalar: nil, a bool, a number of any Go
+	// numeric type or json.Number, or a string. Nodes of KindOther return the
+	// Go value they stand for.
+	Value() any
+	// Members yields the members of an object in document order.
+	Members() iter.Seq2[string, TreeNode]
+	// Member returns the member of an object named name.
+	Member(name string) (TreeNode, bool)
+	// Len returns the number of elements of an array.
+	Len() int
+	// Index returns the element of an array at index i, 0 <= i < Len().
+	Index(i int) TreeNode
+}
+
+// jsonNode adapts a tree of map[string]any, []any, D, A and scalars.
+type jsonNode struct {
+	value any
+}
+
+// NewJSONTree returns doc, a value decoded by encoding/json or built out of
+// D and A, as a TreeNode. Maps have no order: their members are yielded in
+// sorted key order.
+func NewJSONTree(doc any) TreeNode {
+	return jsonNode{doc}
+}
+
+func (n jsonNode) Kind() NodeKind {
+	switch v := n.value.(type) {
+	case nil:
+		return KindNull
+	case bool:
+		return KindBool
+	case string:
+		return KindString
+	case map[string]any, D:
+		return KindObject
+	case []any, A:
+		return KindArray
+	default:
+		if _, ok := evalNumber(v); ok {
+			return KindNumber
+		}
+	}
+	return KindOther
+}
+
+func (n jsonNode) Value() any {
+	return n.value
+}
+
+func (n jsonNode) Members() iter.Seq2[string, TreeNode] {
+	return func(yield func(string, TreeNode) bool) {
+		switch v := n.value.(type) {
+		case D:
+			for _, e := range v {
+				if !yield(e.Key, jsonNode{e.Value}) {
+					return
+				}
+			}
+		case map[string]any:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if !yield(k, jsonNode{v[k]}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (n jsonNode) Member(name string) (TreeNode, bool) {
+	switch v := n.value.(type) {
+	case D:
+		member, ok := v.Get(name)
+		return jsonNode{member}, ok
+	case map[string]any:
+		member, ok := v[name]
+		return jsonNode{member}, ok
+	}
+	return nil, false
+}
+
+func (n jsonNode) Len() int {
+	switch v := n.value.(type) {
+	case []any:
+		return len(v)
+	case A:
+		return len(v)
+	}
+	return 0
+}
+
+func (n jsonNode) Index(i int) TreeNode {
+	switch v := n.value.(type) {
+	case []any:
+		return jsonNode{v[i]}
+	case A:
+		return jsonNode{v[i]}
+	}
+	return nil
+}
+
+// asTree returns the TreeNode of an array or object the evaluator holds.
+func asTree(value any) (TreeNode, bool) {
+	switch v := value.(type) {
+	case TreeNode:
+		return v, true
+	case map[string]any, []any, D, A:
+		return jsonNode{v}, true
+	}
+	return nil, false
+}
+
+// evalOf returns n as the evaluator holds it: scalars as their value, arrays
+// and objects of encoding/json as themselves, any other array or object as
+// its TreeNode.
+func evalOf(n TreeNode) any {
+	switch n.Kind() {
+	case KindArray, KindObject:
+		if j, ok := n.(jsonNode); ok {
+			return j.value
+		}
+		return n
+	}
+	return n.Value()
+}
@@ -0,0 +1,172 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"iter"
+	"strings"
+	"testing"
+)
+
+// lineTree is a tree of "key: value" lines, indented by two spaces per
+// level, standing for a user-supplied TreeNode such as a YAML document.
+type lineTree struct {
+	scalar   string
+	keys     []string
+	children []*lineTree
+}
+
+func parseLineTree(s string) *lineTree {
+	root := &lineTree{}
+	stack := []*lineTree{root}
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		depth := (len(line) - len(strings.TrimLeft(line, " "))) / 2
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ":")
+		node := &lineTree{scalar: strings.TrimSpace(value)}
+		parent := stack[depth]
+		parent.keys = append(parent.keys, key)
+		parent.children = append(parent.children, node)
+		stack = append(stack[:depth+1], node)
+	}
+	return root
+}
+
+func (t *lineTree) Kind() NodeKind {
+	switch {
+	case t.keys != nil:
+		return KindObject
+	case t.scalar == "true" || t.scalar == "false":
+		return KindBool
+	case strings.Trim(t.scalar, "0123456789") == "" && t.scalar != "":
+		return KindNumber
+	}
+	return KindString
+}
+
+func (t *lineTree) Value() any {
+	switch t.Kind() {
+	case KindBool:
+		return t.scalar == "true"
+	case KindNumber:
+		return json.Number(t.scalar)
+	}
+	return t.scalar
+}
+
+func (t *lineTree) Members() iter.Seq2[string, TreeNode] {
+	return func(yield func(string, TreeNode) bool) {
+		for i, key := range t.keys {
+			if !yield(key, t.children[i]) {
+				return
+			}
+		}
+	}
+}
+
+func (t *lineTree) Member(name string) (TreeNode, bool) {
+	for i, key := range t.keys {
+		if key == name {
+			return t.children[i], true
+		}
+	}
+	return nil, false
+}
+
+func (t *lineTree) Len() int             { return 0 }
+func (t *lineTree) Index(i int) TreeNode { return nil }
+
+func TestEvaluateTreeNode(t *testing.T) {
+	doc := parseLineTree(`
+server:
+  host: example.org
+  port: 8080
+  tls: true
+clients:
+  web:
+    port: 80
+  admin:
+    port: 8443
+    tls: true
+`)
+	queries := map[string][]string{
+		"$.server.port":                {"$['server']['port']=8080"},
+		"$..port":                      {"$['server']['port']=8080", "$['clients']['web']['port']=80", "$['clients']['admin']['port']=8443"},
+		"$.clients[?@.tls == true]":    {"$['clients']['admin']"},
+		"$.clients[?@.port > 100].*":   {"$['clients']['admin']['port']=8443", "$['clients']['admin']['tls']=true"},
+		"$[?length(@.host) == 11]":     {"$['server']"},
+		"$.server[?match(@, '.*org')]": {"$['server']['host']=example.org"},
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		nodes, err := EvaluateNodes(q, doc)
+		if err != nil {
+			t.Errorf("EvaluateNodes(%q) = %v", query, err)
+			continue
+		}
+		got := make([]string, len(nodes))
+		for i, n := range nodes {
+			got[i] = n.Path.String()
+			if tree, ok := n.Value.(TreeNode); !ok || tree.Kind() != KindObject {
+				got[i] += "=" + strings.TrimSpace(strings.Trim(mustMarshal(n.Value), `"`))
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(expected, " ") {
+			t.Errorf("EvaluateNodes(%q) = %v; expected %v", query, got, expected)
+		}
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"b":[1,"x",null],"a":{"c":true}}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	type item struct {
+		C bool `json:"c"`
+	}
+	type document struct {
+		B []any `json:"b"`
+		A item  `json:"a"`
+	}
+	trees := map[string]TreeNode{
+		"json":    NewJSONTree(doc),
+		"reflect": NewReflectTree(document{B: []any{1, "x", nil}, A: item{C: true}}, "json"),
+	}
+	for name, tree := range trees {
+		keys := []string{}
+		for key := range tree.Members() {
+			keys = append(keys, key)
+		}
+		b, _ := tree.Member("b")
+		kinds := []NodeKind{tree.Kind(), b.Kind()}
+		for i := range b.Len() {
+			kinds = append(kinds, b.Index(i).Kind())
+		}
+		a, _ := tree.Member("a")
+		c, _ := a.Member("c")
+		if _, ok := tree.Member("z"); ok {
+			t.Errorf("%s: Member(z) exists", name)
+		}
+		if c.Value() != true {
+			t.Errorf("%s: $.a.c = %v; expected true", name, c.Value())
+		}
+		expected := []NodeKind{KindObject, KindArray, KindNumber, KindString, KindNull}
+		if strings.Join(keys, ",") != map[string]string{"json": "a,b", "reflect": "b,a"}[name] {
+			t.Errorf("%s: keys %v", name, keys)
+		}
+		for i := range expected {
+			if kinds[i] != expected[i] {
+				t.Errorf("%s: kinds = %v; expected %v", name, kinds, expected)
+				break
+			}
+		}
+	}
+}
+
+func mustMarshal(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
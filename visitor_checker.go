@@ -0,0 +1,354 @@
+package gojimongo
+
+import "fmt"
+
+const (
+	CHECKER_ERROR_UNKNOWN_FUNCTION = "unknown function"
+	CHECKER_ERROR_ARGUMENTS        = "wrong number of arguments"
+	CHECKER_ERROR_VALUE_ARGUMENT   = "argument must be a literal, a singular query or a function returning a value"
+	CHECKER_ERROR_NODES_ARGUMENT   = "argument must be a query"
+	CHECKER_ERROR_NOT_A_TEST       = "function returns a value, which cannot be used as a test"
+	CHECKER_ERROR_NOT_AN_OPERAND   = "logical expressions cannot be compared"
+	CHECKER_ERROR_CAST_ARGUMENT    = "cast argument must be a literal, a singular query, a function returning a value or a cast"
+	CHECKER_ERROR_NOT_SINGULAR     = "comparison operands must be singular queries"
+	CHECKER_ERROR_NEGATION         = "only integer literals can be negated"
+)
+
+// fnType is the declared type of a function parameter or result (RFC 9535,
+// section 2.4.1).
+type fnType int
+
+const (
+	valueType fnType = iota + 1
+	logicalType
+	nodesType
+)
+
+type function struct {
+	params []fnType
+	result fnType
+}
+
+// functions are the function extensions of RFC 9535 the package implements.
+var functions = map[string]function{
+	"length": {params: []fnType{valueType}, result: valueType},
+	"count":  {params: []fnType{nodesType}, result: valueType},
+	"match":  {params: []fnType{valueType, valueType}, result: logicalType},
+	"search": {params: []fnType{valueType, valueType}, result: logicalType},
+}
+
+// VisitorChecker validates a parsed query beyond what its grammar expresses.
+// Function calls must be well-typed as RFC 9535 defines it: each argument
+// has the declared type of its parameter, a function returning a value is
+// only compared and a logical expression is only tested. Queries compared
+// must be singular. A cast takes a value, or wraps a logical expression. The
+// regular expressions given to match() and search() as literals must be
+// I-Regexps.
+type VisitorChecker struct {
+	err error
+}
+
+func NewVisitorChecker() *VisitorChecker {
+	return &VisitorChecker{}
+}
+
+// Result returns the first error found in the visited query.
+func (v *VisitorChecker) Result() error {
+	return v.err
+}
+
+func checkerError(value string) error {
+	return fmt.Errorf("[gojimongo][checker]: %s", value)
+}
+
+func (v *VisitorChecker) fail(err error) {
+	if v.err == nil {
+		v.err = err
+	}
+}
+
+func (v *VisitorChecker) visit(nodes ...astNode) {
+	for _, n := range nodes {
+		if n != nil && v.err == nil {
+			n.accept(v)
+		}
+	}
+}
+
+// LITERAL EXPRESSIONS
+func (v *VisitorChecker) visitStringExpr(e *StringExpr) {}
+func (v *VisitorChecker) visitIntExpr(e *IntExpr)       {}
+func (v *VisitorChecker) visitTrueExpr(e *TrueExpr)     {}
+func (v *VisitorChecker) visitFalseExpr(e *FalseExpr)   {}
+func (v *VisitorChecker) visitNullExpr(e *NullExpr)     {}
+
+func (v *VisitorChecker) visitTypedStringExpr(e *TypedStringExpr) {
+	v.cast(e.value)
+}
+
+func (v *VisitorChecker) visitTypedArrayExpr(e *TypedArrayExpr) {
+	v.cast(e.value)
+}
+
+func (v *VisitorChecker) visitTypedIntExpr(e *TypedIntExpr) {
+	v.cast(e.value)
+}
+
+func (v *VisitorChecker) visitTypedBoolExpr(e *TypedBoolExpr) {
+	v.cast(e.value)
+}
+
+func (v *VisitorChecker) visitTypedDecimalExpr(e *TypedDecimalExpr) {
+	v.cast(e.value)
+}
+
+func (v *VisitorChecker) visitTypedObjectExpr(e *TypedObjectExpr) {
+	v.cast(e.value)
+}
+
+// cast checks the expression of a cast, which is transparent around a
+// logical expression and otherwise takes a value.
+func (v *VisitorChecker) cast(value Expr) {
+	if isLogical(value) {
+		v.test(value)
+		return
+	}
+	if !argumentOf(value, valueType) {
+		v.fail(checkerError(CHECKER_ERROR_CAST_ARGUMENT))
+		return
+	}
+	v.visit(value)
+}
+
+func (v *VisitorChecker) visitParExpr(e *ParExpr) {
+	v.visit(e.value)
+}
+
+func (v *VisitorChecker) visitFnExpr(e *FnExpr) {
+	fn, ok := functions[e.name]
+	if !ok {
+		v.fail(checkerError(fmt.Sprintf("%s %s()", CHECKER_ERROR_UNKNOWN_FUNCTION, e.name)))
+		return
+	}
+	if len(e.params) != len(fn.params) {
+		v.fail(checkerError(fmt.Sprintf("%s: %s() takes %d, got %d", CHECKER_ERROR_ARGUMENTS, e.name, len(fn.params), len(e.params))))
+		return
+	}
+	for i, param := range e.params {
+		if !argumentOf(param, fn.params[i]) {
+			reason := CHECKER_ERROR_VALUE_ARGUMENT
+			if fn.params[i] == nodesType {
+				reason = CHECKER_ERROR_NODES_ARGUMENT
+			}
+			v.fail(checkerError(fmt.Sprintf("%s(): argument %d: %s", e.name, i+1, reason)))
+			return
+		}
+	}
+	switch e.name {
+	case "match", "search":
+		if pattern, ok := e.params[1].(*StringExpr); ok {
+			if _, err := translateIRegexp(unquote(pattern.value), false); err != nil {
+				v.fail(err)
+				return
+			}
+		}
+	}
+	for _, param := range e.params {
+		v.visit(param)
+	}
+}
+
+// test checks an expression used as a test.
+func (v *VisitorChecker) test(e Expr) {
+	if fn, ok := unwrapFn(e); ok && functions[fn.name].result == valueType {
+		v.fail(checkerError(fmt.Sprintf("%s(): %s", fn.name, CHECKER_ERROR_NOT_A_TEST)))
+		return
+	}
+	v.visit(e)
+}
+
+// operand checks one side of a comparison.
+func (v *VisitorChecker) operand(e Expr) {
+	if isLogical(e) {
+		v.fail(checkerError(CHECKER_ERROR_NOT_AN_OPERAND))
+		return
+	}
+	if m, ok := e.(*MinusExpr); ok {
+		v.visitMinusExpr(m)
+		return
+	}
+	if !argumentOf(e, valueType) {
+		v.fail(checkerError(CHECKER_ERROR_NOT_SINGULAR))
+		return
+	}
+	v.visit(e)
+}
+
+func (v *VisitorChecker) compare(lhs, rhs Expr) {
+	v.operand(lhs)
+	v.operand(rhs)
+}
+
+// unwrapFn returns the function call e is, looking through parentheses.
+func unwrapFn(e Expr) (*FnExpr, bool) {
+	switch e := e.(type) {
+	case *FnExpr:
+		return e, true
+	case *ParExpr:
+		return unwrapFn(e.value)
+	}
+	return nil, false
+}
+
+// isLogical reports whether e is a logical expression: a comparison, a
+// logical operator or a call to a function returning a logical value. A type
+// wrapper around a logical expression is transparent.
+func isLogical(e Expr) bool {
+	switch e := e.(type) {
+	case *AndExpr, *OrExpr, *NotExpr, *GtExpr, *GteExpr, *LtExpr, *LteExpr, *EqeqExpr, *NeqExpr:
+		return true
+	case *FnExpr:
+		return functions[e.name].result == logicalType
+	case *ParExpr:
+		return isLogical(e.value)
+	}
+	if _, value, ok := castOf(e); ok {
+		return isLogical(value)
+	}
+	return false
+}
+
+// argumentOf reports whether e can be passed to a parameter of type t.
+func argumentOf(e Expr, t fnType) bool {
+	if fn, ok := unwrapFn(e); ok {
+		result := functions[fn.name].result
+		return result == t || (t == logicalType && result == nodesType)
+	}
+	switch e := e.(type) {
+	case *ParExpr:
+		return argumentOf(e.value, t)
+	case *RelQuery:
+		return t != valueType || singularQuery(e.segments)
+	case *AbsQuery:
+		return t != valueType || singularQuery(e.segments)
+	case *StringExpr, *IntExpr, *TrueExpr, *FalseExpr, *NullExpr:
+		return t == valueType
+	case *MinusExpr:
+		// only negative integer literals parse as a minus
+		_, ok := e.expr.(*IntExpr)
+		return ok && t == valueType
+	}
+	if _, value, ok := castOf(e); ok && !isLogical(value) {
+		return t == valueType
+	}
+	return t == logicalType
+}
+
+// singularQuery reports whether segs select at most one node: each segment
+// is a child segment with a single name, index or PointerSelector.
+func singularQuery(segs []Segment) bool {
+	for _, seg := range segs {
+		if _, ok := singularSelector(seg); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSingular reports whether q is a singular query, which RFC 9535 defines
+// as selecting at most one node from any document: $.a.b[0] is, $.a[*],
+// $..a, $.a[0,1] and $.a[0,'0'] are not. The queries QueryFromPointer
+// builds are.
+func IsSingular(q Query) bool {
+	switch q := q.(type) {
+	case *AbsQuery:
+		return singularQuery(q.segments)
+	case *RelQuery:
+		return singularQuery(q.segments)
+	}
+	return false
+}
+
+// UNARY EXPRESSIONS
+func (v *VisitorChecker) visitNotExpr(e *NotExpr) {
+	v.test(e.expr)
+}
+
+func (v *VisitorChecker) visitMinusExpr(e *MinusExpr) {
+	if _, ok := e.expr.(*IntExpr); !ok {
+		v.fail(checkerError(CHECKER_ERROR_NEGATION))
+		return
+	}
+	v.visit(e.expr)
+}
+
+// BINARY EXPRESSIONS
+func (v *VisitorChecker) visitAndExpr(e *AndExpr) {
+	v.test(e.lhs)
+	v.test(e.rhs)
+}
+
+func (v *VisitorChecker) visitOrExpr(e *OrExpr) {
+	v.test(e.lhs)
+	v.test(e.rhs)
+}
+
+func (v *VisitorChecker) visitGtExpr(e *GtExpr) {
+	v.compare(e.lhs, e.rhs)
+}
+
+func (v *VisitorChecker) visitLtExpr(e *LtExpr) {
+	v.compare(e.lhs, e.rhs)
+}
+
+func (v *VisitorChecker) visitLteExpr(e *LteExpr) {
+	v.compare(e.lhs, e.rhs)
+}
+
+func (v *VisitorChecker) visitGteExpr(e *GteExpr) {
+	v.compare(e.lhs, e.rhs)
+}
+
+func (v *VisitorChecker) visitEqeqExpr(e *EqeqExpr) {
+	v.compare(e.lhs, e.rhs)
+}
+
+func (v *VisitorChecker) visitNeqExpr(e *NeqExpr) {
+	v.compare(e.lhs, e.rhs)
+}
+
+// SELECTORS
+func (v *VisitorChecker) visitFilterSelector(s *FilterSelector) {
+	v.test(s.cond)
+}
+
+func (v *VisitorChecker) visitWildcardSelector(s *WildCardSelector) {}
+
+func (v *VisitorChecker) visitSliceSelector(s *SliceSelector) {
+	v.visit(s.start, s.stop, s.step)
+}
+
+func (v *VisitorChecker) visitNameSelector(s *NameSelector) {}
+
+func (v *VisitorChecker) visitPointerSelector(s *PointerSelector) {}
+
+// SEGMENTS
+func (v *VisitorChecker) visitDotChildSegment(s *DotChildSegment) {
+	v.visit(s.selector)
+}
+
+func (v *VisitorChecker) visitChildSegment(s *ChildSegment) {
+	v.visit(selectorNodes(s.selectors)...)
+}
+
+func (v *VisitorChecker) visitDescendantSegment(s *DescendantSegment) {
+	v.visit(selectorNodes(s.selectors)...)
+}
+
+func (v *VisitorChecker) visitAbsQuery(q *AbsQuery) {
+	v.visit(segmentNodes(q.segments)...)
+}
+
+func (v *VisitorChecker) visitRelQuery(q *RelQuery) {
+	v.visit(segmentNodes(q.segments)...)
+}
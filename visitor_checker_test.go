@@ -0,0 +1,52 @@
+package gojimongo
+
+import "testing"
+
+func TestVisitorChecker(t *testing.T) {
+	queries := map[string]bool{
+		"$[?length(@.name) > 3]":                   true,
+		"$[?length('abc') == 3]":                   true,
+		"$[?count(@.*) == count($..a)]":            true,
+		"$[?length(@.a) == count(@.b)]":            true,
+		"$[?@int(count(@.devices) >= 10)]":         true,
+		"$[?match(@.a, 'x') && !search(@.b, 'y')]": true,
+		"$.count[?@.length > 1].match":             true,
+		"$..count":                                 true,
+		"$[?length(@.a)]":                          false, // a value is not a test
+		"$[?!count(@.a)]":                          false,
+		"$[?match(@.a, 'x') == true]":              false, // a logical value is not compared
+		"$[?length(@.*) > 1]":                      false, // not a singular query
+		"$[?length(@.a, @.b) > 1]":                 false,
+		"$[?count(1) > 1]":                         false, // not a query
+		"$[?count(length(@.a)) > 1]":               false,
+		"$[?length(@.a > 1) > 1]":                  false,
+		"$[?match(length(@.a), 'x')]":              true,
+		"$[?@int(@.a)]":                            true,
+		"$[?@double(@.a) > @object(@.b)]":          true,
+		"$[?@str(@int(@.a)) == '1']":               true,
+		"$[?@int(@.*)]":                            false, // not a singular query
+		"$[?@int(@.a > 1) == 1]":                   false,
+		"$[?(@.a > 1) == true]":                    false,
+		"$[?value(@.a) == 1]":                      false, // unknown function
+		"$[?@.a[-1] == $.b['c'][0]]":               true,
+		"$[?@.a.* > 1]":                            false, // not a singular query
+		"$[?1 < $..a]":                             false,
+		"$[?@.a['b','c'] == 1]":                    false,
+		"$[?@.a[0,'0'] == 1]":                      false,
+		"$[?@.a[0:1] != null]":                     false,
+		"$[?@.a[?@.b] == 1]":                       false,
+		"$[?@.a == -1]":                            true,
+		"$.a[?(-@.x < 1)]":                         false, // only integer literals are negated
+		"$[?-(1) == -1]":                           false,
+	}
+	c := &Compiler{}
+	for query, valid := range queries {
+		_, err := c.Compile(query)
+		if valid && err != nil {
+			t.Errorf("Compile(%q) = %v", query, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Compile(%q) succeeded; expected an error", query)
+		}
+	}
+}
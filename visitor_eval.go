@@ -0,0 +1,778 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	EVAL_ERROR_NOT_A_TEST     = "expression is not a test"
+	EVAL_ERROR_NOT_AN_OPERAND = "expression is not a comparison operand"
+	EVAL_ERROR_NOT_A_SELECTOR = "expression is not a selector"
+	EVAL_ERROR_FUNCTION       = "function calls are not supported"
+)
+
+// evalNodes is the nodelist a query produces.
+type evalNodes []Node
+
+// evalLogical is the result of a test or a logical expression.
+type evalLogical bool
+
+// evalNothing is the absence of a value, the operand produced by a singular
+// query selecting no node.
+type evalNothing struct{}
+
+// VisitorEval evaluates a compiled query against an in-memory document with
+// RFC 9535 semantics. Documents are trees of map[string]any, []any and
+// scalars as produced by encoding/json, json.Number included, or of the
+// package's D and A.
+//
+// Documents may also be any tree implementing TreeNode, or Go structs,
+// pointers, maps, slices and interfaces, walked by reflection after their
+// json tags or those WithStructTags names. The visitor only reads documents
+// through TreeNode.
+//
+// Object members are visited in the order of D, in declaration order for
+// structs, or in sorted key order for maps, which have none, so results are
+// deterministic. Descendants are
+// visited depth first, each node before its children, as RFC 9535 orders
+// them.
+type VisitorEval struct {
+	root      any    // the node '$' refers to
+	current   Node   // the node '@' refers to
+	node      Node   // the node the selector being visited applies to
+	output    []Node // nodes selected by the segment being visited
+	selecting bool   // literals are selectors rather than operands
+	filter    int    // depth of filter expressions being evaluated
+	result    any
+	err       error
+}
+
+// EvalOption configures the in-memory evaluation of queries.
+type EvalOption func(*evalConfig)
+
+type evalConfig struct {
+	tag      string // the struct tag naming fields, or "" not to reflect
+	bytecode bool   // run filters on the bytecode VM
+}
+
+func newEvalConfig(opts []EvalOption) evalConfig {
+	config := evalConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// WithStructTags evaluates queries over Go values of any type by reflection,
+// naming struct fields after their tag key, "json" or "bson". Fields tagged
+// "-" are hidden, and fields tagged omitempty do not exist when empty.
+// Selected nodes are the Go values found in the document. Documents that are
+// neither a TreeNode nor a tree encoding/json decodes are reflected with json
+// tags by default.
+func WithStructTags(key string) EvalOption {
+	return func(c *evalConfig) {
+		c.tag = key
+	}
+}
+
+func NewVisitorEval(root any, opts ...EvalOption) *VisitorEval {
+	root = evalRoot(root, opts)
+	return &VisitorEval{root: root, current: Node{Value: root}}
+}
+
+// evalRoot returns doc as the evaluator holds it.
+func evalRoot(doc any, opts []EvalOption) any {
+	config := newEvalConfig(opts)
+	if config.tag != "" {
+		doc = NewReflectTree(doc, config.tag)
+	} else if _, ok := doc.(TreeNode); !ok && NewJSONTree(doc).Kind() == KindOther {
+		doc = NewReflectTree(doc, "json")
+	}
+	if tree, ok := doc.(TreeNode); ok {
+		doc = evalOf(tree)
+	}
+	return doc
+}
+
+// Result returns the values of the nodes selected by the last visited query.
+func (v *VisitorEval) Result() ([]any, error) {
+	nodes, err := v.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(nodes))
+	for i, n := range nodes {
+		values[i] = n.Value
+	}
+	return values, nil
+}
+
+// Nodes returns the nodes selected by the last visited query along with
+// their Normalized Paths.
+func (v *VisitorEval) Nodes() ([]Node, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	nodes, _ := v.result.(evalNodes)
+	result := make([]Node, len(nodes))
+	for i, n := range nodes {
+		result[i] = Node{n.Path, unreflect(n.Value)}
+	}
+	return result, nil
+}
+
+// Evaluate returns the nodes q selects from doc. q is prepared on first use,
+// see PreparedQuery; VisitorEval evaluates it the same, walking the AST.
+func Evaluate(q Query, doc any, opts ...EvalOption) ([]any, error) {
+	return prepared(q, opts).Evaluate(doc, opts...)
+}
+
+// EvaluateNodes returns the nodes q selects from doc along with their
+// Normalized Paths, in document order.
+func EvaluateNodes(q Query, doc any, opts ...EvalOption) ([]Node, error) {
+	return prepared(q, opts).EvaluateNodes(doc, opts...)
+}
+
+func (q *AbsQuery) Select(doc any) ([]any, error) {
+	return Evaluate(q, doc)
+}
+
+func (q *RelQuery) Select(doc any) ([]any, error) {
+	return Evaluate(q, doc)
+}
+
+func (q *AbsQuery) SelectNodes(doc any) ([]Node, error) {
+	return EvaluateNodes(q, doc)
+}
+
+func (q *RelQuery) SelectNodes(doc any) ([]Node, error) {
+	return EvaluateNodes(q, doc)
+}
+
+func evalError(value string) error {
+	return fmt.Errorf("[gojimongo][eval]: %s", value)
+}
+
+func (v *VisitorEval) fail(node any, reason string) {
+	if v.err == nil {
+		v.err = evalError(fmt.Sprintf("%s: %s", nodeName(node), reason))
+	}
+	v.result = nil
+}
+
+// query applies segs in turn, starting from the nodelist holding start.
+func (v *VisitorEval) query(segs []Segment, start Node) evalNodes {
+	nodes := []Node{start}
+	for _, seg := range segs {
+		saved := v.output
+		v.output = []Node{}
+		for _, node := range nodes {
+			v.node = node
+			seg.accept(v)
+		}
+		nodes, v.output = v.output, saved
+		if v.err != nil {
+			return nil
+		}
+	}
+	return nodes
+}
+
+// selectors applies sels, in order, to v.node.
+func (v *VisitorEval) selectors(sels []Selector) {
+	saved := v.selecting
+	v.selecting = true
+	for _, sel := range sels {
+		sel.accept(v)
+	}
+	v.selecting = saved
+}
+
+func (v *VisitorEval) test(e Expr) bool {
+	saved := v.selecting
+	v.selecting = false
+	v.result = nil
+	if kind, value, ok := assertion(e); ok {
+		o := v.operand(value)
+		v.result = evalLogical(v.err == nil && evalIsType(kind, o))
+	} else {
+		e.accept(v)
+	}
+	v.selecting = saved
+	switch r := v.result.(type) {
+	case evalLogical:
+		return bool(r)
+	case evalNodes:
+		return len(r) > 0
+	}
+	v.fail(e, EVAL_ERROR_NOT_A_TEST)
+	return false
+}
+
+// operand evaluates one side of a comparison to a value or evalNothing.
+func (v *VisitorEval) operand(e Expr) any {
+	saved := v.selecting
+	v.selecting = false
+	v.result = nil
+	e.accept(v)
+	v.selecting = saved
+	switch r := v.result.(type) {
+	case evalNodes:
+		if len(r) != 1 {
+			return evalNothing{}
+		}
+		return r[0].Value
+	case evalLogical:
+		v.fail(e, EVAL_ERROR_NOT_AN_OPERAND)
+		return nil
+	}
+	return v.result
+}
+
+func (v *VisitorEval) compare(lhs, rhs Expr) (any, any) {
+	l := v.operand(lhs)
+	r := v.operand(rhs)
+	return l, r
+}
+
+func (v *VisitorEval) literal(e Expr, value any) {
+	if v.selecting {
+		v.fail(e, EVAL_ERROR_NOT_A_SELECTOR)
+		return
+	}
+	v.result = value
+}
+
+// evalMembers returns the members of an object in document order.
+func evalMembers(value any) (D, bool) {
+	tree, ok := asTree(value)
+	if !ok || tree.Kind() != KindObject {
+		return nil, false
+	}
+	members := D{}
+	for name, member := range tree.Members() {
+		members = append(members, E{name, evalOf(member)})
+	}
+	return members, true
+}
+
+func evalMember(value any, name string) (any, bool) {
+	tree, ok := asTree(value)
+	if !ok || tree.Kind() != KindObject {
+		return nil, false
+	}
+	member, ok := tree.Member(name)
+	if !ok {
+		return nil, false
+	}
+	return evalOf(member), true
+}
+
+func evalElements(value any) ([]any, bool) {
+	tree, ok := asTree(value)
+	if !ok || tree.Kind() != KindArray {
+		return nil, false
+	}
+	elements := make([]any, tree.Len())
+	for i := range elements {
+		elements[i] = evalOf(tree.Index(i))
+	}
+	return elements, true
+}
+
+// evalChildren returns the children of an array or object in document order.
+func evalChildren(n Node) []Node {
+	if elements, ok := evalElements(n.Value); ok {
+		children := make([]Node, len(elements))
+		for i, e := range elements {
+			children[i] = Node{n.Path.child(i), e}
+		}
+		return children
+	}
+	members, _ := evalMembers(n.Value)
+	children := make([]Node, len(members))
+	for i, m := range members {
+		children[i] = Node{n.Path.child(m.Key), m.Value}
+	}
+	return children
+}
+
+// evalDescendants returns n followed by its descendants, each node before its
+// children.
+func evalDescendants(n Node, nodes []Node) []Node {
+	nodes = append(nodes, n)
+	for _, child := range evalChildren(n) {
+		nodes = evalDescendants(child, nodes)
+	}
+	return nodes
+}
+
+func evalNumber(value any) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// evalEqual compares two values, or evalNothing, for equality. Numbers are
+// equal by value whatever their Go type.
+func evalEqual(a, b any) bool {
+	if _, ok := a.(evalNothing); ok {
+		_, ok := b.(evalNothing)
+		return ok
+	}
+	if x, ok := evalNumber(a); ok {
+		y, ok := evalNumber(b)
+		return ok && x == y
+	}
+	if x, ok := evalElements(a); ok {
+		y, ok := evalElements(b)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !evalEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := evalMembers(a); ok {
+		y, ok := evalMembers(b)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for _, m := range x {
+			other, ok := y.Get(m.Key)
+			if !ok || !evalEqual(m.Value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		s, ok := b.(string)
+		return ok && a == s
+	case bool:
+		t, ok := b.(bool)
+		return ok && a == t
+	}
+	return false
+}
+
+// evalLess orders two numbers or two strings; any other pair is unordered.
+func evalLess(a, b any) bool {
+	if x, ok := evalNumber(a); ok {
+		y, ok := evalNumber(b)
+		return ok && x < y
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		return ok && x < y
+	}
+	return false
+}
+
+// evalSlice returns the indexes a slice selects from an array of n elements.
+func evalSlice(n int, start, stop, step *int) []int {
+	s := 1
+	if step != nil {
+		s = *step
+	}
+	if s == 0 {
+		return nil
+	}
+	normalize := func(i int) int {
+		if i < 0 {
+			return n + i
+		}
+		return i
+	}
+	clamp := func(i, lo, hi int) int {
+		return max(lo, min(i, hi))
+	}
+	indexes := []int{}
+	if s > 0 {
+		lower, upper := 0, n
+		if start != nil {
+			lower = clamp(normalize(*start), 0, n)
+		}
+		if stop != nil {
+			upper = clamp(normalize(*stop), 0, n)
+		}
+		for i := lower; i < upper; i += s {
+			indexes = append(indexes, i)
+		}
+		return indexes
+	}
+	upper, lower := n-1, -1
+	if start != nil {
+		upper = clamp(normalize(*start), -1, n-1)
+	}
+	if stop != nil {
+		lower = clamp(normalize(*stop), -1, n-1)
+	}
+	for i := upper; i > lower; i += s {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+func (v *VisitorEval) index(i int) {
+	elements, ok := evalElements(v.node.Value)
+	if !ok {
+		return
+	}
+	if i < 0 {
+		i += len(elements)
+	}
+	if i >= 0 && i < len(elements) {
+		v.output = append(v.output, Node{v.node.Path.child(i), elements[i]})
+	}
+}
+
+func (v *VisitorEval) member(name string) {
+	if member, ok := evalMember(v.node.Value, name); ok {
+		v.output = append(v.output, Node{v.node.Path.child(name), member})
+	}
+}
+
+// LITERAL EXPRESSIONS
+func (v *VisitorEval) visitStringExpr(e *StringExpr) {
+	if v.selecting {
+		v.member(unquote(e.value))
+		return
+	}
+	v.result = unquote(e.value)
+}
+
+func (v *VisitorEval) visitIntExpr(e *IntExpr) {
+	if v.selecting {
+		v.index(e.value)
+		return
+	}
+	v.result = e.value
+}
+
+func (v *VisitorEval) visitTrueExpr(e *TrueExpr) {
+	v.literal(e, true)
+}
+
+func (v *VisitorEval) visitFalseExpr(e *FalseExpr) {
+	v.literal(e, false)
+}
+
+func (v *VisitorEval) visitNullExpr(e *NullExpr) {
+	v.literal(e, nil)
+}
+
+func (v *VisitorEval) visitTypedStringExpr(e *TypedStringExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorEval) visitTypedArrayExpr(e *TypedArrayExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorEval) visitTypedIntExpr(e *TypedIntExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorEval) visitTypedBoolExpr(e *TypedBoolExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorEval) visitTypedDecimalExpr(e *TypedDecimalExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorEval) visitTypedObjectExpr(e *TypedObjectExpr) {
+	v.cast(e)
+}
+
+// cast evaluates a cast used as an operand into a conversion, or, as a
+// selector, selects what its converted literal names. Type assertions are
+// evaluated by test.
+func (v *VisitorEval) cast(e Expr) {
+	kind, value, _ := castOf(e)
+	if isLogical(value) {
+		value.accept(v)
+		return
+	}
+	if v.selecting {
+		literal, ok := literalValue(value)
+		if !ok {
+			v.fail(e, EVAL_ERROR_NOT_A_SELECTOR)
+			return
+		}
+		switch sel := evalCast(kind, literal).(type) {
+		case string:
+			v.member(sel)
+		case int:
+			v.index(sel)
+		default:
+			v.fail(e, EVAL_ERROR_NOT_A_SELECTOR)
+		}
+		return
+	}
+	o := v.operand(value)
+	if v.err != nil {
+		return
+	}
+	v.result = evalCast(kind, o)
+}
+
+func (v *VisitorEval) visitParExpr(e *ParExpr) {
+	e.value.accept(v)
+}
+
+func (v *VisitorEval) visitFnExpr(e *FnExpr) {
+	switch e.name {
+	case "length":
+		v.length(e)
+	case "count":
+		v.count(e)
+	case "match", "search":
+		v.regex(e)
+	default:
+		v.fail(e, EVAL_ERROR_FUNCTION)
+	}
+}
+
+// length evaluates length(): the number of code points of a string, the
+// number of elements of an array or of members of an object. Any other value
+// has no length.
+func (v *VisitorEval) length(e *FnExpr) {
+	if len(e.params) != 1 {
+		v.fail(e, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	value := v.operand(e.params[0])
+	if v.err != nil {
+		return
+	}
+	if s, ok := value.(string); ok {
+		v.result = utf8.RuneCountInString(s)
+		return
+	}
+	if elements, ok := evalElements(value); ok {
+		v.result = len(elements)
+		return
+	}
+	if members, ok := evalMembers(value); ok {
+		v.result = len(members)
+		return
+	}
+	v.result = evalNothing{}
+}
+
+// count evaluates count(), the number of nodes its query selects.
+func (v *VisitorEval) count(e *FnExpr) {
+	if len(e.params) != 1 {
+		v.fail(e, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	saved := v.selecting
+	v.selecting = false
+	v.result = nil
+	e.params[0].accept(v)
+	v.selecting = saved
+	if v.err != nil {
+		return
+	}
+	nodes, ok := v.result.(evalNodes)
+	if !ok {
+		v.fail(e, EVAL_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.result = len(nodes)
+}
+
+// regex evaluates match() and search(). As RFC 9535 specifies, they are false
+// when either argument is not a string or the pattern is not an I-Regexp.
+func (v *VisitorEval) regex(e *FnExpr) {
+	if len(e.params) != 2 {
+		v.fail(e, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	input := v.operand(e.params[0])
+	pattern := v.operand(e.params[1])
+	if v.err != nil {
+		return
+	}
+	s, ok := input.(string)
+	p, isString := pattern.(string)
+	if !ok || !isString {
+		v.result = evalLogical(false)
+		return
+	}
+	re := compileIRegexp(p, e.name == "match")
+	v.result = evalLogical(re != nil && re.MatchString(s))
+}
+
+// UNARY EXPRESSIONS
+func (v *VisitorEval) visitNotExpr(e *NotExpr) {
+	v.result = evalLogical(!v.test(e.expr))
+}
+
+func (v *VisitorEval) visitMinusExpr(e *MinusExpr) {
+	i, ok := e.expr.(*IntExpr)
+	if v.selecting {
+		if !ok {
+			v.fail(e, EVAL_ERROR_NOT_A_SELECTOR)
+			return
+		}
+		v.index(-i.value)
+		return
+	}
+	if !ok {
+		v.fail(e, EVAL_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.result = -i.value
+}
+
+// BINARY EXPRESSIONS
+func (v *VisitorEval) visitAndExpr(e *AndExpr) {
+	v.result = evalLogical(v.test(e.lhs) && v.test(e.rhs))
+}
+
+func (v *VisitorEval) visitOrExpr(e *OrExpr) {
+	v.result = evalLogical(v.test(e.lhs) || v.test(e.rhs))
+}
+
+func (v *VisitorEval) visitGtExpr(e *GtExpr) {
+	l, r := v.compare(e.lhs, e.rhs)
+	v.result = evalLogical(evalLess(r, l))
+}
+
+func (v *VisitorEval) visitLtExpr(e *LtExpr) {
+	l, r := v.compare(e.lhs, e.rhs)
+	v.result = evalLogical(evalLess(l, r))
+}
+
+func (v *VisitorEval) visitLteExpr(e *LteExpr) {
+	l, r := v.compare(e.lhs, e.rhs)
+	v.result = evalLogical(evalLess(l, r) || evalEqual(l, r))
+}
+
+func (v *VisitorEval) visitGteExpr(e *GteExpr) {
+	l, r := v.compare(e.lhs, e.rhs)
+	v.result = evalLogical(evalLess(r, l) || evalEqual(l, r))
+}
+
+func (v *VisitorEval) visitEqeqExpr(e *EqeqExpr) {
+	l, r := v.compare(e.lhs, e.rhs)
+	v.result = evalLogical(evalEqual(l, r))
+}
+
+func (v *VisitorEval) visitNeqExpr(e *NeqExpr) {
+	l, r := v.compare(e.lhs, e.rhs)
+	v.result = evalLogical(!evalEqual(l, r))
+}
+
+// SELECTORS
+func (v *VisitorEval) visitFilterSelector(s *FilterSelector) {
+	node, current := v.node, v.current
+	v.filter++
+	for _, child := range evalChildren(node) {
+		v.current = child
+		if v.test(s.cond) && v.err == nil {
+			v.output = append(v.output, child)
+		}
+	}
+	v.filter--
+	v.node, v.current = node, current
+}
+
+func (v *VisitorEval) visitWildcardSelector(s *WildCardSelector) {
+	v.output = append(v.output, evalChildren(v.node)...)
+}
+
+func (v *VisitorEval) visitSliceSelector(s *SliceSelector) {
+	start, ok1 := sliceBound(s.start)
+	stop, ok2 := sliceBound(s.stop)
+	step, ok3 := sliceBound(s.step)
+	if !ok1 || !ok2 || !ok3 {
+		v.fail(s, EVAL_ERROR_NOT_A_SELECTOR)
+		return
+	}
+	elements, ok := evalElements(v.node.Value)
+	if !ok {
+		return
+	}
+	for _, i := range evalSlice(len(elements), start, stop, step) {
+		v.output = append(v.output, Node{v.node.Path.child(i), elements[i]})
+	}
+}
+
+func (v *VisitorEval) visitNameSelector(s *NameSelector) {
+	if !v.selecting {
+		v.fail(s, EVAL_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.member(s.value)
+}
+
+// visitPointerSelector selects the element of an array or the member of an
+// object; no node has both.
+func (v *VisitorEval) visitPointerSelector(s *PointerSelector) {
+	v.index(s.index)
+	v.member(strconv.Itoa(s.index))
+}
+
+// SEGMENTS
+func (v *VisitorEval) visitDotChildSegment(s *DotChildSegment) {
+	v.selectors([]Selector{s.selector})
+}
+
+func (v *VisitorEval) visitChildSegment(s *ChildSegment) {
+	v.selectors(s.selectors)
+}
+
+func (v *VisitorEval) visitDescendantSegment(s *DescendantSegment) {
+	for _, node := range evalDescendants(v.node, nil) {
+		v.node = node
+		v.selectors(s.selectors)
+	}
+}
+
+func (v *VisitorEval) visitAbsQuery(q *AbsQuery) {
+	v.result = v.query(q.segments, Node{Value: v.root})
+}
+
+func (v *VisitorEval) visitRelQuery(q *RelQuery) {
+	v.result = v.query(q.segments, v.current)
+}
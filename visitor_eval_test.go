@@ -0,0 +1,123 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const evalDocument = `{
+	"store": {
+		"book": [
+			{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+			{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+			{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+		],
+		"bicycle": {"color": "red", "price": 399}
+	},
+	"expensive": 10
+}`
+
+func TestEvaluate(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(evalDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string]string{
+		"$.store.book[*].author":                        `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`,
+		"$..author":                                     `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`,
+		"$.store..price":                                `[399,8.95,12.99,8.99,22.99]`,
+		"$..book[2].title":                              `["Moby Dick"]`,
+		"$..book[-1].title":                             `["The Lord of the Rings"]`,
+		"$..book[0,1].title":                            `["Sayings of the Century","Sword of Honour"]`,
+		"$..book[:2].title":                             `["Sayings of the Century","Sword of Honour"]`,
+		"$..book[::-2].title":                           `["The Lord of the Rings","Sword of Honour"]`,
+		"$..book[?(@.isbn)].title":                      `["Moby Dick","The Lord of the Rings"]`,
+		"$..book[?(@.price < 10)].title":                `["Sayings of the Century","Moby Dick"]`,
+		"$..book[?(@.price > $.expensive)].title":       `["Sword of Honour","The Lord of the Rings"]`,
+		"$..book[?(!(@.category == 'fiction'))].author": `["Nigel Rees"]`,
+		"$..book[?(@.isbn && @.price < 10)].title":      `["Moby Dick"]`,
+		"$..book[?(@.missing == @.other)].price":        `[8.95,12.99,8.99,22.99]`,
+		"$.store.bicycle[?(@ == 'red')]":                `["red"]`,
+		"$.store['bicycle']['color','price']":           `["red",399]`,
+		"$.nothing[*]":                                  `[]`,
+		"$..book[?match(@.author, '.*Rees')].title":     `["Sayings of the Century"]`,
+		"$..book[?match(@.title, 'Moby')].title":        `[]`,
+		"$..book[?search(@.title, 'of ')].price":        `[8.95,12.99,22.99]`,
+		"$..book[?search(@.price, '9')].title":          `[]`,
+		"$..book[?search(@.isbn, '^0')].title":          `[]`,
+		"$..book[?length(@.title) > 15].title":          `["Sayings of the Century","The Lord of the Rings"]`,
+		"$..book[?count(@.*) == 5].title":               `["Moby Dick","The Lord of the Rings"]`,
+		"$.store[?length(@) == 4][0].title":             `["Sayings of the Century"]`,
+		"$.store[?@int(count(@.color) >= 1)].price":     `[399]`,
+		"$..book[?length(@.price) == null].title":       `[]`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		nodes, err := Evaluate(q, doc)
+		if err != nil {
+			t.Errorf("Evaluate(%q) = %v", query, err)
+			continue
+		}
+		got, _ := json.Marshal(nodes)
+		if string(got) != expected {
+			t.Errorf("Evaluate(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+}
+
+func TestEvaluateOrderedDocument(t *testing.T) {
+	doc := D{{"b", 1}, {"a", A{D{{"x", 2}}, D{{"x", 3}}}}}
+	c := &Compiler{}
+	q, err := c.Compile("$..*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := Evaluate(q, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(nodes)
+	if expected := `[1,[{"x":2},{"x":3}],{"x":2},{"x":3},2,3]`; string(got) != expected {
+		t.Errorf("Evaluate($..*) = %s; expected %s", got, expected)
+	}
+}
+
+func TestQuerySelect(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(evalDocument))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string]string{
+		"$..book[?(@.price < 10)].title":          `["Sayings of the Century","Moby Dick"]`,
+		"$..book[?(@.price > $.expensive)].price": `[12.99,22.99]`,
+		"$.store.bicycle[?(@ == 399)]":            `[399]`,
+		"$..book[?@int(@.price)]":                 `[]`,
+		"$.store[?@int(@.price)].color":           `["red"]`,
+		"$..book[?length(@.title) == 9].author":   `["Herman Melville"]`,
+		"@.store.bicycle.price":                   `[399]`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		nodes, err := q.Select(doc)
+		if err != nil {
+			t.Errorf("Select(%q) = %v", query, err)
+			continue
+		}
+		got, _ := json.Marshal(nodes)
+		if string(got) != expected {
+			t.Errorf("Select(%q) = %s; expected %s", query, got, expected)
+		}
+	}
+}
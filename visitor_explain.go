@@ -0,0 +1,324 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Plan describes how one AST node was translated to a find filter. Plans
+// form a tree mirroring the query, from the query down to its segments,
+// selectors and expressions. A Plan marshals to JSON with encoding/json.
+type Plan struct {
+	Node   string `json:"node"`             // AST node type, e.g. "FilterSelector"
+	Detail string `json:"detail,omitempty"` // name, operator or literal of the node
+	// Fragment is the Mongo fragment the node translated to: a filter
+	// document for segments, selectors and conditions, a dotted path for
+	// query operands and a value for literals.
+	Fragment any `json:"fragment,omitempty"`
+	// Pushed reports whether the node is part of the filter sent to MongoDB.
+	// Nodes that are not are evaluated in process by a HybridPlan.
+	Pushed bool `json:"pushed"`
+	// Partial reports whether parts of a pushed node were not, which weakens
+	// its condition into one matching more documents.
+	Partial  bool     `json:"partial,omitempty"`
+	Reason   string   `json:"reason,omitempty"` // why the node was not pushed down
+	Warnings []string `json:"warnings,omitempty"`
+	Children []*Plan  `json:"children,omitempty"`
+}
+
+// Explain translates q as NewHybridPlan does and describes the translation of
+// every node. The plan of the query itself holds the whole pushdown filter.
+func Explain(q Query, opts ...MongoOption) *Plan {
+	m := NewVisitorMongo(opts...)
+	m.relaxed = true
+	m.trace = map[any]*mongoTrace{}
+	q.accept(m)
+	pushdown, _ := m.Result()
+
+	v := NewVisitorExplain(m.trace)
+	q.accept(v)
+	plan := v.Result()
+	plan.Fragment = pushdown
+	plan.Pushed = len(m.dropped) == 0
+	if !plan.Pushed {
+		plan.Partial = false
+		plan.Reason = fmt.Sprintf("%d part(s) evaluated in process", len(m.dropped))
+	}
+	return plan
+}
+
+// String renders the plan as an indented tree, one node per line.
+func (p *Plan) String() string {
+	var b strings.Builder
+	p.write(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (p *Plan) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	b.WriteString(indent)
+	b.WriteString(p.Node)
+	if p.Detail != "" {
+		b.WriteString(" " + p.Detail)
+	}
+	if p.Partial {
+		b.WriteString(" [partial]")
+	} else if p.Pushed {
+		b.WriteString(" [pushed]")
+	} else {
+		b.WriteString(" [in process]")
+	}
+	if p.Fragment != nil {
+		b.WriteString(" " + fragmentString(p.Fragment))
+	}
+	if p.Reason != "" {
+		b.WriteString(": " + p.Reason)
+	}
+	b.WriteString("\n")
+	for _, w := range p.Warnings {
+		b.WriteString(indent + "  ! " + w + "\n")
+	}
+	for _, c := range p.Children {
+		c.write(b, depth+1)
+	}
+}
+
+func fragmentString(fragment any) string {
+	if d, ok := fragment.(D); ok {
+		return d.String()
+	}
+	b, err := json.Marshal(fragment)
+	if err != nil {
+		return fmt.Sprint(fragment)
+	}
+	return string(b)
+}
+
+// astNode is any node of a compiled query.
+type astNode interface {
+	accept(visitor Visitor)
+}
+
+// VisitorExplain builds the Plan tree of a query from the translations a
+// VisitorMongo recorded for its nodes.
+type VisitorExplain struct {
+	trace  map[any]*mongoTrace
+	pushed bool // the parent node was pushed down
+	result *Plan
+}
+
+func NewVisitorExplain(trace map[any]*mongoTrace) *VisitorExplain {
+	return &VisitorExplain{trace: trace, pushed: true}
+}
+
+// Result returns the plan of the last visited node.
+func (v *VisitorExplain) Result() *Plan {
+	return v.result
+}
+
+// plan describes node, then its children. A node without a recorded
+// translation, such as a parenthesized expression, is pushed down with its
+// parent. A node translated to nothing once its parts were dropped is
+// evaluated in process, for the reason of the first part under a pushed
+// parent. A pushed node with parts evaluated in process, or weakened into a
+// condition matching more documents, is partial.
+func (v *VisitorExplain) plan(node any, detail string, children ...astNode) {
+	p := &Plan{Node: nodeName(node), Detail: detail, Pushed: v.pushed}
+	if t, ok := v.trace[node]; ok {
+		p.Fragment = t.fragment
+		p.Warnings = t.warnings
+		p.Partial = t.weakened && v.pushed
+		err := t.err
+		if err == nil && t.dropped != nil {
+			p.Pushed = false
+			if v.pushed {
+				err = t.dropped
+			}
+		}
+		if err != nil {
+			p.Pushed = false
+			p.Reason = err.Error()
+			var terr *TranslationError
+			if errors.As(err, &terr) {
+				p.Reason = terr.Reason
+				if terr.Node != p.Node {
+					p.Reason = terr.Node + ": " + terr.Reason
+				}
+			}
+		}
+	}
+	saved := v.pushed
+	v.pushed = p.Pushed
+	for _, c := range children {
+		if c == nil {
+			continue
+		}
+		c.accept(v)
+		p.Children = append(p.Children, v.result)
+		if p.Pushed && (!v.result.Pushed || v.result.Partial) {
+			p.Partial = true
+		}
+	}
+	v.pushed = saved
+	v.result = p
+}
+
+func selectorNodes(sels []Selector) []astNode {
+	nodes := make([]astNode, len(sels))
+	for i, sel := range sels {
+		nodes[i] = sel
+	}
+	return nodes
+}
+
+func segmentNodes(segs []Segment) []astNode {
+	nodes := make([]astNode, len(segs))
+	for i, seg := range segs {
+		nodes[i] = seg
+	}
+	return nodes
+}
+
+// LITERAL EXPRESSIONS
+func (v *VisitorExplain) visitStringExpr(e *StringExpr) {
+	v.plan(e, e.value)
+}
+
+func (v *VisitorExplain) visitIntExpr(e *IntExpr) {
+	v.plan(e, strconv.Itoa(e.value))
+}
+
+func (v *VisitorExplain) visitTrueExpr(e *TrueExpr) {
+	v.plan(e, "true")
+}
+
+func (v *VisitorExplain) visitFalseExpr(e *FalseExpr) {
+	v.plan(e, "false")
+}
+
+func (v *VisitorExplain) visitNullExpr(e *NullExpr) {
+	v.plan(e, "null")
+}
+
+func (v *VisitorExplain) visitTypedStringExpr(e *TypedStringExpr) {
+	v.plan(e, "@str", e.value)
+}
+
+func (v *VisitorExplain) visitTypedArrayExpr(e *TypedArrayExpr) {
+	v.plan(e, "@array", e.value)
+}
+
+func (v *VisitorExplain) visitTypedIntExpr(e *TypedIntExpr) {
+	v.plan(e, "@int", e.value)
+}
+
+func (v *VisitorExplain) visitTypedBoolExpr(e *TypedBoolExpr) {
+	v.plan(e, "@bool", e.value)
+}
+
+func (v *VisitorExplain) visitTypedDecimalExpr(e *TypedDecimalExpr) {
+	v.plan(e, "@double", e.value)
+}
+
+func (v *VisitorExplain) visitTypedObjectExpr(e *TypedObjectExpr) {
+	v.plan(e, "@object", e.value)
+}
+
+func (v *VisitorExplain) visitParExpr(e *ParExpr) {
+	v.plan(e, "()", e.value)
+}
+
+func (v *VisitorExplain) visitFnExpr(e *FnExpr) {
+	params := make([]astNode, len(e.params))
+	for i, param := range e.params {
+		params[i] = param
+	}
+	v.plan(e, e.name+"()", params...)
+}
+
+// UNARY EXPRESSIONS
+func (v *VisitorExplain) visitNotExpr(e *NotExpr) {
+	v.plan(e, "!", e.expr)
+}
+
+func (v *VisitorExplain) visitMinusExpr(e *MinusExpr) {
+	v.plan(e, "-", e.expr)
+}
+
+// BINARY EXPRESSIONS
+func (v *VisitorExplain) visitAndExpr(e *AndExpr) {
+	v.plan(e, "&&", e.lhs, e.rhs)
+}
+
+func (v *VisitorExplain) visitOrExpr(e *OrExpr) {
+	v.plan(e, "||", e.lhs, e.rhs)
+}
+
+func (v *VisitorExplain) visitGtExpr(e *GtExpr) {
+	v.plan(e, ">", e.lhs, e.rhs)
+}
+
+func (v *VisitorExplain) visitLtExpr(e *LtExpr) {
+	v.plan(e, "<", e.lhs, e.rhs)
+}
+
+func (v *VisitorExplain) visitLteExpr(e *LteExpr) {
+	v.plan(e, "<=", e.lhs, e.rhs)
+}
+
+func (v *VisitorExplain) visitGteExpr(e *GteExpr) {
+	v.plan(e, ">=", e.lhs, e.rhs)
+}
+
+func (v *VisitorExplain) visitEqeqExpr(e *EqeqExpr) {
+	v.plan(e, "==", e.lhs, e.rhs)
+}
+
+func (v *VisitorExplain) visitNeqExpr(e *NeqExpr) {
+	v.plan(e, "!=", e.lhs, e.rhs)
+}
+
+// SELECTORS
+func (v *VisitorExplain) visitFilterSelector(s *FilterSelector) {
+	v.plan(s, "?", s.cond)
+}
+
+func (v *VisitorExplain) visitWildcardSelector(s *WildCardSelector) {
+	v.plan(s, "*")
+}
+
+func (v *VisitorExplain) visitSliceSelector(s *SliceSelector) {
+	v.plan(s, ":", s.start, s.stop, s.step)
+}
+
+func (v *VisitorExplain) visitNameSelector(s *NameSelector) {
+	v.plan(s, s.value)
+}
+
+func (v *VisitorExplain) visitPointerSelector(s *PointerSelector) {
+	v.plan(s, strconv.Itoa(s.index))
+}
+
+// SEGMENTS
+func (v *VisitorExplain) visitDotChildSegment(s *DotChildSegment) {
+	v.plan(s, ".", s.selector)
+}
+
+func (v *VisitorExplain) visitChildSegment(s *ChildSegment) {
+	v.plan(s, "[]", selectorNodes(s.selectors)...)
+}
+
+func (v *VisitorExplain) visitDescendantSegment(s *DescendantSegment) {
+	v.plan(s, "..", selectorNodes(s.selectors)...)
+}
+
+func (v *VisitorExplain) visitAbsQuery(q *AbsQuery) {
+	v.plan(q, "$", segmentNodes(q.segments)...)
+}
+
+func (v *VisitorExplain) visitRelQuery(q *RelQuery) {
+	v.plan(q, "@", segmentNodes(q.segments)...)
+}
@@ -0,0 +1,78 @@
+package gojimongo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	c := &Compiler{}
+	q, err := c.Compile("$.orders[?(@.status == null && @.tags[0:1])].id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := Explain(q)
+	expected := `AbsQuery $ [in process] {"$or":[{"orders":{"$elemMatch":{"status":{"$eq":null},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}: 2 part(s) evaluated in process
+  DotChildSegment . [pushed] {"$or":[{"orders":{"$elemMatch":{"status":{"$eq":null},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}
+    NameSelector orders [pushed] {"$or":[{"orders":{"$elemMatch":{"status":{"$eq":null},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}
+  ChildSegment [] [partial] {"$or":[{"orders":{"$elemMatch":{"status":{"$eq":null},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}
+    FilterSelector ? [partial] {"$or":[{"orders":{"$elemMatch":{"status":{"$eq":null},"id":{"$exists":true}}}},{"orders":{"$type":"object"}}]}
+      ParExpr () [partial] {"status":{"$eq":null}}
+        AndExpr && [partial] {"status":{"$eq":null}}
+          EqeqExpr == [pushed] {"status":{"$eq":null}}
+            ! null comparison also matches missing fields
+            RelQuery @ [pushed] "status"
+              DotChildSegment . [pushed]
+                NameSelector status [pushed]
+            NullExpr null [pushed]
+          RelQuery @ [in process]: SliceSelector: slices cannot be expressed as a find filter
+            DotChildSegment . [in process]
+              NameSelector tags [in process]
+            ChildSegment [] [in process]: SliceSelector: slices cannot be expressed as a find filter
+              SliceSelector : [in process]: slices cannot be expressed as a find filter
+                IntExpr 0 [in process]
+                IntExpr 1 [in process]
+  DotChildSegment . [pushed] {"id":{"$exists":true}}
+    NameSelector id [pushed] {"id":{"$exists":true}}`
+	if plan.String() != expected {
+		t.Errorf("Explain() =\n%s\nexpected\n%s", plan, expected)
+	}
+}
+
+func TestExplainJSON(t *testing.T) {
+	queries := map[string][]string{
+		"$.a[*].b":                    {`"node":"WildCardSelector","detail":"*","fragment":{"$or":[{"a.b":{"$exists":true}},{"a":{"$type":"object"}}]},"pushed":true,"partial":true`},
+		"$..x":                        {`"pushed":false`, `"reason":"descendant segments cannot be expressed as a find filter"`},
+		"$.a[?(!(@.b == 1 && @..c))]": {`"node":"NotExpr"`, `"reason":"negated condition was only partly translated"`},
+		"$.a[?(@.b == 1 || @.c[1:])]": {`"node":"OrExpr","detail":"||","pushed":false`, `"node":"FilterSelector","detail":"?","pushed":false`},
+		"$.a[?(@.b == 1 && @.c[1:])]": {`"fragment":{"b":{"$eq":1}},"pushed":true,"partial":true`},
+	}
+	c := &Compiler{}
+	for query, fragments := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		b, err := json.Marshal(Explain(q))
+		if err != nil {
+			t.Fatalf("json.Marshal(Explain(%q)) = %v", query, err)
+		}
+		for _, fragment := range fragments {
+			if !strings.Contains(string(b), fragment) {
+				t.Errorf("Explain(%q) = %s does not contain %s", query, b, fragment)
+			}
+		}
+	}
+	q, err := c.Compile("$.a[*].b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(Explain(q, WithArrayTraversal()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"warnings":["wildcard is translated`) {
+		t.Errorf("Explain(%q, WithArrayTraversal()) = %s does not warn about the wildcard", "$.a[*].b", b)
+	}
+}
@@ -88,6 +88,10 @@ func (s *WildCardSelector) accept(visitor Visitor) {
 	visitor.visitWildcardSelector(s)
 }
 
+func (s *PointerSelector) accept(visitor Visitor) {
+	visitor.visitPointerSelector(s)
+}
+
 // SEGMENTS
 func (s *DotChildSegment) accept(visitor Visitor) {
 	visitor.visitDotChildSegment(s)
@@ -113,9 +117,9 @@ func (q *TypedIntExpr) accept(visitor Visitor) {
 	visitor.visitTypedIntExpr(q)
 }
 
-// func (q *TypedDoubleExpr) accept(visitor Visitor) {
-// 	visitor.visitTypedDoubleExpr(q)
-// }
+func (q *TypedDecimalExpr) accept(visitor Visitor) {
+	visitor.visitTypedDecimalExpr(q)
+}
 
 func (q *TypedBoolExpr) accept(visitor Visitor) {
 	visitor.visitTypedBoolExpr(q)
@@ -127,4 +131,56 @@ func (q *TypedStringExpr) accept(visitor Visitor) {
 
 func (q *TypedArrayExpr) accept(visitor Visitor) {
 	visitor.visitTypedArrayExpr(q)
-}
\ No newline at end of file
+}
+
+func (q *TypedObjectExpr) accept(visitor Visitor) {
+	visitor.visitTypedObjectExpr(q)
+}
+
+const VISITOR_ERROR_UNEXPECTED = "node cannot appear at this position of a query"
+
+// partialVisitor rejects every node. Visitors that only handle part of the
+// AST embed it and override the methods they support.
+type partialVisitor struct {
+	err error
+}
+
+func (v *partialVisitor) unexpected(node any) {
+	if v.err == nil {
+		v.err = &TranslationError{Node: nodeName(node), Reason: VISITOR_ERROR_UNEXPECTED}
+	}
+}
+
+func (v *partialVisitor) visitStringExpr(e *StringExpr)               { v.unexpected(e) }
+func (v *partialVisitor) visitIntExpr(e *IntExpr)                     { v.unexpected(e) }
+func (v *partialVisitor) visitTrueExpr(e *TrueExpr)                   { v.unexpected(e) }
+func (v *partialVisitor) visitFalseExpr(e *FalseExpr)                 { v.unexpected(e) }
+func (v *partialVisitor) visitNullExpr(e *NullExpr)                   { v.unexpected(e) }
+func (v *partialVisitor) visitTypedStringExpr(e *TypedStringExpr)     { v.unexpected(e) }
+func (v *partialVisitor) visitTypedArrayExpr(e *TypedArrayExpr)       { v.unexpected(e) }
+func (v *partialVisitor) visitTypedIntExpr(e *TypedIntExpr)           { v.unexpected(e) }
+func (v *partialVisitor) visitTypedBoolExpr(e *TypedBoolExpr)         { v.unexpected(e) }
+func (v *partialVisitor) visitTypedDecimalExpr(e *TypedDecimalExpr)   { v.unexpected(e) }
+func (v *partialVisitor) visitTypedObjectExpr(e *TypedObjectExpr)     { v.unexpected(e) }
+func (v *partialVisitor) visitParExpr(e *ParExpr)                     { v.unexpected(e) }
+func (v *partialVisitor) visitFnExpr(e *FnExpr)                       { v.unexpected(e) }
+func (v *partialVisitor) visitNotExpr(e *NotExpr)                     { v.unexpected(e) }
+func (v *partialVisitor) visitMinusExpr(e *MinusExpr)                 { v.unexpected(e) }
+func (v *partialVisitor) visitAndExpr(e *AndExpr)                     { v.unexpected(e) }
+func (v *partialVisitor) visitOrExpr(e *OrExpr)                       { v.unexpected(e) }
+func (v *partialVisitor) visitGtExpr(e *GtExpr)                       { v.unexpected(e) }
+func (v *partialVisitor) visitLtExpr(e *LtExpr)                       { v.unexpected(e) }
+func (v *partialVisitor) visitLteExpr(e *LteExpr)                     { v.unexpected(e) }
+func (v *partialVisitor) visitGteExpr(e *GteExpr)                     { v.unexpected(e) }
+func (v *partialVisitor) visitEqeqExpr(e *EqeqExpr)                   { v.unexpected(e) }
+func (v *partialVisitor) visitNeqExpr(e *NeqExpr)                     { v.unexpected(e) }
+func (v *partialVisitor) visitFilterSelector(s *FilterSelector)       { v.unexpected(s) }
+func (v *partialVisitor) visitWildcardSelector(s *WildCardSelector)   { v.unexpected(s) }
+func (v *partialVisitor) visitSliceSelector(s *SliceSelector)         { v.unexpected(s) }
+func (v *partialVisitor) visitNameSelector(s *NameSelector)           { v.unexpected(s) }
+func (v *partialVisitor) visitPointerSelector(s *PointerSelector)     { v.unexpected(s) }
+func (v *partialVisitor) visitDotChildSegment(s *DotChildSegment)     { v.unexpected(s) }
+func (v *partialVisitor) visitChildSegment(s *ChildSegment)           { v.unexpected(s) }
+func (v *partialVisitor) visitDescendantSegment(s *DescendantSegment) { v.unexpected(s) }
+func (v *partialVisitor) visitAbsQuery(q *AbsQuery)                   { v.unexpected(q) }
+func (v *partialVisitor) visitRelQuery(q *RelQuery)                   { v.unexpected(q) }
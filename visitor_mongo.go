@@ -0,0 +1,1214 @@
+package gojimongo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MONGO_ERROR_DESCENDANT      = "descendant segments cannot be expressed as a find filter"
+	MONGO_ERROR_SLICE           = "slices cannot be expressed as a find filter"
+	MONGO_ERROR_NEGATIVE_INDEX  = "negative indexes cannot be expressed as a find filter"
+	MONGO_ERROR_NOT_SINGULAR    = "comparison operands must be singular queries"
+	MONGO_ERROR_NOT_A_CONDITION = "expression is not a condition"
+	MONGO_ERROR_NOT_AN_OPERAND  = "expression is not a comparison operand"
+	MONGO_ERROR_NOT_A_SELECTOR  = "expression is not a selector"
+	MONGO_ERROR_TWO_QUERIES     = "comparisons between two queries can only be expressed with $expr on the document"
+	MONGO_ERROR_TWO_LITERALS    = "comparison between two literals"
+	MONGO_ERROR_CURRENT_NODE    = "the root document cannot be compared"
+	MONGO_ERROR_FIELD_NAME      = "field name cannot be used in a dotted path"
+	MONGO_ERROR_FUNCTION        = "function calls are not supported"
+	MONGO_ERROR_LITERAL_CAST    = "type assertions apply to queries, not literals"
+	MONGO_ERROR_NESTED_ARRAY    = "filters on arrays nested in arrays are not supported"
+	MONGO_ERROR_ROOT_IN_ELEMENT = "absolute queries cannot be used inside $elemMatch"
+	MONGO_ERROR_SCALAR_ELEMENT  = "comparisons of the element itself can only be combined with &&"
+	MONGO_ERROR_NEGATION        = "negated condition was only partly translated"
+	MONGO_ERROR_REGEX_INPUT     = "the first argument of match() and search() must be a singular query"
+	MONGO_ERROR_REGEX_PATTERN   = "the pattern of match() and search() must be a string literal"
+	MONGO_ERROR_OBJECT_MEMBERS  = "wildcards and filters also select object members, which a find filter cannot express"
+)
+
+const (
+	MONGO_WARNING_NULL_EQ  = "null comparison also matches missing fields"
+	MONGO_WARNING_NULL_NE  = "null inequality does not match missing fields"
+	MONGO_WARNING_WILDCARD = "wildcard is translated as array traversal and does not select object members"
+	MONGO_WARNING_FILTER   = "filter is translated as array traversal and does not test object members"
+	MONGO_WARNING_TYPE     = "type assertion also matches an array holding an element of the type"
+)
+
+// NullMode selects how comparisons with null are translated. JSONPath tells
+// an explicit null apart from a missing member, MongoDB queries do not.
+type NullMode int
+
+const (
+	// NullNative translates comparisons with null as MongoDB reads them:
+	// == null also matches missing fields and != null excludes them.
+	NullNative NullMode = iota
+	// NullStrict follows JSONPath: == null only matches an explicit null and
+	// != null matches everything else, missing fields included.
+	NullStrict
+	// NullExistence only compares fields that exist: == null matches an
+	// explicit null and != null a field holding any other value.
+	NullExistence
+)
+
+type mongoConfig struct {
+	nullMode        NullMode
+	descendantDepth int
+	arrayTraversal  bool
+}
+
+// MongoOption configures the translation of queries to MongoDB.
+type MongoOption func(*mongoConfig)
+
+// WithNullMode selects how comparisons with null are translated. The
+// default is NullNative.
+func WithNullMode(mode NullMode) MongoOption {
+	return func(c *mongoConfig) {
+		c.nullMode = mode
+	}
+}
+
+// WithDescendantDepth bounds how many levels below the node they apply to
+// descendant segments look into when translated into an aggregation
+// expression, which cannot recurse. Deeper nodes are not selected. The
+// default is 8; a depth below 1 keeps it.
+func WithDescendantDepth(depth int) MongoOption {
+	return func(c *mongoConfig) {
+		if depth > 0 {
+			c.descendantDepth = depth
+		}
+	}
+}
+
+// WithArrayTraversal translates wildcards and filters below the root into
+// MongoDB's implicit array traversal, which only selects array elements and
+// not the member values of an object. It suits collections where the nodes
+// they apply to are always arrays; the translation warns about it.
+func WithArrayTraversal() MongoOption {
+	return func(c *mongoConfig) {
+		c.arrayTraversal = true
+	}
+}
+
+func newMongoConfig(opts []MongoOption) mongoConfig {
+	c := mongoConfig{descendantDepth: descendantDepth}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// TranslationError reports an AST node the Mongo backend cannot translate.
+type TranslationError struct {
+	Node   string // AST node type, e.g. "DescendantSegment"
+	Reason string
+}
+
+func (e *TranslationError) Error() string {
+	return fmt.Sprintf("[gojimongo][mongo]: cannot translate %s: %s", e.Node, e.Reason)
+}
+
+func nodeName(node any) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*gojimongo.")
+}
+
+// mongoTrace is what the backend produced for one AST node, kept to explain
+// a translation.
+type mongoTrace struct {
+	fragment any
+	err      error
+	dropped  error // first part dropped when nothing else was translated
+	weakened bool  // the node was translated into a condition matching more
+	warnings []string
+}
+
+// mongoField is a singular query used as a comparison operand.
+type mongoField struct {
+	parts []string
+	abs   bool
+}
+
+// mongoValue is a literal used as a comparison operand.
+type mongoValue struct {
+	value any
+}
+
+var mongoComparisons = map[string]string{
+	"$gt":  "$lt",
+	"$lt":  "$gt",
+	"$gte": "$lte",
+	"$lte": "$gte",
+	"$eq":  "$eq",
+	"$ne":  "$ne",
+}
+
+// VisitorMongo translates a compiled query into a find filter matching the
+// documents for which the query selects at least one node.
+//
+// The document is the query root. Names and indexes become dotted paths and a
+// query used as a test, as in [?(@.title)], holds when it selects a node,
+// which for a singular query is an $exists.
+//
+// As in RFC 9535, wildcards and filter selectors select the elements of an
+// array and the member values of an object, so $[?(@.total > 10)] tests the
+// members of the document. Dotted paths cannot enumerate object members: a
+// query holding such selectors is translated as a whole into an $expr, as
+// are comparisons between two queries about array elements. With
+// WithArrayTraversal, wildcards and filters below the root become MongoDB's
+// implicit array traversal and predicates on the path they apply to.
+//
+// A filter on an array whose condition combines several predicates, negates
+// one, or is followed by further segments becomes an $elemMatch, so that a
+// single element has to satisfy all of it; nested filters nest $elemMatch.
+type VisitorMongo struct {
+	base      []string            // path of the node the current segment or '@' applies to
+	root      []string            // path of the node '$' refers to
+	rest      []Segment           // segments following the one being visited
+	selecting bool                // literals are selectors rather than operands
+	filter    int                 // depth of filter expressions being translated
+	usedRoot  bool                // an absolute query was translated
+	element   int                 // depth of $elemMatch being translated
+	relaxed   bool                // drop untranslatable parts instead of failing
+	dropped   []error             // why parts were dropped in relaxed mode
+	trace     map[any]*mongoTrace // per node translations, when explaining
+	config    mongoConfig
+	result    any
+	err       error
+}
+
+func NewVisitorMongo(opts ...MongoOption) *VisitorMongo {
+	return &VisitorMongo{config: newMongoConfig(opts)}
+}
+
+// Result returns the filter built by the last visited query.
+func (v *VisitorMongo) Result() (D, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	d, _ := v.result.(D)
+	if d == nil {
+		d = D{}
+	}
+	return d, nil
+}
+
+// MongoFilter translates q into a find filter document.
+func MongoFilter(q Query, opts ...MongoOption) (D, error) {
+	v := NewVisitorMongo(opts...)
+	q.accept(v)
+	return v.Result()
+}
+
+func (v *VisitorMongo) fail(node any, reason string) {
+	if v.err == nil {
+		v.err = &TranslationError{Node: nodeName(node), Reason: reason}
+	}
+	v.result = nil
+	v.record(node, nil)
+}
+
+func (v *VisitorMongo) traced(node any) *mongoTrace {
+	if v.trace == nil {
+		return nil
+	}
+	t, ok := v.trace[node]
+	if !ok {
+		t = &mongoTrace{}
+		v.trace[node] = t
+	}
+	return t
+}
+
+// record keeps the fragment node translated to, or the failure pending, when
+// explaining. The first failure recorded for a node is kept.
+func (v *VisitorMongo) record(node any, fragment any) {
+	t := v.traced(node)
+	if t == nil {
+		return
+	}
+	if v.err != nil {
+		if t.err == nil {
+			t.err = v.err
+		}
+		return
+	}
+	t.fragment, t.err, t.dropped = fragment, nil, nil
+}
+
+// recordDropped records node as translated to nothing when its fragment is
+// the always-true predicate left by failures dropped while translating it,
+// dropped being their count beforehand.
+func (v *VisitorMongo) recordDropped(node any, fragment any, dropped int) {
+	t := v.traced(node)
+	if t == nil || v.err != nil || len(v.dropped) == dropped {
+		return
+	}
+	if d, ok := fragment.(D); ok && len(d) == 0 {
+		t.fragment, t.dropped = nil, v.dropped[dropped]
+	}
+}
+
+func (v *VisitorMongo) warn(node any, warning string) {
+	t := v.traced(node)
+	if t == nil {
+		return
+	}
+	for _, w := range t.warnings {
+		if w == warning {
+			return
+		}
+	}
+	t.warnings = append(t.warnings, warning)
+}
+
+// relax turns the failure being reported into an always-true predicate when
+// the visitor is relaxed, which weakens the filter into one matching a
+// superset of the documents. It reports whether the failure was dropped.
+func (v *VisitorMongo) relax() bool {
+	if !v.relaxed || v.err == nil {
+		return false
+	}
+	v.dropped = append(v.dropped, v.err)
+	v.err = nil
+	v.result = D{}
+	return true
+}
+
+func (v *VisitorMongo) dotted(parts ...string) string {
+	return strings.Join(append(append([]string{}, v.base...), parts...), ".")
+}
+
+// segments translates "segs select something from the node at v.base".
+func (v *VisitorMongo) segments(segs []Segment) D {
+	if v.err != nil {
+		return nil
+	}
+	if len(segs) == 0 {
+		if len(v.base) == 0 {
+			return D{}
+		}
+		return D{{v.dotted(), D{{"$exists", true}}}}
+	}
+	saved := v.rest
+	v.rest = segs[1:]
+	v.result = nil
+	dropped := len(v.dropped)
+	segs[0].accept(v)
+	v.rest = saved
+	v.record(segs[0], v.result)
+	v.recordDropped(segs[0], v.result, dropped)
+	if v.relax() {
+		return D{}
+	}
+	d, _ := v.result.(D)
+	return d
+}
+
+// selector translates sel followed by the remaining segments.
+func (v *VisitorMongo) selector(sel Selector) D {
+	saved := v.selecting
+	v.selecting = true
+	v.result = nil
+	dropped := len(v.dropped)
+	sel.accept(v)
+	v.selecting = saved
+	v.record(sel, v.result)
+	v.recordDropped(sel, v.result, dropped)
+	d, _ := v.result.(D)
+	return d
+}
+
+// step descends into a member or index and translates the remaining segments.
+func (v *VisitorMongo) step(node any, name string) {
+	if name == "" || strings.Contains(name, ".") || strings.HasPrefix(name, "$") {
+		v.fail(node, MONGO_ERROR_FIELD_NAME)
+		return
+	}
+	v.base = append(v.base, name)
+	v.result = v.segments(v.rest)
+	v.base = v.base[:len(v.base)-1]
+}
+
+// condition translates a filter expression into a predicate on v.base.
+func (v *VisitorMongo) condition(e Expr) D {
+	dropped := len(v.dropped)
+	if d, ok := v.existence(e); ok {
+		v.record(e, d)
+		v.recordDropped(e, d, dropped)
+		return d
+	}
+	saved := v.selecting
+	v.selecting = false
+	v.filter++
+	v.result = nil
+	e.accept(v)
+	v.filter--
+	v.selecting = saved
+	if _, ok := v.result.(D); ok || v.err != nil {
+		v.record(e, v.result)
+		v.recordDropped(e, v.result, dropped)
+	}
+	if v.relax() {
+		return D{}
+	}
+	if v.err != nil {
+		return nil
+	}
+	d, ok := v.result.(D)
+	if !ok {
+		v.fail(e, MONGO_ERROR_NOT_A_CONDITION)
+		if v.relax() {
+			return D{}
+		}
+		return nil
+	}
+	return d
+}
+
+// existence translates a query used as a test, which holds when the query
+// selects at least one node.
+func (v *VisitorMongo) existence(e Expr) (D, bool) {
+	switch q := e.(type) {
+	case *ParExpr:
+		return v.existence(q.value)
+	case *RelQuery:
+		return v.segments(q.segments), true
+	case *AbsQuery:
+		if len(q.segments) == 0 {
+			return D{}, true
+		}
+		base := v.base
+		v.base = append([]string{}, v.root...)
+		v.usedRoot = true
+		d := v.segments(q.segments)
+		v.base = base
+		return d, true
+	}
+	return nil, false
+}
+
+// operand translates one side of a comparison.
+func (v *VisitorMongo) operand(e Expr) any {
+	saved := v.selecting
+	v.selecting = false
+	v.result = nil
+	e.accept(v)
+	v.selecting = saved
+	if v.err != nil {
+		return nil
+	}
+	switch r := v.result.(type) {
+	case mongoField:
+		v.record(e, v.resolve(r))
+		return v.result
+	case mongoValue:
+		v.record(e, r.value)
+		return v.result
+	}
+	v.fail(e, MONGO_ERROR_NOT_AN_OPERAND)
+	return nil
+}
+
+// field resolves a singular query operand into its path.
+func (v *VisitorMongo) field(segs []Segment, abs bool) {
+	parts := []string{}
+	for _, seg := range segs {
+		name, ok := singularStep(seg)
+		if !ok {
+			v.fail(seg, MONGO_ERROR_NOT_SINGULAR)
+			return
+		}
+		if strings.Contains(name, ".") || strings.HasPrefix(name, "$") {
+			v.fail(seg, MONGO_ERROR_FIELD_NAME)
+			return
+		}
+		parts = append(parts, name)
+	}
+	v.result = mongoField{parts: parts, abs: abs}
+}
+
+// singularStep returns the member name or index a segment selects when it
+// selects at most one node.
+func singularStep(seg Segment) (string, bool) {
+	var sel Selector
+	switch s := seg.(type) {
+	case *DotChildSegment:
+		sel = s.selector
+	case *ChildSegment:
+		if len(s.selectors) != 1 {
+			return "", false
+		}
+		sel = s.selectors[0]
+	default:
+		return "", false
+	}
+	switch s := sel.(type) {
+	case *NameSelector:
+		return s.value, true
+	case *StringExpr:
+		return unquote(s.value), true
+	case *IntExpr:
+		return strconv.Itoa(s.value), true
+	case *PointerSelector:
+		return strconv.Itoa(s.index), true
+	}
+	return "", false
+}
+
+func (v *VisitorMongo) path(f mongoField) string {
+	if f.abs {
+		v.usedRoot = true
+	}
+	return v.resolve(f)
+}
+
+// resolve returns the dotted path of a field operand.
+func (v *VisitorMongo) resolve(f mongoField) string {
+	if f.abs {
+		return strings.Join(append(append([]string{}, v.root...), f.parts...), ".")
+	}
+	return v.dotted(f.parts...)
+}
+
+func (v *VisitorMongo) compare(e Expr, op string, lhs, rhs Expr) {
+	if computed(lhs) || computed(rhs) {
+		v.exprCompare(e)
+		return
+	}
+	l := v.operand(lhs)
+	r := v.operand(rhs)
+	if v.err != nil {
+		return
+	}
+	lf, lok := l.(mongoField)
+	rf, rok := r.(mongoField)
+	switch {
+	case lok && rok:
+		v.exprCompare(e)
+	case lok:
+		v.predicate(e, lf, op, r.(mongoValue).value)
+	case rok:
+		v.predicate(e, rf, mongoComparisons[op], l.(mongoValue).value)
+	default:
+		v.fail(e, MONGO_ERROR_TWO_LITERALS)
+	}
+}
+
+// exprCompare fails on a comparison between two queries, or an expression
+// involving a function or a conversion, which a find filter can only express
+// by translating the whole query with exprQuery.
+func (v *VisitorMongo) exprCompare(e Expr) {
+	v.fail(e, MONGO_ERROR_TWO_QUERIES)
+}
+
+// exprQuery translates a whole query into an $expr testing that it selects a
+// node, preceded by an $exists on its leading path so that an index can
+// narrow the documents scanned.
+func exprQuery(segs []Segment, depth int) (D, error) {
+	agg := NewVisitorAggExpr("$$ROOT", "$$ROOT")
+	agg.depth = depth
+	nodes := agg.nodes(segs, "$$ROOT")
+	if agg.err != nil {
+		return nil, agg.err
+	}
+	prefix := []string{}
+	for _, seg := range segs {
+		name, ok := singularStep(seg)
+		if !ok || name == "" || strings.Contains(name, ".") || strings.HasPrefix(name, "$") {
+			break
+		}
+		prefix = append(prefix, name)
+	}
+	exists := D{}
+	if len(prefix) > 0 {
+		exists = D{{strings.Join(prefix, "."), D{{"$exists", true}}}}
+	}
+	return conjunction(exists, D{{"$expr", D{{"$gt", A{D{{"$size", nodes.list}}, 0}}}}}), nil
+}
+
+// comparesQueries reports whether a filter in segs compares two queries, or
+// the result of a function, which find filters can only express by
+// translating the whole query with exprQuery.
+func comparesQueries(segs []Segment) bool {
+	for _, seg := range segs {
+		var sels []Selector
+		switch s := seg.(type) {
+		case *DotChildSegment:
+			sels = []Selector{s.selector}
+		case *ChildSegment:
+			sels = s.selectors
+		case *DescendantSegment:
+			sels = s.selectors
+		}
+		for _, sel := range sels {
+			if f, ok := sel.(*FilterSelector); ok && exprComparesQueries(f.cond) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func exprComparesQueries(e Expr) bool {
+	var lhs, rhs Expr
+	switch e := e.(type) {
+	case *ParExpr:
+		return exprComparesQueries(e.value)
+	case *NotExpr:
+		return exprComparesQueries(e.expr)
+	case *AndExpr:
+		return exprComparesQueries(e.lhs) || exprComparesQueries(e.rhs)
+	case *OrExpr:
+		return exprComparesQueries(e.lhs) || exprComparesQueries(e.rhs)
+	case *RelQuery:
+		return comparesQueries(e.segments)
+	case *AbsQuery:
+		return comparesQueries(e.segments)
+	case *GtExpr:
+		lhs, rhs = e.lhs, e.rhs
+	case *GteExpr:
+		lhs, rhs = e.lhs, e.rhs
+	case *LtExpr:
+		lhs, rhs = e.lhs, e.rhs
+	case *LteExpr:
+		lhs, rhs = e.lhs, e.rhs
+	case *EqeqExpr:
+		lhs, rhs = e.lhs, e.rhs
+	case *NeqExpr:
+		lhs, rhs = e.lhs, e.rhs
+	case *FnExpr:
+		for _, param := range e.params {
+			if computed(param) {
+				return true
+			}
+		}
+		return false
+	default:
+		if _, value, ok := castOf(e); ok {
+			if isLogical(value) {
+				return exprComparesQueries(value)
+			}
+			return computed(value)
+		}
+		return false
+	}
+	isQuery := func(e Expr) bool {
+		switch e.(type) {
+		case *RelQuery, *AbsQuery:
+			return true
+		}
+		return false
+	}
+	if isQuery(lhs) && isQuery(rhs) || computed(lhs) || computed(rhs) {
+		return true
+	}
+	return exprComparesQueries(lhs) || exprComparesQueries(rhs)
+}
+
+func (v *VisitorMongo) predicate(e Expr, f mongoField, op string, value any) {
+	path := v.path(f)
+	if path == "" && v.element == 0 {
+		v.fail(e, MONGO_ERROR_CURRENT_NODE)
+		return
+	}
+	if value == nil && (op == "$eq" || op == "$ne") {
+		v.result = D{{path, v.null(e, op, path == "")}}
+		return
+	}
+	v.result = D{{path, D{{op, value}}}}
+}
+
+// null translates == null or != null according to the null mode. The
+// element of an array, whose path is empty, always exists.
+func (v *VisitorMongo) null(e Expr, op string, element bool) D {
+	switch v.config.nullMode {
+	case NullStrict:
+		if op == "$eq" {
+			return D{{"$type", "null"}}
+		}
+		return D{{"$not", D{{"$type", "null"}}}}
+	case NullExistence:
+		if element {
+			return D{{op, nil}}
+		}
+		return D{{"$exists", true}, {op, nil}}
+	}
+	if op == "$eq" {
+		v.warn(e, MONGO_WARNING_NULL_EQ)
+	} else {
+		v.warn(e, MONGO_WARNING_NULL_NE)
+	}
+	return D{{op, nil}}
+}
+
+// conjunction joins predicates with $and, flattening nested conjunctions and
+// dropping empty (always true) documents.
+func conjunction(preds ...D) D {
+	return junction("$and", preds)
+}
+
+func disjunction(preds ...D) D {
+	return junction("$or", preds)
+}
+
+func junction(op string, preds []D) D {
+	items := A{}
+	for _, p := range preds {
+		if len(p) == 0 {
+			if op == "$or" {
+				return D{}
+			}
+			continue
+		}
+		if len(p) == 1 && p[0].Key == op {
+			items = append(items, p[0].Value.(A)...)
+			continue
+		}
+		items = append(items, p)
+	}
+	switch len(items) {
+	case 0:
+		return D{}
+	case 1:
+		return items[0].(D)
+	}
+	return D{{op, items}}
+}
+
+// LITERAL EXPRESSIONS
+func (v *VisitorMongo) visitStringExpr(e *StringExpr) {
+	if v.selecting {
+		v.step(e, unquote(e.value))
+		return
+	}
+	v.result = mongoValue{value: unquote(e.value)}
+}
+
+func (v *VisitorMongo) visitIntExpr(e *IntExpr) {
+	if v.selecting {
+		v.step(e, strconv.Itoa(e.value))
+		return
+	}
+	v.result = mongoValue{value: e.value}
+}
+
+func (v *VisitorMongo) visitTrueExpr(e *TrueExpr) {
+	v.literal(e, true)
+}
+
+func (v *VisitorMongo) visitFalseExpr(e *FalseExpr) {
+	v.literal(e, false)
+}
+
+func (v *VisitorMongo) visitNullExpr(e *NullExpr) {
+	v.literal(e, nil)
+}
+
+func (v *VisitorMongo) literal(e Expr, value any) {
+	if v.selecting {
+		v.fail(e, MONGO_ERROR_NOT_A_SELECTOR)
+		return
+	}
+	v.result = mongoValue{value: value}
+}
+
+func (v *VisitorMongo) visitTypedStringExpr(e *TypedStringExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorMongo) visitTypedArrayExpr(e *TypedArrayExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorMongo) visitTypedIntExpr(e *TypedIntExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorMongo) visitTypedBoolExpr(e *TypedBoolExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorMongo) visitTypedDecimalExpr(e *TypedDecimalExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorMongo) visitTypedObjectExpr(e *TypedObjectExpr) {
+	v.cast(e)
+}
+
+// cast translates a cast. As a test it asserts the type of a field with
+// $type; as a selector it converts its literal. A conversion is compared
+// within an $expr, see compare.
+func (v *VisitorMongo) cast(e Expr) {
+	kind, value, _ := castOf(e)
+	switch {
+	case isLogical(value):
+		value.accept(v)
+	case v.selecting:
+		v.castSelector(e, kind, value)
+	case computed(value):
+		v.exprCompare(e)
+	default:
+		v.typeAssertion(e, kind, value)
+	}
+}
+
+// typeAssertion translates a type assertion on a field. Like every predicate,
+// $type also matches an array field holding an element of the type.
+func (v *VisitorMongo) typeAssertion(e Expr, kind castKind, value Expr) {
+	o := v.operand(value)
+	if v.err != nil {
+		return
+	}
+	f, ok := o.(mongoField)
+	if !ok {
+		v.fail(e, MONGO_ERROR_LITERAL_CAST)
+		return
+	}
+	path := v.path(f)
+	if path == "" && v.element == 0 {
+		v.fail(e, MONGO_ERROR_CURRENT_NODE)
+		return
+	}
+	if path != "" && kind != castArray {
+		v.warn(e, MONGO_WARNING_TYPE)
+	}
+	v.result = D{{path, D{{"$type", castTypes[kind]}}}}
+}
+
+// castSelector selects the member or element a converted literal names.
+func (v *VisitorMongo) castSelector(e Expr, kind castKind, value Expr) {
+	literal, ok := literalValue(value)
+	if !ok {
+		v.fail(e, MONGO_ERROR_NOT_A_SELECTOR)
+		return
+	}
+	switch sel := evalCast(kind, literal).(type) {
+	case string:
+		v.step(e, sel)
+	case int:
+		if sel < 0 {
+			v.fail(e, MONGO_ERROR_NEGATIVE_INDEX)
+			return
+		}
+		v.step(e, strconv.Itoa(sel))
+	default:
+		v.fail(e, MONGO_ERROR_NOT_A_SELECTOR)
+	}
+}
+
+func (v *VisitorMongo) visitParExpr(e *ParExpr) {
+	dropped := len(v.dropped)
+	e.value.accept(v)
+	if _, ok := v.result.(D); ok {
+		v.record(e.value, v.result)
+		v.recordDropped(e.value, v.result, dropped)
+	}
+}
+
+func (v *VisitorMongo) visitFnExpr(e *FnExpr) {
+	switch e.name {
+	case "match", "search":
+		v.regex(e)
+	default:
+		v.fail(e, MONGO_ERROR_FUNCTION)
+	}
+}
+
+// regex translates match() and search() into a $regex on the field of their
+// first argument. The I-Regexp is rewritten so that it needs no option: match()
+// is anchored to the whole string and '.' excludes line breaks as it does in
+// I-Regexp. Like every predicate, $regex also matches the elements of an
+// array field.
+func (v *VisitorMongo) regex(e *FnExpr) {
+	if len(e.params) != 2 {
+		v.fail(e, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	if computed(e.params[0]) {
+		v.exprCompare(e)
+		return
+	}
+	pattern, ok := e.params[1].(*StringExpr)
+	if !ok {
+		v.fail(e, MONGO_ERROR_REGEX_PATTERN)
+		return
+	}
+	input := v.operand(e.params[0])
+	if v.err != nil {
+		return
+	}
+	f, ok := input.(mongoField)
+	if !ok {
+		v.fail(e, MONGO_ERROR_REGEX_INPUT)
+		return
+	}
+	re, err := translateIRegexp(unquote(pattern.value), e.name == "match")
+	if err != nil {
+		v.err = err
+		v.result = nil
+		v.record(e, nil)
+		return
+	}
+	v.record(pattern, re)
+	path := v.path(f)
+	if path == "" && v.element == 0 {
+		v.fail(e, MONGO_ERROR_CURRENT_NODE)
+		return
+	}
+	v.result = D{{path, D{{"$regex", re}}}}
+}
+
+// UNARY EXPRESSIONS
+func (v *VisitorMongo) visitNotExpr(e *NotExpr) {
+	dropped := len(v.dropped)
+	cond := v.condition(e.expr)
+	if v.err != nil {
+		return
+	}
+	if len(v.dropped) > dropped {
+		// the negation of a weakened condition is stronger, not weaker
+		v.fail(e, MONGO_ERROR_NEGATION)
+		return
+	}
+	v.result = D{{"$nor", A{cond}}}
+}
+
+func (v *VisitorMongo) visitMinusExpr(e *MinusExpr) {
+	if v.selecting {
+		v.fail(e, MONGO_ERROR_NEGATIVE_INDEX)
+		return
+	}
+	value, ok := v.operand(e.expr).(mongoValue)
+	if v.err != nil {
+		return
+	}
+	n, isInt := value.value.(int)
+	if !ok || !isInt {
+		v.fail(e, MONGO_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.result = mongoValue{value: -n}
+}
+
+// BINARY EXPRESSIONS
+func (v *VisitorMongo) visitAndExpr(e *AndExpr) {
+	lhs := v.condition(e.lhs)
+	rhs := v.condition(e.rhs)
+	if v.err != nil {
+		return
+	}
+	v.result = conjunction(lhs, rhs)
+}
+
+func (v *VisitorMongo) visitOrExpr(e *OrExpr) {
+	lhs := v.condition(e.lhs)
+	rhs := v.condition(e.rhs)
+	if v.err != nil {
+		return
+	}
+	v.result = disjunction(lhs, rhs)
+}
+
+func (v *VisitorMongo) visitGtExpr(e *GtExpr) {
+	v.compare(e, "$gt", e.lhs, e.rhs)
+}
+
+func (v *VisitorMongo) visitLtExpr(e *LtExpr) {
+	v.compare(e, "$lt", e.lhs, e.rhs)
+}
+
+func (v *VisitorMongo) visitLteExpr(e *LteExpr) {
+	v.compare(e, "$lte", e.lhs, e.rhs)
+}
+
+func (v *VisitorMongo) visitGteExpr(e *GteExpr) {
+	v.compare(e, "$gte", e.lhs, e.rhs)
+}
+
+func (v *VisitorMongo) visitEqeqExpr(e *EqeqExpr) {
+	v.compare(e, "$eq", e.lhs, e.rhs)
+}
+
+func (v *VisitorMongo) visitNeqExpr(e *NeqExpr) {
+	v.compare(e, "$ne", e.lhs, e.rhs)
+}
+
+// members translates a wildcard or filter selector, applying to the node at
+// v.base, with array, which translates it as array traversal. Unless
+// WithArrayTraversal is set the node may also be an object, whose member
+// values array traversal misses: the selector fails, or when relaxed matches
+// every document where the node is an object as well. The document itself is
+// always an object.
+func (v *VisitorMongo) members(s Selector, array func()) {
+	if len(v.base) == 0 && (v.element == 0 || !v.config.arrayTraversal) ||
+		!v.config.arrayTraversal && !v.relaxed {
+		v.fail(s, MONGO_ERROR_OBJECT_MEMBERS)
+		return
+	}
+	array()
+	if v.config.arrayTraversal || v.err != nil {
+		return
+	}
+	d, _ := v.result.(D)
+	v.dropped = append(v.dropped, &TranslationError{Node: nodeName(s), Reason: MONGO_ERROR_OBJECT_MEMBERS})
+	v.result = disjunction(d, D{{v.dotted(), D{{"$type", "object"}}}})
+	if t := v.traced(s); t != nil {
+		t.weakened = true
+	}
+}
+
+// SELECTORS
+func (v *VisitorMongo) visitFilterSelector(s *FilterSelector) {
+	v.members(s, func() {
+		if len(v.base) == 0 {
+			v.fail(s, MONGO_ERROR_NESTED_ARRAY)
+			return
+		}
+		if v.config.arrayTraversal {
+			v.warn(s, MONGO_WARNING_FILTER)
+		}
+		if len(v.rest) > 0 || scoped(s.cond) {
+			v.elemMatch(s)
+			return
+		}
+		cond := v.condition(s.cond)
+		rest := D{}
+		if len(v.rest) > 0 {
+			rest = v.segments(v.rest)
+		}
+		if v.err != nil {
+			return
+		}
+		v.result = conjunction(cond, rest)
+	})
+}
+
+// scoped reports whether a filter condition must be tested against a single
+// array element. Dotted predicates are each satisfied by any element, which
+// is only right for a single positive comparison or a disjunction of them.
+func scoped(e Expr) bool {
+	switch e := e.(type) {
+	case *AndExpr, *NotExpr, *NeqExpr:
+		return true
+	case *OrExpr:
+		return scoped(e.lhs) || scoped(e.rhs)
+	case *ParExpr:
+		return scoped(e.value)
+	}
+	if _, value, ok := castOf(e); ok {
+		return scoped(value)
+	}
+	return false
+}
+
+// elemMatch translates a filter, and the segments following it, into an
+// $elemMatch on the array at v.base so a single element satisfies all of it.
+func (v *VisitorMongo) elemMatch(s *FilterSelector) {
+	path := v.dotted()
+	base, usedRoot := v.base, v.usedRoot
+	v.base, v.usedRoot = nil, false
+	v.element++
+	cond := v.condition(s.cond)
+	rest := D{}
+	if len(v.rest) > 0 {
+		rest = v.segments(v.rest)
+	}
+	v.element--
+	elementUsedRoot := v.usedRoot
+	v.base, v.usedRoot = base, usedRoot || elementUsedRoot
+	if v.err != nil {
+		return
+	}
+	if elementUsedRoot {
+		v.fail(s, MONGO_ERROR_ROOT_IN_ELEMENT)
+		return
+	}
+	query, ok := elementQuery(conjunction(cond, rest))
+	if !ok {
+		v.fail(s, MONGO_ERROR_SCALAR_ELEMENT)
+		return
+	}
+	if len(query) == 0 {
+		v.result = D{}
+		return
+	}
+	v.result = D{{path, D{{"$elemMatch", implicitAnd(query)}}}}
+}
+
+// implicitAnd merges a conjunction of predicates on distinct fields into a
+// single document, the usual way of writing them.
+func implicitAnd(d D) D {
+	if len(d) != 1 || d[0].Key != "$and" {
+		return d
+	}
+	merged := D{}
+	for _, item := range d[0].Value.(A) {
+		pred := item.(D)
+		if len(pred) != 1 || strings.HasPrefix(pred[0].Key, "$") {
+			return d
+		}
+		if _, dup := merged.Get(pred[0].Key); dup {
+			return d
+		}
+		merged = append(merged, pred[0])
+	}
+	return merged
+}
+
+// elementQuery turns predicates on the element itself, which predicate
+// leaves under an empty path, into the operator form $elemMatch expects for
+// arrays of scalars.
+func elementQuery(d D) (D, bool) {
+	hasElement := func(d D) bool {
+		for _, e := range d {
+			if e.Key == "" {
+				return true
+			}
+			if items, ok := e.Value.(A); ok {
+				for _, item := range items {
+					if sub, ok := item.(D); ok && len(sub) > 0 && sub[0].Key == "" {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+	if !hasElement(d) {
+		return d, true
+	}
+	if len(d) == 1 && d[0].Key == "" {
+		return d[0].Value.(D), true
+	}
+	if len(d) != 1 || d[0].Key != "$and" {
+		return nil, false
+	}
+	ops := D{}
+	for _, item := range d[0].Value.(A) {
+		pred := item.(D)
+		if len(pred) != 1 || pred[0].Key != "" {
+			return nil, false
+		}
+		for _, op := range pred[0].Value.(D) {
+			if _, dup := ops.Get(op.Key); dup {
+				return nil, false
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, true
+}
+
+func (v *VisitorMongo) visitWildcardSelector(s *WildCardSelector) {
+	v.members(s, func() {
+		if v.config.arrayTraversal {
+			v.warn(s, MONGO_WARNING_WILDCARD)
+		}
+		if len(v.rest) > 0 {
+			v.result = v.segments(v.rest)
+			return
+		}
+		if len(v.base) == 0 {
+			v.result = D{}
+			return
+		}
+		v.result = D{{v.dotted("0"), D{{"$exists", true}}}}
+	})
+}
+
+func (v *VisitorMongo) visitSliceSelector(s *SliceSelector) {
+	v.fail(s, MONGO_ERROR_SLICE)
+}
+
+func (v *VisitorMongo) visitNameSelector(s *NameSelector) {
+	if !v.selecting {
+		v.fail(s, MONGO_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.step(s, s.value)
+}
+
+// visitPointerSelector steps to the element of an array or the member of an
+// object, which a dotted path reaches alike.
+func (v *VisitorMongo) visitPointerSelector(s *PointerSelector) {
+	if !v.selecting {
+		v.fail(s, MONGO_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.step(s, strconv.Itoa(s.index))
+}
+
+// query translates a top-level query. Queries comparing two queries about
+// array elements, or selecting object members, are translated as a whole
+// into an $expr; in relaxed mode the comparisons are dropped as other
+// untranslatable parts when that fails, and selectors of object members are
+// weakened, see members.
+func (v *VisitorMongo) query(segs []Segment) {
+	v.base = nil
+	if comparesQueries(segs) {
+		d, err := exprQuery(segs, v.config.descendantDepth)
+		if err == nil || !v.relaxed {
+			v.result, v.err = d, err
+			return
+		}
+	}
+	v.result = v.segments(segs)
+	var terr *TranslationError
+	if !v.relaxed && errors.As(v.err, &terr) && terr.Reason == MONGO_ERROR_OBJECT_MEMBERS {
+		d, err := exprQuery(segs, v.config.descendantDepth)
+		v.result, v.err = d, err
+	}
+}
+
+// SEGMENTS
+func (v *VisitorMongo) visitDotChildSegment(s *DotChildSegment) {
+	v.result = v.selector(s.selector)
+}
+
+// visitChildSegment ORs the alternatives of a bracketed segment; alternatives
+// translating to the same predicate, such as [0,'0'], are merged.
+func (v *VisitorMongo) visitChildSegment(s *ChildSegment) {
+	alternatives := []D{}
+	for _, sel := range s.selectors {
+		d := v.selector(sel)
+		if v.err != nil {
+			return
+		}
+		duplicate := false
+		for _, alt := range alternatives {
+			if reflect.DeepEqual(alt, d) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			alternatives = append(alternatives, d)
+		}
+	}
+	v.result = disjunction(alternatives...)
+}
+
+func (v *VisitorMongo) visitDescendantSegment(s *DescendantSegment) {
+	v.fail(s, MONGO_ERROR_DESCENDANT)
+}
+
+func (v *VisitorMongo) visitAbsQuery(q *AbsQuery) {
+	if v.filter > 0 {
+		v.field(q.segments, true)
+		return
+	}
+	v.query(q.segments)
+}
+
+func (v *VisitorMongo) visitRelQuery(q *RelQuery) {
+	if v.filter > 0 {
+		v.field(q.segments, false)
+		return
+	}
+	v.query(q.segments)
+}
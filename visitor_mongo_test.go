@@ -0,0 +1,244 @@
+package gojimongo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMongoFilter(t *testing.T) {
+	queries := map[string]string{
+		"$":                     `{}`,
+		"$.hello":               `{"hello":{"$exists":true}}`,
+		"$['hello'][0]":         `{"hello.0":{"$exists":true}}`,
+		"$.store.book[0].title": `{"store.book.0.title":{"$exists":true}}`,
+		"$.orders[?(@.total > 10 && @.status == 'open')]": `{"orders":{"$elemMatch":{"total":{"$gt":10},"status":{"$eq":"open"}}}}`,
+		"$.orders[?(@.total < 10 || @.total >= 100)]":     `{"$or":[{"orders.total":{"$lt":10}},{"orders.total":{"$gte":100}}]}`,
+		"$.orders[?(!(@.status == 'open'))]":              `{"orders":{"$elemMatch":{"$nor":[{"status":{"$eq":"open"}}]}}}`,
+		"$.orders[?(10 < @.total)]":                       `{"orders.total":{"$gt":10}}`,
+		"$.orders[?(@.total <= -1)]":                      `{"orders.total":{"$lte":-1}}`,
+		"$.orders[?(@.status != null)]":                   `{"orders":{"$elemMatch":{"status":{"$ne":null}}}}`,
+		"$.tags[?(@ == 'go')]":                            `{"tags":{"$eq":"go"}}`,
+		"$.orders[*].items[?(@.sku == 'X')]":              `{"orders.items.sku":{"$eq":"X"}}`,
+		"$.orders[*]":                                     `{"orders.0":{"$exists":true}}`,
+		"$.a[?(@.b == true)].c":                           `{"a":{"$elemMatch":{"b":{"$eq":true},"c":{"$exists":true}}}}`,
+		"$['a','b']":                                      `{"$or":[{"a":{"$exists":true}},{"b":{"$exists":true}}]}`,
+		"$.a[0,'0']":                                      `{"a.0":{"$exists":true}}`,
+		"$.users[?match(@.name, 'J.*')]":                  `{"users.name":{"$regex":"^(?:J[^\\n\\r]*)\\z"}}`,
+		"$.users[?search(@.name, 'an|on')]":               `{"users.name":{"$regex":"an|on"}}`,
+		"$.users[?search(@.name, '^J$')]":                 `{"users.name":{"$regex":"\\^J\\$"}}`,
+		"$.tags[?match(@, '[a-z]+')]":                     `{"tags":{"$regex":"^(?:[a-z]+)\\z"}}`,
+		"$.users[?!match(@.name, 'J.*')]":                 `{"users":{"$elemMatch":{"$nor":[{"name":{"$regex":"^(?:J[^\\n\\r]*)\\z"}}]}}}`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		filter, err := MongoFilter(q, WithArrayTraversal())
+		if expected == "" {
+			if err == nil {
+				t.Errorf("MongoFilter(%q) = %s; expected an error", query, filter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MongoFilter(%q) = %v", query, err)
+			continue
+		}
+		if filter.String() != expected {
+			t.Errorf("MongoFilter(%q) = %s; expected %s", query, filter, expected)
+		}
+	}
+}
+
+func TestMongoFilterElemMatch(t *testing.T) {
+	queries := map[string]string{
+		"$.orders[?(@.qty > 5 && @.price < 10)]":                              `{"orders":{"$elemMatch":{"qty":{"$gt":5},"price":{"$lt":10}}}}`,
+		"$.orders[?(@.qty > 5 && @.qty < 10)]":                                `{"orders":{"$elemMatch":{"$and":[{"qty":{"$gt":5}},{"qty":{"$lt":10}}]}}}`,
+		"$.orders[?(@.qty > 5 || @.price < 10)]":                              `{"$or":[{"orders.qty":{"$gt":5}},{"orders.price":{"$lt":10}}]}`,
+		"$.orders[?(@.qty > 5 || (@.price < 10 && @.sale == true))]":          `{"orders":{"$elemMatch":{"$or":[{"qty":{"$gt":5}},{"$and":[{"price":{"$lt":10}},{"sale":{"$eq":true}}]}]}}}`,
+		"$.orders[?(@.status == 'open')].items[?(@.qty > 1 && @.sku == 'X')]": `{"orders":{"$elemMatch":{"status":{"$eq":"open"},"items":{"$elemMatch":{"qty":{"$gt":1},"sku":{"$eq":"X"}}}}}}`,
+		"$.orders[*].items[?(@.qty > 1 && @.sku == 'X')]":                     `{"orders.items":{"$elemMatch":{"qty":{"$gt":1},"sku":{"$eq":"X"}}}}`,
+		"$.scores[?(@ > 5 && @ < 10)]":                                        `{"scores":{"$elemMatch":{"$gt":5,"$lt":10}}}`,
+		"$.scores[?(@ != 5)]":                                                 `{"scores":{"$elemMatch":{"$ne":5}}}`,
+		"$.books[?(@.title)]":                                                 `{"books.title":{"$exists":true}}`,
+		"$.books[?(!@.isbn)]":                                                 `{"books":{"$elemMatch":{"$nor":[{"isbn":{"$exists":true}}]}}}`,
+		"$.books[?(@.tags[*] && @.a)]":                                        `{"books":{"$elemMatch":{"tags.0":{"$exists":true},"a":{"$exists":true}}}}`,
+		"$.books[?($.flag)]":                                                  `{"flag":{"$exists":true}}`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		filter, err := MongoFilter(q, WithArrayTraversal())
+		if err != nil {
+			t.Errorf("MongoFilter(%q) = %v", query, err)
+			continue
+		}
+		if filter.String() != expected {
+			t.Errorf("MongoFilter(%q) = %s; expected %s", query, filter, expected)
+		}
+	}
+}
+
+func TestMongoFilterErrors(t *testing.T) {
+	queries := map[string]string{
+		"$..author":                   "DescendantSegment",
+		"$.book[0:3]":                 "SliceSelector",
+		"$.book[-1]":                  "MinusExpr",
+		"$.book[?(1 == 1)]":           "EqeqExpr",
+		"$['a.b']":                    "StringExpr",
+		"$.a[?(@.b > 1 && $.c == 2)]": "FilterSelector",
+		"$.a[?(!(@ > 1))]":            "FilterSelector",
+		"$.book[?(@.a.* > 1)]":        "", // the checker rejects it first
+	}
+	c := &Compiler{}
+	for query, node := range queries {
+		q, err := c.Compile(query)
+		if node == "" {
+			if err == nil || !strings.Contains(err.Error(), CHECKER_ERROR_NOT_SINGULAR) {
+				t.Errorf("Compile(%q) = %v; expected a non-singular comparison error", query, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		_, err = MongoFilter(q, WithArrayTraversal())
+		var terr *TranslationError
+		if !errors.As(err, &terr) {
+			t.Errorf("MongoFilter(%q) = %v; expected a TranslationError", query, err)
+			continue
+		}
+		if terr.Node != node {
+			t.Errorf("MongoFilter(%q) failed on %s; expected %s", query, terr.Node, node)
+		}
+	}
+}
+
+func TestMongoFilterNullModes(t *testing.T) {
+	queries := map[string][3]string{
+		"$.a[?(@.b == null)]": {
+			`{"a.b":{"$eq":null}}`,
+			`{"a.b":{"$type":"null"}}`,
+			`{"a.b":{"$exists":true,"$eq":null}}`,
+		},
+		"$.a[?(null != @.b)]": {
+			`{"a":{"$elemMatch":{"b":{"$ne":null}}}}`,
+			`{"a":{"$elemMatch":{"b":{"$not":{"$type":"null"}}}}}`,
+			`{"a":{"$elemMatch":{"b":{"$exists":true,"$ne":null}}}}`,
+		},
+		"$.a[?(@ == null && @ != 1)]": {
+			`{"a":{"$elemMatch":{"$eq":null,"$ne":1}}}`,
+			`{"a":{"$elemMatch":{"$type":"null","$ne":1}}}`,
+			`{"a":{"$elemMatch":{"$eq":null,"$ne":1}}}`,
+		},
+		"$.a[?(@ == null)]": {
+			`{"a":{"$eq":null}}`,
+			`{"a":{"$type":"null"}}`,
+			`{"a":{"$exists":true,"$eq":null}}`,
+		},
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		for i, mode := range []NullMode{NullNative, NullStrict, NullExistence} {
+			filter, err := MongoFilter(q, WithNullMode(mode), WithArrayTraversal())
+			if err != nil {
+				t.Errorf("MongoFilter(%q, %d) = %v", query, mode, err)
+				continue
+			}
+			if filter.String() != expected[i] {
+				t.Errorf("MongoFilter(%q, %d) = %s; expected %s", query, mode, filter, expected[i])
+			}
+		}
+	}
+}
+
+func TestMongoFilterExpr(t *testing.T) {
+	queries := map[string][]string{
+		"$[?(@.total > 10)]": {
+			`{"$expr":{"$gt":[{"$size":{"$filter":`,
+			`{"$objectToArray":"$$ROOT"}`,
+			`{"$gt":["$$n3",10]}`,
+		},
+		"$[?(@.title)]": {
+			`{"$objectToArray":"$$ROOT"}`,
+			`"$$n1.title"`,
+		},
+		"$[?(@.qty > 5 && @.price < 10)]": {
+			`{"$objectToArray":"$$ROOT"}`,
+			`{"$and":[{"$let":`,
+		},
+		"$.*": {
+			`{"$expr":{"$gt":[{"$size":{"$cond":[{"$isArray":"$$ROOT"}`,
+		},
+		"$.a.*": {
+			`{"$and":[{"a":{"$exists":true}},{"$expr":`,
+			`{"$objectToArray":"$$ROOT.a"}`,
+		},
+		"$.a[?(@ > 1)]": {
+			`{"$and":[{"a":{"$exists":true}},{"$expr":`,
+			`{"$objectToArray":"$$ROOT.a"}`,
+		},
+		"$.a[*].b": {
+			`{"$and":[{"a":{"$exists":true}},{"$expr":`,
+			`{"$objectToArray":"$$ROOT.a"}`,
+			`"$$n2.b"`,
+		},
+		"$[?(@.discount > @.price)]": {
+			`{"$expr":{"$gt":[{"$size":{"$filter":`,
+			`{"$gt":["$$n4","$$n5"]}`,
+		},
+		"$[?(@.a == $.defaults.a && @.b == 1)]": {
+			`{"$expr":`,
+			`"$$ROOT.defaults.a"`,
+			`{"$eq":["$$n7",1]}`,
+		},
+		"$.orders[?(@.discount > @.price)]": {
+			`{"$and":[{"orders":{"$exists":true}},{"$expr":{"$gt":[{"$size":{"$filter":`,
+			`{"$gt":["$$n`,
+		},
+		"$.orders[?(@.total > 10 && @.items[?(@.qty > @.stock)])]": {
+			`{"$and":[{"orders":{"$exists":true}},{"$expr":`,
+		},
+		"$[?@int(count(@.devices) >= 10)]": {
+			`{"$expr":`,
+			`{"$gte":["$$n3",10]}`,
+		},
+		"$[?length(@.tags) == 2]": {
+			`{"$strLenCP":"$$n3"}`,
+			`{"$size":"$$n3"}`,
+			`{"$size":{"$objectToArray":"$$n3"}}`,
+			`{"$eq":["$$n4",2]}`,
+		},
+		"$.users[?length(@.name) > 3]": {
+			`{"$and":[{"users":{"$exists":true}},{"$expr":`,
+			`{"$strLenCP":"$$n3"}`,
+		},
+	}
+	c := &Compiler{}
+	for query, fragments := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		filter, err := MongoFilter(q)
+		if err != nil {
+			t.Errorf("MongoFilter(%q) = %v", query, err)
+			continue
+		}
+		for _, fragment := range fragments {
+			if !strings.Contains(filter.String(), fragment) {
+				t.Errorf("MongoFilter(%q) = %s does not contain %s", query, filter, fragment)
+			}
+		}
+	}
+}
@@ -0,0 +1,1032 @@
+package gojimongo
+
+import (
+	"strconv"
+	"strings"
+)
+
+// descendantDepth bounds how deep descendant segments look into a document
+// when translated into an aggregation expression, which cannot recurse,
+// unless WithDescendantDepth sets another bound.
+const descendantDepth = 8
+
+// VisitorAggExpr translates selectors and filter expressions into aggregation
+// expressions. Selectors produce the array of nodes they select from input;
+// filter expressions produce booleans about the node held in current.
+//
+// Missing nodes are represented by $$REMOVE, so a singular query that
+// selects nothing behaves like a missing field.
+type VisitorAggExpr struct {
+	current   string // expression holding the node '@' refers to
+	root      string // expression holding the node '$' refers to
+	input     string // expression holding the node a selector applies to
+	selecting bool
+	depth     int // levels below a node descendant segments look into
+	vars      int
+	usedRoot  bool
+	result    any
+	err       error
+}
+
+func NewVisitorAggExpr(current, root string) *VisitorAggExpr {
+	return &VisitorAggExpr{current: current, root: root, depth: descendantDepth}
+}
+
+// aggNodes is the translation of a query: the array of nodes it selects and,
+// when the query is singular, the node itself.
+type aggNodes struct {
+	list     any
+	value    any
+	singular bool
+}
+
+// aggLiteral is a literal comparison operand.
+type aggLiteral struct {
+	value any
+}
+
+func (v *VisitorAggExpr) fail(node any, reason string) {
+	if v.err == nil {
+		v.err = &TranslationError{Node: nodeName(node), Reason: reason}
+	}
+	v.result = nil
+}
+
+func (v *VisitorAggExpr) fresh() string {
+	v.vars++
+	return "n" + strconv.Itoa(v.vars)
+}
+
+// bind makes x available to fn as a reference that can be repeated freely,
+// introducing a $let variable unless x already is a stable reference.
+func (v *VisitorAggExpr) bind(x any, fn func(ref string) any) any {
+	if ref, ok := x.(string); ok && strings.HasPrefix(ref, "$") && ref != "$$this" && ref != "$$value" {
+		return fn(ref)
+	}
+	name := v.fresh()
+	return D{{"$let", D{{"vars", D{{name, x}}}, {"in", fn("$$" + name)}}}}
+}
+
+// aggLiteralValue protects strings that MongoDB would read as field paths.
+func aggLiteralValue(value any) any {
+	if s, ok := value.(string); ok && strings.HasPrefix(s, "$") {
+		return D{{"$literal", s}}
+	}
+	return value
+}
+
+func aggIsType(x any, t string) D {
+	return D{{"$eq", A{D{{"$type", x}}, t}}}
+}
+
+// member selects a member of an object; unlike a field path it does not
+// traverse arrays.
+func (v *VisitorAggExpr) member(x any, name string) any {
+	return v.bind(x, func(r string) any {
+		var get any = r + "." + name
+		if name == "" || strings.Contains(name, ".") || strings.HasPrefix(name, "$") {
+			get = D{{"$getField", D{{"field", D{{"$literal", name}}}, {"input", r}}}}
+		}
+		if r == "$$ROOT" {
+			return get
+		}
+		return D{{"$cond", A{aggIsType(r, "object"), get, "$$REMOVE"}}}
+	})
+}
+
+// element selects an array element, counting from the end for negative i.
+func (v *VisitorAggExpr) element(x any, i int) any {
+	return v.bind(x, func(r string) any {
+		inRange := D{{"$lt", A{i, D{{"$size", r}}}}}
+		if i < 0 {
+			inRange = D{{"$lte", A{-i, D{{"$size", r}}}}}
+		}
+		return D{{"$cond", A{
+			D{{"$and", A{D{{"$isArray", r}}, inRange}}},
+			D{{"$arrayElemAt", A{r, i}}},
+			"$$REMOVE",
+		}}}
+	})
+}
+
+// list wraps a single node into an array, empty when the node is missing.
+func (v *VisitorAggExpr) list(x any) any {
+	return v.bind(x, func(r string) any {
+		return D{{"$cond", A{aggIsType(r, "missing"), A{}, A{r}}}}
+	})
+}
+
+// children lists the elements of an array or the member values of an object.
+func (v *VisitorAggExpr) children(x any) any {
+	return v.bind(x, func(r string) any {
+		kv := v.fresh()
+		members := D{{"$map", D{
+			{"input", D{{"$objectToArray", r}}},
+			{"as", kv},
+			{"in", "$$" + kv + ".v"},
+		}}}
+		return D{{"$cond", A{
+			D{{"$isArray", r}},
+			r,
+			D{{"$cond", A{aggIsType(r, "object"), members, A{}}}},
+		}}}
+	})
+}
+
+// descendants lists x followed by its descendants, level by level, down to
+// v.depth levels.
+func (v *VisitorAggExpr) descendants(x any) any {
+	levels := []string{}
+	var build func(depth int, prev any) any
+	build = func(depth int, prev any) any {
+		name := v.fresh()
+		levels = append(levels, "$$"+name)
+		var in any
+		if depth == v.depth {
+			all := A{}
+			for _, level := range levels {
+				all = append(all, level)
+			}
+			in = D{{"$concatArrays", all}}
+		} else {
+			in = build(depth+1, v.flatMap("$$"+name, v.children))
+		}
+		return D{{"$let", D{{"vars", D{{name, prev}}}, {"in", in}}}}
+	}
+	return build(0, A{x})
+}
+
+// flatMap concatenates the arrays fn produces for every node of list.
+func (v *VisitorAggExpr) flatMap(list any, fn func(x any) any) any {
+	return D{{"$reduce", D{
+		{"input", list},
+		{"initialValue", A{}},
+		{"in", D{{"$concatArrays", A{"$$value", v.bind("$$this", func(r string) any { return fn(r) })}}}},
+	}}}
+}
+
+// slice lists the elements of an array selected by start:stop:step with the
+// bounds normalization of RFC 9535.
+func (v *VisitorAggExpr) slice(x any, start, stop, step *int) any {
+	return v.bind(x, func(r string) any {
+		return D{{"$cond", A{D{{"$isArray", r}}, v.sliceArray(r, start, stop, step), A{}}}}
+	})
+}
+
+func (v *VisitorAggExpr) sliceArray(r string, start, stop, step *int) any {
+	s := 1
+	if step != nil {
+		s = *step
+	}
+	if s == 0 {
+		return A{}
+	}
+	if s == 1 && (start == nil || *start >= 0) {
+		from := 0
+		if start != nil {
+			from = *start
+		}
+		switch {
+		case stop == nil && from == 0:
+			return r
+		case stop == nil:
+			return D{{"$slice", A{r, from, D{{"$max", A{D{{"$size", r}}, 1}}}}}}
+		case *stop >= 0 && *stop <= from:
+			return A{}
+		case *stop >= 0:
+			return D{{"$slice", A{r, from, *stop - from}}}
+		}
+	}
+	if s == 1 && start != nil && *start < 0 && stop == nil {
+		return D{{"$slice", A{r, *start}}}
+	}
+	size := D{{"$size", r}}
+	last := D{{"$subtract", A{size, 1}}}
+	norm := func(i int) any {
+		if i >= 0 {
+			return i
+		}
+		return D{{"$add", A{size, i}}}
+	}
+	clamp := func(i any, lo any, hi any) any {
+		return D{{"$min", A{D{{"$max", A{i, lo}}}, hi}}}
+	}
+	var lower, upper any
+	var indexes any
+	if s > 0 {
+		lower, upper = 0, size
+		if start != nil {
+			lower = clamp(norm(*start), 0, size)
+		}
+		if stop != nil {
+			upper = clamp(norm(*stop), 0, size)
+		}
+		indexes = D{{"$range", A{lower, upper, s}}}
+	} else {
+		upper, lower = any(last), any(-1)
+		if start != nil {
+			upper = clamp(norm(*start), -1, last)
+		}
+		if stop != nil {
+			lower = clamp(norm(*stop), -1, last)
+		}
+		indexes = D{{"$range", A{upper, lower, s}}}
+	}
+	i := v.fresh()
+	return D{{"$map", D{
+		{"input", indexes},
+		{"as", i},
+		{"in", D{{"$arrayElemAt", A{r, "$$" + i}}}},
+	}}}
+}
+
+// sliceBound reads a slice bound, which the parser leaves as an IntExpr or a
+// MinusExpr wrapping one.
+func sliceBound(e Expr) (*int, bool) {
+	switch b := e.(type) {
+	case nil:
+		return nil, true
+	case *IntExpr:
+		n := b.value
+		return &n, true
+	case *MinusExpr:
+		if i, ok := b.expr.(*IntExpr); ok {
+			n := -i.value
+			return &n, true
+		}
+	}
+	return nil, false
+}
+
+// singularSelector returns the only selector of a segment selecting at most
+// one node.
+func singularSelector(seg Segment) (Selector, bool) {
+	var sel Selector
+	switch s := seg.(type) {
+	case *DotChildSegment:
+		sel = s.selector
+	case *ChildSegment:
+		if len(s.selectors) != 1 {
+			return nil, false
+		}
+		sel = s.selectors[0]
+	default:
+		return nil, false
+	}
+	switch s := sel.(type) {
+	case *NameSelector, *StringExpr, *IntExpr, *PointerSelector:
+		return sel, true
+	case *MinusExpr:
+		_, ok := s.expr.(*IntExpr)
+		return sel, ok
+	}
+	return nil, false
+}
+
+// single applies a singular selector to x, producing the node or $$REMOVE.
+func (v *VisitorAggExpr) single(sel Selector, x any) any {
+	switch s := sel.(type) {
+	case *NameSelector:
+		return v.member(x, s.value)
+	case *StringExpr:
+		return v.member(x, unquote(s.value))
+	case *IntExpr:
+		return v.element(x, s.value)
+	case *MinusExpr:
+		return v.element(x, -s.expr.(*IntExpr).value)
+	case *PointerSelector:
+		return v.bind(x, func(r string) any {
+			return D{{"$cond", A{D{{"$isArray", r}}, v.element(r, s.index), v.member(r, strconv.Itoa(s.index))}}}
+		})
+	}
+	return "$$REMOVE"
+}
+
+// Selection translates the nodes sel selects from the node held in input.
+func (v *VisitorAggExpr) Selection(sel Selector, input string) any {
+	savedInput, savedSelecting := v.input, v.selecting
+	v.input, v.selecting = input, true
+	v.result = nil
+	sel.accept(v)
+	v.input, v.selecting = savedInput, savedSelecting
+	return v.result
+}
+
+// Segment translates the nodes seg selects from the node held in input.
+func (v *VisitorAggExpr) Segment(seg Segment, input string) any {
+	saved := v.input
+	v.input = input
+	v.result = nil
+	seg.accept(v)
+	v.input = saved
+	return v.result
+}
+
+// nodes translates segments applied to the node held in start.
+func (v *VisitorAggExpr) nodes(segs []Segment, start string) aggNodes {
+	var value any = start
+	for i, seg := range segs {
+		sel, ok := singularSelector(seg)
+		if !ok {
+			// a reference is applied the segment directly, sparing the
+			// flatMap over a list of one node
+			var list any
+			rest := segs[i:]
+			if ref, isRef := value.(string); isRef {
+				list = v.Segment(seg, ref)
+				rest = segs[i+1:]
+			} else {
+				list = v.list(value)
+			}
+			for _, seg := range rest {
+				list = v.flatMap(list, func(x any) any {
+					return v.Segment(seg, x.(string))
+				})
+				if v.err != nil {
+					return aggNodes{}
+				}
+			}
+			return aggNodes{list: list}
+		}
+		value = v.single(sel, value)
+	}
+	return aggNodes{list: v.list(value), value: value, singular: true}
+}
+
+// Condition translates a filter expression about the node held in current.
+func (v *VisitorAggExpr) Condition(e Expr, current string) any {
+	saved, savedSelecting := v.current, v.selecting
+	v.current, v.selecting = current, false
+	v.result = nil
+	if kind, value, ok := assertion(e); ok {
+		o := v.operand(value)
+		if v.err == nil {
+			v.result = v.bindOperand(o, func(x any) any {
+				return aggAssertion(kind, x)
+			})
+		}
+	} else {
+		e.accept(v)
+	}
+	v.current, v.selecting = saved, savedSelecting
+	if v.err != nil {
+		return nil
+	}
+	switch r := v.result.(type) {
+	case aggNodes:
+		if r.singular {
+			return D{{"$ne", A{D{{"$type", r.value}}, "missing"}}}
+		}
+		return D{{"$gt", A{D{{"$size", r.list}}, 0}}}
+	case aggLiteral, nil:
+		v.fail(e, MONGO_ERROR_NOT_A_CONDITION)
+		return nil
+	}
+	return v.result
+}
+
+func (v *VisitorAggExpr) operand(e Expr) any {
+	v.result = nil
+	e.accept(v)
+	if v.err != nil {
+		return nil
+	}
+	switch r := v.result.(type) {
+	case aggLiteral:
+		return r
+	case aggNodes:
+		if !r.singular {
+			v.fail(e, MONGO_ERROR_NOT_SINGULAR)
+			return nil
+		}
+		return r
+	}
+	v.fail(e, MONGO_ERROR_NOT_AN_OPERAND)
+	return nil
+}
+
+func aggOperandExpr(o any) any {
+	switch r := o.(type) {
+	case aggLiteral:
+		return aggLiteralValue(r.value)
+	case aggNodes:
+		return r.value
+	}
+	return nil
+}
+
+// comparable is true when both operands are numbers or both are strings, the
+// only values RFC 9535 orders.
+func comparable(l, r any, a, b any) any {
+	kind := func(lit aggLiteral, other any) any {
+		switch lit.value.(type) {
+		case int, float64:
+			return D{{"$isNumber", other}}
+		case string:
+			return aggIsType(other, "string")
+		}
+		return false
+	}
+	if lit, ok := l.(aggLiteral); ok {
+		return kind(lit, b)
+	}
+	if lit, ok := r.(aggLiteral); ok {
+		return kind(lit, a)
+	}
+	return D{{"$or", A{
+		D{{"$and", A{D{{"$isNumber", a}}, D{{"$isNumber", b}}}}},
+		D{{"$and", A{aggIsType(a, "string"), aggIsType(b, "string")}}},
+	}}}
+}
+
+func (v *VisitorAggExpr) compare(e Expr, op string, lhs, rhs Expr) {
+	l := v.operand(lhs)
+	r := v.operand(rhs)
+	if v.err != nil {
+		return
+	}
+	_, llit := l.(aggLiteral)
+	_, rlit := r.(aggLiteral)
+	if llit && rlit {
+		v.fail(e, MONGO_ERROR_TWO_LITERALS)
+		return
+	}
+	v.result = v.bindOperand(l, func(a any) any {
+		return v.bindOperand(r, func(b any) any {
+			return aggComparison(op, l, r, a, b)
+		})
+	})
+}
+
+// bindOperand binds a query operand, which may be repeated by the type guards
+// of a comparison; literals are used in place.
+func (v *VisitorAggExpr) bindOperand(o any, fn func(x any) any) any {
+	if _, ok := o.(aggLiteral); ok {
+		return fn(aggOperandExpr(o))
+	}
+	return v.bind(aggOperandExpr(o), func(r string) any { return fn(r) })
+}
+
+func aggComparison(op string, l, r any, a, b any) any {
+	cmp := D{{op, A{a, b}}}
+	if op == "$eq" || op == "$ne" {
+		return cmp
+	}
+	guard := comparable(l, r, a, b)
+	if guard == false {
+		if op == "$lt" || op == "$gt" {
+			return false
+		}
+		return D{{"$eq", A{a, b}}}
+	}
+	ordered := D{{"$and", A{guard, cmp}}}
+	if op == "$lt" || op == "$gt" {
+		return ordered
+	}
+	return D{{"$or", A{ordered, D{{"$eq", A{a, b}}}}}}
+}
+
+func aggJunction(op string, lhs, rhs any) any {
+	items := A{}
+	for _, x := range []any{lhs, rhs} {
+		if d, ok := x.(D); ok && len(d) == 1 && d[0].Key == op {
+			items = append(items, d[0].Value.(A)...)
+			continue
+		}
+		items = append(items, x)
+	}
+	return D{{op, items}}
+}
+
+// LITERAL EXPRESSIONS
+func (v *VisitorAggExpr) visitStringExpr(e *StringExpr) {
+	if v.selecting {
+		v.result = v.list(v.member(v.input, unquote(e.value)))
+		return
+	}
+	v.result = aggLiteral{value: unquote(e.value)}
+}
+
+func (v *VisitorAggExpr) visitIntExpr(e *IntExpr) {
+	if v.selecting {
+		v.result = v.list(v.element(v.input, e.value))
+		return
+	}
+	v.result = aggLiteral{value: e.value}
+}
+
+func (v *VisitorAggExpr) visitTrueExpr(e *TrueExpr) {
+	v.literal(e, true)
+}
+
+func (v *VisitorAggExpr) visitFalseExpr(e *FalseExpr) {
+	v.literal(e, false)
+}
+
+func (v *VisitorAggExpr) visitNullExpr(e *NullExpr) {
+	v.literal(e, nil)
+}
+
+func (v *VisitorAggExpr) literal(e Expr, value any) {
+	if v.selecting {
+		v.fail(e, MONGO_ERROR_NOT_A_SELECTOR)
+		return
+	}
+	v.result = aggLiteral{value: value}
+}
+
+func (v *VisitorAggExpr) visitTypedStringExpr(e *TypedStringExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorAggExpr) visitTypedArrayExpr(e *TypedArrayExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorAggExpr) visitTypedIntExpr(e *TypedIntExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorAggExpr) visitTypedBoolExpr(e *TypedBoolExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorAggExpr) visitTypedDecimalExpr(e *TypedDecimalExpr) {
+	v.cast(e)
+}
+
+func (v *VisitorAggExpr) visitTypedObjectExpr(e *TypedObjectExpr) {
+	v.cast(e)
+}
+
+// cast translates a cast used as an operand into a conversion, or, as a
+// selector, selects what its converted literal names. Type assertions are
+// translated by Condition.
+func (v *VisitorAggExpr) cast(e Expr) {
+	kind, value, _ := castOf(e)
+	if isLogical(value) {
+		value.accept(v)
+		return
+	}
+	if v.selecting {
+		literal, ok := literalValue(value)
+		if !ok {
+			v.fail(e, MONGO_ERROR_NOT_A_SELECTOR)
+			return
+		}
+		switch sel := evalCast(kind, literal).(type) {
+		case string:
+			v.result = v.list(v.member(v.input, sel))
+		case int:
+			v.result = v.list(v.element(v.input, sel))
+		default:
+			v.fail(e, MONGO_ERROR_NOT_A_SELECTOR)
+		}
+		return
+	}
+	o := v.operand(value)
+	if v.err != nil {
+		return
+	}
+	converted := v.bindOperand(o, func(x any) any {
+		return aggCast(kind, x)
+	})
+	v.result = aggNodes{value: converted, singular: true}
+}
+
+func (v *VisitorAggExpr) visitParExpr(e *ParExpr) {
+	e.value.accept(v)
+}
+
+func (v *VisitorAggExpr) visitFnExpr(e *FnExpr) {
+	switch e.name {
+	case "length":
+		v.length(e)
+	case "count":
+		v.count(e)
+	case "match", "search":
+		v.regex(e)
+	default:
+		v.fail(e, MONGO_ERROR_FUNCTION)
+	}
+}
+
+// length translates length() into the number of code points of a string, the
+// size of an array or the number of members of an object. Other values have
+// no length, which is represented as a missing node.
+func (v *VisitorAggExpr) length(e *FnExpr) {
+	if len(e.params) != 1 {
+		v.fail(e, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	arg := v.operand(e.params[0])
+	if v.err != nil {
+		return
+	}
+	value := v.bindOperand(arg, func(x any) any {
+		return D{{"$switch", D{
+			{"branches", A{
+				D{{"case", aggIsType(x, "string")}, {"then", D{{"$strLenCP", x}}}},
+				D{{"case", D{{"$isArray", x}}}, {"then", D{{"$size", x}}}},
+				D{{"case", aggIsType(x, "object")}, {"then", D{{"$size", D{{"$objectToArray", x}}}}}},
+			}},
+			{"default", "$$REMOVE"},
+		}}}
+	})
+	v.result = aggNodes{value: value, singular: true}
+}
+
+// count translates count() into the size of the array of nodes its query
+// selects.
+func (v *VisitorAggExpr) count(e *FnExpr) {
+	if len(e.params) != 1 {
+		v.fail(e, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	saved := v.selecting
+	v.selecting = false
+	v.result = nil
+	e.params[0].accept(v)
+	v.selecting = saved
+	if v.err != nil {
+		return
+	}
+	nodes, ok := v.result.(aggNodes)
+	if !ok {
+		v.fail(e, MONGO_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.result = aggNodes{value: D{{"$size", nodes.list}}, singular: true}
+}
+
+// regex translates match() and search() into a $regexMatch, guarded so that
+// input that is not a string is not matched rather than an error.
+func (v *VisitorAggExpr) regex(e *FnExpr) {
+	if len(e.params) != 2 {
+		v.fail(e, CHECKER_ERROR_ARGUMENTS)
+		return
+	}
+	pattern, ok := e.params[1].(*StringExpr)
+	if !ok {
+		v.fail(e, MONGO_ERROR_REGEX_PATTERN)
+		return
+	}
+	input := v.operand(e.params[0])
+	if v.err != nil {
+		return
+	}
+	re, err := translateIRegexp(unquote(pattern.value), e.name == "match")
+	if err != nil {
+		v.err = err
+		v.result = nil
+		return
+	}
+	v.result = v.bindOperand(input, func(x any) any {
+		return D{{"$cond", A{
+			aggIsType(x, "string"),
+			D{{"$regexMatch", D{{"input", x}, {"regex", re}}}},
+			false,
+		}}}
+	})
+}
+
+// UNARY EXPRESSIONS
+func (v *VisitorAggExpr) visitNotExpr(e *NotExpr) {
+	cond := v.Condition(e.expr, v.current)
+	if v.err != nil {
+		return
+	}
+	v.result = D{{"$not", A{cond}}}
+}
+
+func (v *VisitorAggExpr) visitMinusExpr(e *MinusExpr) {
+	i, ok := e.expr.(*IntExpr)
+	if !ok {
+		v.fail(e, MONGO_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	if v.selecting {
+		v.result = v.list(v.element(v.input, -i.value))
+		return
+	}
+	v.result = aggLiteral{value: -i.value}
+}
+
+// BINARY EXPRESSIONS
+func (v *VisitorAggExpr) visitAndExpr(e *AndExpr) {
+	lhs := v.Condition(e.lhs, v.current)
+	rhs := v.Condition(e.rhs, v.current)
+	if v.err != nil {
+		return
+	}
+	v.result = aggJunction("$and", lhs, rhs)
+}
+
+func (v *VisitorAggExpr) visitOrExpr(e *OrExpr) {
+	lhs := v.Condition(e.lhs, v.current)
+	rhs := v.Condition(e.rhs, v.current)
+	if v.err != nil {
+		return
+	}
+	v.result = aggJunction("$or", lhs, rhs)
+}
+
+func (v *VisitorAggExpr) visitGtExpr(e *GtExpr) {
+	v.compare(e, "$gt", e.lhs, e.rhs)
+}
+
+func (v *VisitorAggExpr) visitLtExpr(e *LtExpr) {
+	v.compare(e, "$lt", e.lhs, e.rhs)
+}
+
+func (v *VisitorAggExpr) visitLteExpr(e *LteExpr) {
+	v.compare(e, "$lte", e.lhs, e.rhs)
+}
+
+func (v *VisitorAggExpr) visitGteExpr(e *GteExpr) {
+	v.compare(e, "$gte", e.lhs, e.rhs)
+}
+
+func (v *VisitorAggExpr) visitEqeqExpr(e *EqeqExpr) {
+	v.compare(e, "$eq", e.lhs, e.rhs)
+}
+
+func (v *VisitorAggExpr) visitNeqExpr(e *NeqExpr) {
+	v.compare(e, "$ne", e.lhs, e.rhs)
+}
+
+// SELECTORS
+func (v *VisitorAggExpr) visitFilterSelector(s *FilterSelector) {
+	input := v.input
+	n := v.fresh()
+	cond := v.Condition(s.cond, "$$"+n)
+	if v.err != nil {
+		return
+	}
+	v.result = D{{"$filter", D{
+		{"input", v.children(input)},
+		{"as", n},
+		{"cond", cond},
+	}}}
+}
+
+func (v *VisitorAggExpr) visitWildcardSelector(s *WildCardSelector) {
+	v.result = v.children(v.input)
+}
+
+func (v *VisitorAggExpr) visitSliceSelector(s *SliceSelector) {
+	start, ok1 := sliceBound(s.start)
+	stop, ok2 := sliceBound(s.stop)
+	step, ok3 := sliceBound(s.step)
+	if !ok1 || !ok2 || !ok3 {
+		v.fail(s, PARSER_ERROR_SYNTAX_SLICE)
+		return
+	}
+	v.result = v.slice(v.input, start, stop, step)
+}
+
+func (v *VisitorAggExpr) visitNameSelector(s *NameSelector) {
+	if !v.selecting {
+		v.fail(s, MONGO_ERROR_NOT_AN_OPERAND)
+		return
+	}
+	v.result = v.list(v.member(v.input, s.value))
+}
+
+func (v *VisitorAggExpr) visitPointerSelector(s *PointerSelector) {
+	v.result = v.list(v.single(s, v.input))
+}
+
+// SEGMENTS
+func (v *VisitorAggExpr) visitDotChildSegment(s *DotChildSegment) {
+	v.result = v.Selection(s.selector, v.input)
+}
+
+func (v *VisitorAggExpr) visitChildSegment(s *ChildSegment) {
+	lists := A{}
+	for _, sel := range s.selectors {
+		list := v.Selection(sel, v.input)
+		if v.err != nil {
+			return
+		}
+		lists = append(lists, list)
+	}
+	if len(lists) == 1 {
+		v.result = lists[0]
+		return
+	}
+	v.result = D{{"$concatArrays", lists}}
+}
+
+func (v *VisitorAggExpr) visitDescendantSegment(s *DescendantSegment) {
+	child := &ChildSegment{selectors: s.selectors}
+	v.result = v.flatMap(v.descendants(v.input), func(x any) any {
+		return v.Segment(child, x.(string))
+	})
+}
+
+func (v *VisitorAggExpr) visitAbsQuery(q *AbsQuery) {
+	v.usedRoot = true
+	v.result = v.nodes(q.segments, v.root)
+}
+
+func (v *VisitorAggExpr) visitRelQuery(q *RelQuery) {
+	v.result = v.nodes(q.segments, v.current)
+}
+
+// VisitorPipeline translates a compiled query into an aggregation pipeline
+// producing one document per selected node, {_id: <document _id>, value:
+// <node>}.
+//
+// Runs of names and indexes become a single $project of the node, other
+// segments project the nodes they select and $unwind them. Filters are
+// applied with a $match stage, using the find filter syntax when
+// VisitorMongo can express the condition and $expr otherwise. The pipeline
+// starts with a $match on the longest leading path of the query so that
+// indexes can narrow the documents scanned.
+//
+// A wildcard or filter applied to the root lists the member values of the
+// document, as RFC 9535 and the find filter of VisitorMongo read it: the
+// filter of $[?(@.total > 10)] tests value.total after unwinding them.
+type VisitorPipeline struct {
+	partialVisitor
+	stages []D
+	input  string // "$$ROOT" until the first projection, "$value" after
+	agg    *VisitorAggExpr
+	config mongoConfig
+}
+
+func NewVisitorPipeline(opts ...MongoOption) *VisitorPipeline {
+	return &VisitorPipeline{config: newMongoConfig(opts)}
+}
+
+// Result returns the stages built for the last visited query.
+func (v *VisitorPipeline) Result() ([]D, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	return v.stages, nil
+}
+
+// MongoPipeline translates q into an aggregation pipeline listing the nodes
+// it selects from every document. Descendant segments only look 8 levels
+// below the node they apply to, as aggregation expressions cannot recurse;
+// WithDescendantDepth sets another bound.
+func MongoPipeline(q Query, opts ...MongoOption) ([]D, error) {
+	v := NewVisitorPipeline(opts...)
+	q.accept(v)
+	return v.Result()
+}
+
+func (v *VisitorPipeline) query(segs []Segment) {
+	v.stages = nil
+	v.input = "$$ROOT"
+	v.agg = NewVisitorAggExpr("$$ROOT", "$$ROOT")
+	v.agg.depth = v.config.descendantDepth
+
+	prefix := []string{}
+	for _, seg := range segs {
+		name, ok := singularStep(seg)
+		if !ok || strings.Contains(name, ".") || strings.HasPrefix(name, "$") {
+			break
+		}
+		prefix = append(prefix, name)
+	}
+	if len(prefix) > 0 {
+		v.stage("$match", D{{strings.Join(prefix, "."), D{{"$exists", true}}}})
+	}
+
+	pending := []Selector{}
+	for _, seg := range segs {
+		if sel, ok := singularSelector(seg); ok {
+			pending = append(pending, sel)
+			continue
+		}
+		v.singular(pending)
+		pending = nil
+		seg.accept(v)
+		if v.err != nil {
+			return
+		}
+	}
+	v.singular(pending)
+	if v.input == "$$ROOT" {
+		v.project("$$ROOT")
+	}
+	if v.agg.usedRoot {
+		v.carryRoot()
+	}
+}
+
+func (v *VisitorPipeline) stage(name string, spec any) {
+	v.stages = append(v.stages, D{{name, spec}})
+}
+
+func (v *VisitorPipeline) project(value any) {
+	v.stage("$project", D{{"value", value}})
+	v.input = "$value"
+	v.agg.root = "$root"
+}
+
+func (v *VisitorPipeline) unwind() {
+	v.stage("$unwind", "$value")
+}
+
+// singular projects the node selected by a run of names and indexes.
+func (v *VisitorPipeline) singular(sels []Selector) {
+	if len(sels) == 0 {
+		return
+	}
+	var value any = v.input
+	for _, sel := range sels {
+		value = v.agg.single(sel, value)
+	}
+	v.project(value)
+	v.stage("$match", D{{"value", D{{"$exists", true}}}})
+}
+
+// carryRoot keeps the whole document next to the node in every projection
+// so absolute queries in filters can still reach it, then drops it.
+func (v *VisitorPipeline) carryRoot() {
+	first := true
+	for _, stage := range v.stages {
+		if stage[0].Key != "$project" {
+			continue
+		}
+		spec := stage[0].Value.(D)
+		if first {
+			stage[0].Value = append(spec, E{"root", "$$ROOT"})
+			first = false
+		} else {
+			stage[0].Value = append(spec, E{"root", 1})
+		}
+	}
+	v.stage("$project", D{{"root", 0}})
+}
+
+func (v *VisitorPipeline) filter(s *FilterSelector) {
+	v.project(v.agg.children(v.input))
+	v.unwind()
+	find := NewVisitorMongo()
+	find.config = v.config
+	find.base = []string{"value"}
+	find.root = []string{"root"}
+	cond := find.condition(s.cond)
+	if find.err == nil {
+		if find.usedRoot {
+			v.agg.usedRoot = true
+		}
+		v.stage("$match", cond)
+		return
+	}
+	expr := v.agg.Condition(s.cond, "$value")
+	if v.agg.err != nil {
+		v.err = v.agg.err
+		return
+	}
+	v.stage("$match", D{{"$expr", expr}})
+}
+
+func (v *VisitorPipeline) selectors(sels []Selector) {
+	if len(sels) == 1 {
+		switch s := sels[0].(type) {
+		case *FilterSelector:
+			v.filter(s)
+			return
+		case *WildCardSelector:
+			v.project(v.agg.children(v.input))
+			v.unwind()
+			return
+		}
+	}
+	list := v.agg.Segment(&ChildSegment{selectors: sels}, v.input)
+	if v.agg.err != nil {
+		v.err = v.agg.err
+		return
+	}
+	v.project(list)
+	v.unwind()
+}
+
+// SEGMENTS
+func (v *VisitorPipeline) visitDotChildSegment(s *DotChildSegment) {
+	v.selectors([]Selector{s.selector})
+}
+
+func (v *VisitorPipeline) visitChildSegment(s *ChildSegment) {
+	v.selectors(s.selectors)
+}
+
+func (v *VisitorPipeline) visitDescendantSegment(s *DescendantSegment) {
+	v.project(v.agg.descendants(v.input))
+	v.unwind()
+	v.selectors(s.selectors)
+}
+
+func (v *VisitorPipeline) visitAbsQuery(q *AbsQuery) {
+	v.query(q.segments)
+}
+
+func (v *VisitorPipeline) visitRelQuery(q *RelQuery) {
+	v.query(q.segments)
+}
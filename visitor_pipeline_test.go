@@ -0,0 +1,186 @@
+package gojimongo
+
+import (
+	"strings"
+	"testing"
+)
+
+func stageNames(stages []D) string {
+	names := []string{}
+	for _, stage := range stages {
+		names = append(names, stage[0].Key)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestMongoPipelineStages(t *testing.T) {
+	queries := map[string]string{
+		"$":                              "$project",
+		"$.store.book":                   "$match $project $match",
+		"$.store.book[*].title":          "$match $project $match $project $unwind $project $match",
+		"$.orders[?(@.total > 10)]":      "$match $project $match $project $unwind $match",
+		"$.orders[?(@.total > @.limit)]": "$match $project $match $project $unwind $match",
+		"$..author":                      "$project $unwind $project $unwind",
+		"$.book[0:5]":                    "$match $project $match $project $unwind",
+		"$.book[-1]":                     "$match $project $match",
+		"$.a['b','c']":                   "$match $project $match $project $unwind",
+		"$.a[?(@.x == $.y)]":             "$match $project $match $project $unwind $match $project",
+		"$[?(@.total > 10)]":             "$project $unwind $match",
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		stages, err := MongoPipeline(q)
+		if err != nil {
+			t.Errorf("MongoPipeline(%q) = %v", query, err)
+			continue
+		}
+		if names := stageNames(stages); names != expected {
+			t.Errorf("MongoPipeline(%q) stages = %s; expected %s", query, names, expected)
+		}
+	}
+}
+
+func TestMongoPipeline(t *testing.T) {
+	queries := map[string][]string{
+		"$.store.book": {
+			`{"$match":{"store.book":{"$exists":true}}}`,
+			`{"$project":{"value":{"$cond":[{"$eq":[{"$type":"$$ROOT.store"},"object"]},"$$ROOT.store.book","$$REMOVE"]}}}`,
+			`{"$match":{"value":{"$exists":true}}}`,
+		},
+		"$.book[1:3]": {
+			`{"$match":{"book":{"$exists":true}}}`,
+			`{"$project":{"value":"$$ROOT.book"}}`,
+			`{"$match":{"value":{"$exists":true}}}`,
+			`{"$project":{"value":{"$cond":[{"$isArray":"$value"},{"$slice":["$value",1,2]},[]]}}}`,
+			`{"$unwind":"$value"}`,
+		},
+		"$.orders[?(@.total > 10)]": {
+			`{"$match":{"orders":{"$exists":true}}}`,
+			`{"$project":{"value":"$$ROOT.orders"}}`,
+			`{"$match":{"value":{"$exists":true}}}`,
+			`{"$project":{"value":{"$cond":[{"$isArray":"$value"},"$value",{"$cond":[{"$eq":[{"$type":"$value"},"object"]},{"$map":{"input":{"$objectToArray":"$value"},"as":"n1","in":"$$n1.v"}},[]]}]}}}`,
+			`{"$unwind":"$value"}`,
+			`{"$match":{"value.total":{"$gt":10}}}`,
+		},
+		"$[?(@.price < 5)]": {
+			`{"$project":{"value":{"$cond":[{"$isArray":"$$ROOT"},"$$ROOT",{"$cond":[{"$eq":[{"$type":"$$ROOT"},"object"]},{"$map":{"input":{"$objectToArray":"$$ROOT"},"as":"n1","in":"$$n1.v"}},[]]}]}}}`,
+			`{"$unwind":"$value"}`,
+			`{"$match":{"value.price":{"$lt":5}}}`,
+		},
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		stages, err := MongoPipeline(q)
+		if err != nil {
+			t.Errorf("MongoPipeline(%q) = %v", query, err)
+			continue
+		}
+		if len(stages) != len(expected) {
+			t.Errorf("MongoPipeline(%q) = %v; expected %v", query, stages, expected)
+			continue
+		}
+		for i, stage := range stages {
+			if stage.String() != expected[i] {
+				t.Errorf("MongoPipeline(%q) stage %d = %s; expected %s", query, i, stage, expected[i])
+			}
+		}
+	}
+}
+
+func TestMongoPipelineFilterExpr(t *testing.T) {
+	c := &Compiler{}
+	q, err := c.Compile("$.orders[?(@.discount > @.price)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, err := MongoPipeline(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := stages[len(stages)-1].String()
+	for _, fragment := range []string{`"$expr"`, `"$gt":["$$n`, `"$isNumber"`} {
+		if !strings.Contains(match, fragment) {
+			t.Errorf("last stage %s does not contain %s", match, fragment)
+		}
+	}
+}
+
+func TestMongoPipelineRegex(t *testing.T) {
+	c := &Compiler{}
+	q, err := c.Compile("$.users[?match(@.name, 'J.*') && @.age > @.limit]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, err := MongoPipeline(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := D{{"stages", stages}}.String()
+	for _, fragment := range []string{`"$regexMatch"`, `"regex":"^(?:J[^\\n\\r]*)\\z"`, `"string"`} {
+		if !strings.Contains(pipeline, fragment) {
+			t.Errorf("pipeline %s does not contain %s", pipeline, fragment)
+		}
+	}
+}
+
+func TestMongoPipelineDescendantDepth(t *testing.T) {
+	c := &Compiler{}
+	q, err := c.Compile("$..author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := func(opts ...MongoOption) int {
+		stages, err := MongoPipeline(q, opts...)
+		if err != nil {
+			t.Fatalf("MongoPipeline() = %v", err)
+		}
+		return strings.Count(stages[0].String(), `"$concatArrays":["$$value"`)
+	}
+	if got := levels(); got != 8 {
+		t.Errorf("MongoPipeline() descends %d levels; expected 8", got)
+	}
+	if got := levels(WithDescendantDepth(20)); got != 20 {
+		t.Errorf("MongoPipeline(WithDescendantDepth(20)) descends %d levels; expected 20", got)
+	}
+	if got := levels(WithDescendantDepth(0)); got != 8 {
+		t.Errorf("MongoPipeline(WithDescendantDepth(0)) descends %d levels; expected 8", got)
+	}
+}
+
+// TestMongoPipelineRootMembers checks that the pipeline and the find filter
+// of a query selecting the members of the document agree on them: both list
+// the children of $$ROOT, as RFC 9535 defines the root's members.
+func TestMongoPipelineRootMembers(t *testing.T) {
+	children := `{"$cond":[{"$isArray":"$$ROOT"},"$$ROOT",{"$cond":[{"$eq":[{"$type":"$$ROOT"},"object"]},{"$map":{"input":{"$objectToArray":"$$ROOT"}`
+	c := &Compiler{}
+	for _, query := range []string{"$[?(@.total > 10)]", "$[?@.a]", "$.*"} {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		for _, opts := range [][]MongoOption{nil, {WithArrayTraversal()}} {
+			stages, err := MongoPipeline(q, opts...)
+			if err != nil {
+				t.Fatalf("MongoPipeline(%q) = %v", query, err)
+			}
+			if !strings.Contains(stages[0].String(), children) {
+				t.Errorf("MongoPipeline(%q) starts with %s; expected the children of $$ROOT", query, stages[0])
+			}
+			filter, err := MongoFilter(q, opts...)
+			if err != nil {
+				t.Fatalf("MongoFilter(%q) = %v", query, err)
+			}
+			if !strings.Contains(filter.String(), children) {
+				t.Errorf("MongoFilter(%q) = %s; expected a test on the children of $$ROOT", query, filter)
+			}
+		}
+	}
+}
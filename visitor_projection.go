@@ -0,0 +1,336 @@
+package gojimongo
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// VisitorProjection translates the selectors of a compiled query into a find
+// projection returning the fields the query reads.
+//
+// Names become dotted inclusion paths, a trailing index or slice with step 1
+// becomes $slice: [skip, limit] and a filter on a top-level array becomes an
+// $elemMatch projection, which MongoDB resolves to the first matching element
+// only. Wildcards and filters followed by further segments are read as array
+// traversal when WithArrayTraversal is set, as VisitorMongo does; otherwise
+// they may apply to an object and include the whole field. Anything a
+// projection cannot narrow further, such as a descendant segment or a slice
+// followed by further segments, includes the whole field it applies to, so
+// the projection never drops nodes the query selects through arrays. Exact
+// reports whether no selector was widened that way.
+type VisitorProjection struct {
+	partialVisitor
+	path    []string
+	rest    []Segment
+	fields  D
+	all     bool // the whole document is needed
+	widened bool // a selector was not narrowed, or only to its first match
+	config  mongoConfig
+}
+
+func NewVisitorProjection(opts ...MongoOption) *VisitorProjection {
+	return &VisitorProjection{config: newMongoConfig(opts)}
+}
+
+// Result returns the projection built for the last visited query.
+func (v *VisitorProjection) Result() (D, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	if v.all || v.fields == nil {
+		return D{}, nil
+	}
+	return v.fields, nil
+}
+
+// Exact reports whether the projection built for the last visited query
+// narrows every selector, returning the nodes the query selects and not the
+// whole fields holding them.
+func (v *VisitorProjection) Exact() bool {
+	return v.err == nil && !v.widened
+}
+
+// MongoProjection translates q into a find projection.
+func MongoProjection(q Query, opts ...MongoOption) (D, error) {
+	v := NewVisitorProjection(opts...)
+	q.accept(v)
+	return v.Result()
+}
+
+// Find holds the arguments of a find command built from a query.
+type Find struct {
+	Filter     D
+	Projection D
+	// Exact reports whether Filter matches exactly the documents the query
+	// selects nodes from. When it is false Filter is the translation of the
+	// longest leading part of the query that can be expressed, which matches
+	// a superset of those documents.
+	Exact bool
+	// ExactProjection reports whether Projection narrows every selector of
+	// the query. When it is false Projection keeps whole fields where the
+	// query selects part of them, such as the elements of a slice followed
+	// by further segments, or the first element matching a filter only, and
+	// the returned documents are not the nodes the query selects.
+	ExactProjection bool
+}
+
+// MongoFind translates q into the filter and projection of a find command.
+func MongoFind(q Query, opts ...MongoOption) (*Find, error) {
+	v := NewVisitorProjection(opts...)
+	q.accept(v)
+	projection, err := v.Result()
+	if err != nil {
+		return nil, err
+	}
+	find := &Find{Filter: D{}, Projection: projection, ExactProjection: v.Exact()}
+	filter, err := MongoFilter(q, opts...)
+	if err == nil {
+		find.Filter, find.Exact = filter, true
+		return find, nil
+	}
+	var terr *TranslationError
+	if !errors.As(err, &terr) {
+		return nil, err
+	}
+	segs := querySegments(q)
+	for k := len(segs) - 1; k >= 0; k-- {
+		filter, err := MongoFilter(&AbsQuery{segments: segs[:k]}, opts...)
+		if err == nil {
+			find.Filter = filter
+			break
+		}
+	}
+	return find, nil
+}
+
+// querySegments returns the segments of an absolute or relative query.
+func querySegments(q Query) []Segment {
+	switch q := q.(type) {
+	case *AbsQuery:
+		return q.segments
+	case *RelQuery:
+		return q.segments
+	}
+	return nil
+}
+
+// include adds a projection entry, widening overlapping entries to the
+// inclusion of their common field so the projection has no path collision.
+func (v *VisitorProjection) include(path []string, spec any) {
+	if len(path) == 0 {
+		v.all = true
+		return
+	}
+	key := strings.Join(path, ".")
+	for i, e := range v.fields {
+		switch {
+		case e.Key == key && reflect.DeepEqual(e.Value, spec):
+			return
+		case e.Key == key || strings.HasPrefix(key, e.Key+"."):
+			if !reflect.DeepEqual(e.Value, 1) {
+				v.widened = true
+			}
+			v.fields[i].Value = 1
+			return
+		case strings.HasPrefix(e.Key, key+"."):
+			if !reflect.DeepEqual(spec, 1) {
+				v.widened = true
+			}
+			v.fields = append(v.fields[:i], v.fields[i+1:]...)
+			v.include(path, 1)
+			return
+		}
+	}
+	v.fields = append(v.fields, E{key, spec})
+}
+
+// widen includes the whole field at v.path, which holds more than the nodes
+// the selector being visited selects.
+func (v *VisitorProjection) widen() {
+	v.widened = true
+	v.include(v.path, 1)
+}
+
+func (v *VisitorProjection) segments(segs []Segment) {
+	if len(segs) == 0 {
+		v.include(v.path, 1)
+		return
+	}
+	saved := v.rest
+	v.rest = segs[1:]
+	segs[0].accept(v)
+	v.rest = saved
+}
+
+func (v *VisitorProjection) step(name string) {
+	if name == "" || strings.Contains(name, ".") || strings.HasPrefix(name, "$") {
+		v.widen()
+		return
+	}
+	v.path = append(v.path, name)
+	v.segments(v.rest)
+	v.path = v.path[:len(v.path)-1]
+}
+
+func (v *VisitorProjection) selectors(sels []Selector) {
+	if len(sels) == 1 {
+		sels[0].accept(v)
+		return
+	}
+	for _, sel := range sels {
+		switch sel.(type) {
+		case *NameSelector, *StringExpr:
+		default:
+			v.widen()
+			return
+		}
+	}
+	for _, sel := range sels {
+		sel.accept(v)
+	}
+}
+
+// slice projects the elements from skip, which counts from the end when
+// negative, up to limit elements. MongoDB rejects a $slice next to fields
+// projected inside the same array, so when selectors follow the slice it is
+// widened to the whole array and only the following selectors are projected.
+func (v *VisitorProjection) slice(skip, limit int) {
+	if len(v.rest) > 0 {
+		v.widened = true
+		v.segments(v.rest)
+		return
+	}
+	v.include(v.path, D{{"$slice", A{skip, limit}}})
+}
+
+// whole projects every element of an array or member of an object. Unless
+// WithArrayTraversal is set the node may be an object, whose members a path
+// through it does not reach, so selectors following it are not projected.
+func (v *VisitorProjection) whole() {
+	if len(v.rest) > 0 && v.config.arrayTraversal {
+		v.segments(v.rest)
+		return
+	}
+	if len(v.rest) > 0 {
+		v.widened = true
+	}
+	v.include(v.path, 1)
+}
+
+// SELECTORS
+func (v *VisitorProjection) visitNameSelector(s *NameSelector) {
+	v.step(s.value)
+}
+
+// visitPointerSelector projects the whole field: a path through an array
+// does not reach its elements by index.
+func (v *VisitorProjection) visitPointerSelector(s *PointerSelector) {
+	v.widen()
+}
+
+func (v *VisitorProjection) visitStringExpr(e *StringExpr) {
+	v.step(unquote(e.value))
+}
+
+func (v *VisitorProjection) visitIntExpr(e *IntExpr) {
+	v.slice(e.value, 1)
+}
+
+func (v *VisitorProjection) visitMinusExpr(e *MinusExpr) {
+	i, ok := e.expr.(*IntExpr)
+	if !ok {
+		v.unexpected(e)
+		return
+	}
+	v.slice(-i.value, 1)
+}
+
+func (v *VisitorProjection) visitWildcardSelector(s *WildCardSelector) {
+	v.whole()
+}
+
+func (v *VisitorProjection) visitSliceSelector(s *SliceSelector) {
+	start, ok1 := sliceBound(s.start)
+	stop, ok2 := sliceBound(s.stop)
+	step, ok3 := sliceBound(s.step)
+	if !ok1 || !ok2 || !ok3 {
+		v.unexpected(s)
+		return
+	}
+	if step != nil && *step != 1 {
+		v.widened = true
+		v.whole()
+		return
+	}
+	switch {
+	case start == nil && stop == nil:
+		v.whole()
+	case start == nil && *stop > 0:
+		v.slice(0, *stop)
+	case start != nil && *start >= 0 && stop == nil:
+		v.slice(*start, math.MaxInt32)
+	case start != nil && *start >= 0 && *stop > *start:
+		v.slice(*start, *stop-*start)
+	case start != nil && *start < 0 && stop == nil:
+		v.slice(*start, -*start)
+	case start != nil && *start < 0 && *stop < 0 && *stop > *start:
+		v.slice(*start, *stop-*start)
+	default:
+		v.widened = true
+		v.whole()
+	}
+}
+
+// visitFilterSelector projects the first matching element of a top-level
+// array with $elemMatch, which only suits queries selecting a single node and
+// makes the projection inexact, and otherwise the whole field.
+func (v *VisitorProjection) visitFilterSelector(s *FilterSelector) {
+	v.widened = true
+	if len(v.rest) > 0 && v.config.arrayTraversal {
+		v.segments(v.rest)
+		return
+	}
+	if len(v.rest) > 0 || len(v.path) != 1 || !v.config.arrayTraversal {
+		v.include(v.path, 1)
+		return
+	}
+	find := NewVisitorMongo()
+	find.config = v.config
+	find.element = 1
+	cond := find.condition(s.cond)
+	if find.err != nil || find.usedRoot {
+		v.include(v.path, 1)
+		return
+	}
+	query, ok := elementQuery(cond)
+	if !ok || len(query) == 0 {
+		v.include(v.path, 1)
+		return
+	}
+	v.include(v.path, D{{"$elemMatch", implicitAnd(query)}})
+}
+
+// SEGMENTS
+func (v *VisitorProjection) visitDotChildSegment(s *DotChildSegment) {
+	v.selectors([]Selector{s.selector})
+}
+
+func (v *VisitorProjection) visitChildSegment(s *ChildSegment) {
+	v.selectors(s.selectors)
+}
+
+func (v *VisitorProjection) visitDescendantSegment(s *DescendantSegment) {
+	v.widen()
+}
+
+func (v *VisitorProjection) visitAbsQuery(q *AbsQuery) {
+	v.path, v.widened = nil, false
+	v.segments(q.segments)
+}
+
+func (v *VisitorProjection) visitRelQuery(q *RelQuery) {
+	v.path, v.widened = nil, false
+	v.segments(q.segments)
+}
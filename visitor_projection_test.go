@@ -0,0 +1,115 @@
+package gojimongo
+
+import (
+	"testing"
+)
+
+func TestMongoProjection(t *testing.T) {
+	queries := map[string]string{
+		"$":                                 `{}`,
+		"$.store.book":                      `{"store.book":1}`,
+		"$.store.book[0:5]":                 `{"store.book":{"$slice":[0,5]}}`,
+		"$.store.book[0:5].title":           `{"store.book.title":1}`,
+		"$.store.book[*].title":             `{"store.book.title":1}`,
+		"$.store['book','bicycle'].price":   `{"store.book.price":1,"store.bicycle.price":1}`,
+		"$.book[:3]":                        `{"book":{"$slice":[0,3]}}`,
+		"$.book[2:]":                        `{"book":{"$slice":[2,2147483647]}}`,
+		"$.book[-2:]":                       `{"book":{"$slice":[-2,2]}}`,
+		"$.book[::2]":                       `{"book":1}`,
+		"$.book[0]":                         `{"book":{"$slice":[0,1]}}`,
+		"$.book[-1]":                        `{"book":{"$slice":[-1,1]}}`,
+		"$.orders[?(@.status == 'open')]":   `{"orders":{"$elemMatch":{"status":{"$eq":"open"}}}}`,
+		"$.a.orders[?(@.status == 'open')]": `{"a.orders":1}`,
+		"$.scores[?(@ > 5)]":                `{"scores":{"$elemMatch":{"$gt":5}}}`,
+		"$.orders[?(@.a > @.b)]":            `{"orders":1}`,
+		"$.store..price":                    `{"store":1}`,
+		"$['a','a']":                        `{"a":1}`,
+		"$['a.b','c']":                      `{}`,
+		"$..price":                          `{}`,
+	}
+	c := &Compiler{}
+	for query, expected := range queries {
+		q, err := c.Compile(query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", query, err)
+		}
+		projection, err := MongoProjection(q, WithArrayTraversal())
+		if err != nil {
+			t.Errorf("MongoProjection(%q) = %v", query, err)
+			continue
+		}
+		if projection.String() != expected {
+			t.Errorf("MongoProjection(%q) = %s; expected %s", query, projection, expected)
+		}
+	}
+}
+
+func TestMongoProjectionExact(t *testing.T) {
+	queries := []struct {
+		query      string
+		projection string
+		exact      bool
+	}{
+		{"$.store.book", `{"store.book":1}`, true},
+		{"$.store.book[0:5]", `{"store.book":{"$slice":[0,5]}}`, true},
+		{"$.store.book[*]", `{"store.book":1}`, true},
+		{"$.store.book[0:5].title", `{"store.book.title":1}`, false},
+		{"$.store.book[*].title", `{"store.book":1}`, false},
+		{"$.orders[?(@.status == 'open')]", `{"orders":1}`, false},
+		{"$.book[::2]", `{"book":1}`, false},
+		{"$.x['a', 0]", `{"x":1}`, false},
+		{"$.a[0:1]['b','c']", `{"a.b":1,"a.c":1}`, false},
+		{"$..price", `{}`, false},
+	}
+	c := &Compiler{}
+	for _, tc := range queries {
+		q, err := c.Compile(tc.query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", tc.query, err)
+		}
+		v := NewVisitorProjection()
+		q.accept(v)
+		projection, err := v.Result()
+		if err != nil {
+			t.Errorf("MongoProjection(%q) = %v", tc.query, err)
+			continue
+		}
+		if projection.String() != tc.projection || v.Exact() != tc.exact {
+			t.Errorf("MongoProjection(%q) = %s %v; expected %s %v", tc.query, projection, v.Exact(), tc.projection, tc.exact)
+		}
+	}
+}
+
+func TestMongoFind(t *testing.T) {
+	c := &Compiler{}
+	queries := []struct {
+		query      string
+		filter     string
+		projection string
+		exact      bool
+		exactProj  bool
+	}{
+		{"$.orders[?(@.total > 10)].id", `{"orders":{"$elemMatch":{"total":{"$gt":10},"id":{"$exists":true}}}}`, `{"orders.id":1}`, true, false},
+		{"$.store.book[0:5].title", `{"store.book":{"$exists":true}}`, `{"store.book.title":1}`, false, false},
+		{"$.store.book[0:5]", `{"store.book":{"$exists":true}}`, `{"store.book":{"$slice":[0,5]}}`, false, true},
+		{"$.store.book[0].title", `{"store.book.0.title":{"$exists":true}}`, `{"store.book.title":1}`, true, false},
+		{"$..author", `{}`, `{}`, false, false},
+	}
+	for _, tc := range queries {
+		q, err := c.Compile(tc.query)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", tc.query, err)
+		}
+		find, err := MongoFind(q, WithArrayTraversal())
+		if err != nil {
+			t.Errorf("MongoFind(%q) = %v", tc.query, err)
+			continue
+		}
+		if find.Filter.String() != tc.filter || find.Projection.String() != tc.projection ||
+			find.Exact != tc.exact || find.ExactProjection != tc.exactProj {
+			t.Errorf("MongoFind(%q) = %s %s %v %v; expected %s %s %v %v", tc.query,
+				find.Filter, find.Projection, find.Exact, find.ExactProjection,
+				tc.filter, tc.projection, tc.exact, tc.exactProj)
+		}
+	}
+}
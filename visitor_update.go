@@ -0,0 +1,237 @@
+package gojimongo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	UPDATE_ERROR_NOT_ABSOLUTE = "update paths must be absolute queries"
+	UPDATE_ERROR_EMPTY_PATH   = "update paths must select a field"
+	UPDATE_ERROR_UNKNOWN_OP   = "unknown update operation"
+	UPDATE_ERROR_NOT_A_NUMBER = "increment value must be a number"
+	UPDATE_ERROR_SELECTORS    = "update paths select one member, index, wildcard or filter per segment"
+	UPDATE_ERROR_ROOT_FILTER  = "the root document cannot be filtered"
+)
+
+// UpdateOp is the operation an update applies at the locations a path selects.
+type UpdateOp int
+
+const (
+	UpdateSet UpdateOp = iota + 1
+	UpdateUnset
+	UpdateInc
+	UpdatePush
+	UpdatePull
+)
+
+var updateOperators = map[UpdateOp]string{
+	UpdateSet:   "$set",
+	UpdateUnset: "$unset",
+	UpdateInc:   "$inc",
+	UpdatePush:  "$push",
+	UpdatePull:  "$pull",
+}
+
+// Update holds the arguments of an update command built from a path.
+type Update struct {
+	Update       D
+	ArrayFilters []D
+}
+
+// VisitorUpdate translates an absolute query into the field path of an update
+// operator. Names and indexes become path components, a wildcard becomes the
+// all-positional $[] and a filter becomes a filtered positional $[<id>] whose
+// condition is added to the array filters.
+type VisitorUpdate struct {
+	partialVisitor
+	path         []string
+	arrayFilters []D
+	used         map[string]bool
+	config       mongoConfig
+}
+
+func NewVisitorUpdate(opts ...MongoOption) *VisitorUpdate {
+	return &VisitorUpdate{used: map[string]bool{}, config: newMongoConfig(opts)}
+}
+
+// Result returns the field path and array filters of the last visited query.
+func (v *VisitorUpdate) Result() (string, []D, error) {
+	if v.err != nil {
+		return "", nil, v.err
+	}
+	return strings.Join(v.path, "."), v.arrayFilters, nil
+}
+
+// CompileUpdate compiles path and builds the update applying op with value at
+// every location the path selects.
+func CompileUpdate(path string, op UpdateOp, value any, opts ...MongoOption) (*Update, error) {
+	c := &Compiler{}
+	q, err := c.Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	return MongoUpdate(q, op, value, opts...)
+}
+
+// MongoUpdate builds the update applying op with value at every location the
+// compiled query q selects.
+func MongoUpdate(q Query, op UpdateOp, value any, opts ...MongoOption) (*Update, error) {
+	operator, ok := updateOperators[op]
+	if !ok {
+		return nil, updateError(fmt.Sprintf("%s %d", UPDATE_ERROR_UNKNOWN_OP, op))
+	}
+	if _, ok := q.(*AbsQuery); !ok {
+		return nil, updateError(UPDATE_ERROR_NOT_ABSOLUTE)
+	}
+	switch op {
+	case UpdateUnset:
+		value = ""
+	case UpdateInc:
+		if !isNumber(value) {
+			return nil, updateError(UPDATE_ERROR_NOT_A_NUMBER)
+		}
+	}
+	v := NewVisitorUpdate(opts...)
+	q.accept(v)
+	field, arrayFilters, err := v.Result()
+	if err != nil {
+		return nil, err
+	}
+	if field == "" {
+		return nil, updateError(UPDATE_ERROR_EMPTY_PATH)
+	}
+	return &Update{
+		Update:       D{{operator, D{{field, value}}}},
+		ArrayFilters: arrayFilters,
+	}, nil
+}
+
+func updateError(value string) error {
+	return fmt.Errorf("[gojimongo][update]: %s", value)
+}
+
+func isNumber(value any) bool {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func (v *VisitorUpdate) fail(node any, reason string) {
+	if v.err == nil {
+		v.err = &TranslationError{Node: nodeName(node), Reason: reason}
+	}
+}
+
+func (v *VisitorUpdate) step(node any, name string) {
+	if name == "" || strings.Contains(name, ".") || strings.HasPrefix(name, "$") {
+		v.fail(node, MONGO_ERROR_FIELD_NAME)
+		return
+	}
+	v.path = append(v.path, name)
+}
+
+// identifier names the array filter of a filtered positional operator after
+// the closest field it applies to, as in orders.$[o].
+func (v *VisitorUpdate) identifier() string {
+	prefix := "e"
+	for i := len(v.path) - 1; i >= 0; i-- {
+		if c := v.path[i][0] | 0x20; c >= 'a' && c <= 'z' {
+			prefix = string(c)
+			break
+		}
+	}
+	id := prefix
+	for i := 1; v.used[id]; i++ {
+		id = prefix + strconv.Itoa(i)
+	}
+	v.used[id] = true
+	return id
+}
+
+// SELECTORS
+func (v *VisitorUpdate) visitNameSelector(s *NameSelector) {
+	v.step(s, s.value)
+}
+
+func (v *VisitorUpdate) visitStringExpr(e *StringExpr) {
+	v.step(e, unquote(e.value))
+}
+
+func (v *VisitorUpdate) visitIntExpr(e *IntExpr) {
+	v.path = append(v.path, strconv.Itoa(e.value))
+}
+
+// visitPointerSelector steps to the element of an array or the member of an
+// object, which the path reaches alike.
+func (v *VisitorUpdate) visitPointerSelector(s *PointerSelector) {
+	v.path = append(v.path, strconv.Itoa(s.index))
+}
+
+func (v *VisitorUpdate) visitMinusExpr(e *MinusExpr) {
+	v.fail(e, MONGO_ERROR_NEGATIVE_INDEX)
+}
+
+func (v *VisitorUpdate) visitWildcardSelector(s *WildCardSelector) {
+	v.path = append(v.path, "$[]")
+}
+
+func (v *VisitorUpdate) visitFilterSelector(s *FilterSelector) {
+	if len(v.path) == 0 {
+		v.fail(s, UPDATE_ERROR_ROOT_FILTER)
+		return
+	}
+	id := v.identifier()
+	find := NewVisitorMongo()
+	find.config = v.config
+	find.base = []string{id}
+	cond := find.condition(s.cond)
+	if find.err != nil {
+		v.err = find.err
+		return
+	}
+	if find.usedRoot {
+		v.fail(s, MONGO_ERROR_ROOT_IN_ELEMENT)
+		return
+	}
+	v.path = append(v.path, "$["+id+"]")
+	v.arrayFilters = append(v.arrayFilters, implicitAnd(cond))
+}
+
+func (v *VisitorUpdate) visitSliceSelector(s *SliceSelector) {
+	v.fail(s, MONGO_ERROR_SLICE)
+}
+
+// SEGMENTS
+func (v *VisitorUpdate) visitDotChildSegment(s *DotChildSegment) {
+	s.selector.accept(v)
+}
+
+func (v *VisitorUpdate) visitChildSegment(s *ChildSegment) {
+	if len(s.selectors) != 1 {
+		v.fail(s, UPDATE_ERROR_SELECTORS)
+		return
+	}
+	s.selectors[0].accept(v)
+}
+
+func (v *VisitorUpdate) visitDescendantSegment(s *DescendantSegment) {
+	v.fail(s, MONGO_ERROR_DESCENDANT)
+}
+
+func (v *VisitorUpdate) visitAbsQuery(q *AbsQuery) {
+	v.path = nil
+	v.arrayFilters = nil
+	for _, seg := range q.segments {
+		seg.accept(v)
+		if v.err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package gojimongo
+
+import (
+	"testing"
+)
+
+func TestCompileUpdate(t *testing.T) {
+	queries := []struct {
+		path         string
+		op           UpdateOp
+		value        any
+		update       string
+		arrayFilters []string
+	}{
+		{"$.orders[?(@.status=='open')].shipped", UpdateSet, true, `{"$set":{"orders.$[o].shipped":true}}`, []string{`{"o.status":{"$eq":"open"}}`}},
+		{"$.orders[*].total", UpdateInc, 5, `{"$inc":{"orders.$[].total":5}}`, nil},
+		{"$.orders[2].note", UpdateUnset, nil, `{"$unset":{"orders.2.note":""}}`, nil},
+		{"$['tags']", UpdatePush, "new", `{"$push":{"tags":"new"}}`, nil},
+		{"$.tags", UpdatePull, "old", `{"$pull":{"tags":"old"}}`, nil},
+		{"$.a[?(@ > 5)][?(@.x == 1 && @.y == 2)].z", UpdateSet, 0, `{"$set":{"a.$[a].$[a1].z":0}}`,
+			[]string{`{"a":{"$gt":5}}`, `{"a1.x":{"$eq":1},"a1.y":{"$eq":2}}`}},
+	}
+	for _, tc := range queries {
+		u, err := CompileUpdate(tc.path, tc.op, tc.value)
+		if err != nil {
+			t.Errorf("CompileUpdate(%q) = %v", tc.path, err)
+			continue
+		}
+		if u.Update.String() != tc.update {
+			t.Errorf("CompileUpdate(%q) update = %s; expected %s", tc.path, u.Update, tc.update)
+		}
+		if len(u.ArrayFilters) != len(tc.arrayFilters) {
+			t.Errorf("CompileUpdate(%q) array filters = %v; expected %v", tc.path, u.ArrayFilters, tc.arrayFilters)
+			continue
+		}
+		for i, f := range u.ArrayFilters {
+			if f.String() != tc.arrayFilters[i] {
+				t.Errorf("CompileUpdate(%q) array filter %d = %s; expected %s", tc.path, i, f, tc.arrayFilters[i])
+			}
+		}
+	}
+}
+
+func TestCompileUpdateErrors(t *testing.T) {
+	queries := []struct {
+		path  string
+		op    UpdateOp
+		value any
+	}{
+		{"$", UpdateSet, 1},
+		{"@.a", UpdateSet, 1},
+		{"$..a", UpdateSet, 1},
+		{"$.a[-1]", UpdateSet, 1},
+		{"$.a[0:2]", UpdateSet, 1},
+		{"$.a['b','c']", UpdateSet, 1},
+		{"$[?(@.a == 1)]", UpdateSet, 1},
+		{"$.a[?(@.b == $.c)]", UpdateSet, 1},
+		{"$.a[?(@.b == @.c)]", UpdateSet, 1},
+		{"$.a", UpdateInc, "one"},
+		{"$.a", UpdateOp(0), 1},
+	}
+	for _, tc := range queries {
+		if u, err := CompileUpdate(tc.path, tc.op, tc.value); err == nil {
+			t.Errorf("CompileUpdate(%q) = %s; expected an error", tc.path, u.Update)
+		}
+	}
+}